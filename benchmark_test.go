@@ -45,9 +45,6 @@ func BenchmarkApplyMasking(b *testing.B) {
 
 func BenchmarkMaskEmailWithRules(b *testing.B) {
 	setupMaskingDefaultsState()
-	b.Cleanup(func() {
-		defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
-	})
 	runtimeState := NewRuntimeFromGlobals()
 	email := "benchmark.user@example.com"
 
@@ -59,9 +56,6 @@ func BenchmarkMaskEmailWithRules(b *testing.B) {
 
 func BenchmarkMaskPhoneWithRules(b *testing.B) {
 	setupMaskingDefaultsState()
-	b.Cleanup(func() {
-		defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
-	})
 	runtimeState := NewRuntimeFromGlobals()
 	phone := "+7 (900) 111-22-33"
 
@@ -73,9 +67,6 @@ func BenchmarkMaskPhoneWithRules(b *testing.B) {
 
 func BenchmarkProcessLine(b *testing.B) {
 	setupMaskingDefaultsState()
-	b.Cleanup(func() {
-		defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
-	})
 	line := strings.Repeat(
 		"INSERT INTO `users` VALUES (1, 'benchmark.user@example.com', '+7 (900) 111-22-33');\n",
 		4,
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"container/list"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// CacheBackendJSON keeps the whole cache in memory and persists it as
+	// one JSON file.
+	CacheBackendJSON = "json"
+	// CacheBackendDisk keeps a bounded LRU tier in memory in front of an
+	// embedded on-disk key/value store.
+	CacheBackendDisk = "disk"
+
+	defaultCacheMemoryEntries = 100000
+)
+
+// CacheBackend is a storage tier for masked values keyed by data type name
+// and original value.
+type CacheBackend interface {
+	Get(typeName, value string) (string, bool, error)
+	Put(typeName, value, masked string) error
+	// Claim makes value the owner of masked among the masks of its data
+	// type. It reports false when another value owns masked; owners never
+	// change.
+	Claim(typeName, value, masked string) (bool, error)
+	// Claimable reports whether Claim would succeed, claiming nothing.
+	Claimable(typeName, value, masked string) (bool, error)
+	// Flush persists buffered writes.
+	Flush() error
+	// Purge drops whatever the tier keeps in memory; persisted entries stay.
+	Purge()
+	Close() error
+}
+
+// cacheEntryKey joins a type name and a value into one map key.
+func cacheEntryKey(typeName, value string) string {
+	return typeName + "\x00" + value
+}
+
+// ownersTypeName is the type name under which the memory tier keeps the
+// owners of the masks of a data type, keyed by mask.
+func ownersTypeName(typeName string) string {
+	return "\x00owners\x00" + typeName
+}
+
+// lruCacheBackend is the in-memory tier: at most capacity entries, the least
+// recently used one is evicted first. It never persists anything.
+type lruCacheBackend struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	masked string
+}
+
+func newLRUCacheBackend(capacity int) *lruCacheBackend {
+	if capacity <= 0 {
+		capacity = defaultCacheMemoryEntries
+	}
+	return &lruCacheBackend{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements CacheBackend.
+func (c *lruCacheBackend) Get(typeName, value string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[cacheEntryKey(typeName, value)]
+	if !ok {
+		return "", false, nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).masked, true, nil
+}
+
+// Put implements CacheBackend.
+func (c *lruCacheBackend) Put(typeName, value, masked string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheEntryKey(typeName, value)
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry).masked = masked
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, masked: masked})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Claim implements CacheBackend. An evicted owner is forgotten: the memory
+// tier alone detects collisions among the entries it holds.
+func (c *lruCacheBackend) Claim(typeName, value, masked string) (bool, error) {
+	if owner, ok, _ := c.Get(ownersTypeName(typeName), masked); ok {
+		return owner == value, nil
+	}
+	return true, c.Put(ownersTypeName(typeName), masked, value)
+}
+
+// Claimable implements CacheBackend.
+func (c *lruCacheBackend) Claimable(typeName, value, masked string) (bool, error) {
+	owner, ok, _ := c.Get(ownersTypeName(typeName), masked)
+	return !ok || owner == value, nil
+}
+
+// Len returns the number of entries held in memory.
+func (c *lruCacheBackend) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Flush implements CacheBackend.
+func (c *lruCacheBackend) Flush() error { return nil }
+
+// Purge implements CacheBackend.
+func (c *lruCacheBackend) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Close implements CacheBackend.
+func (c *lruCacheBackend) Close() error { return nil }
+
+var (
+	boltMetaBucket     = []byte("_meta")
+	boltOwnersBucket   = []byte("_owners")
+	boltHashKeyIDKey   = []byte("hash_key_id")
+	boltCacheKeyIDKey  = []byte("cache_key_id")
+	boltOwnersKey      = []byte("owners")
+	boltCacheKeyIDNone = []byte("none")
+)
+
+// boltCacheBackend is the on-disk tier built on an embedded bbolt database:
+// one bucket per data type, and in the _owners bucket one bucket per data
+// type mapping masks back to the bucket keys of the values that own them.
+// Writes are buffered and committed in batches of batchSize entries. With a
+// cache key, bucket keys are HMACs of the original values and of the masks,
+// and stored masks are AES-GCM encrypted, so the file holds no plaintext
+// PII.
+type boltCacheBackend struct {
+	mu        sync.Mutex
+	db        *bolt.DB
+	batchSize int
+	pending   map[string]map[string]string
+	// pendingOwners holds the buffered claims: the storage key of the
+	// owner by data type and mask.
+	pendingOwners map[string]map[string]string
+	pendingN      int
+
+	secret []byte
+	aead   cipher.AEAD
+}
+
+// openBoltCacheBackend opens or creates the database at path. A database
+// built with another hash key is emptied (its masks do not match this run);
+// one encrypted with another cache key, or whose encryption state does not
+// match the config, is refused. A database written before masks had owners
+// gets them from its entries.
+func openBoltCacheBackend(path string, batchSize int, hashKeyID string, secret []byte) (*boltCacheBackend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk cache %s: %v", path, err)
+	}
+	db.NoSync = true
+
+	b := &boltCacheBackend{
+		db:            db,
+		batchSize:     batchSize,
+		pending:       make(map[string]map[string]string),
+		pendingOwners: make(map[string]map[string]string),
+		secret:        secret,
+	}
+	if secret != nil {
+		if b.aead, err = cacheCipher(secret); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	wantCacheKeyID := boltCacheKeyIDNone
+	if secret != nil {
+		wantCacheKeyID = []byte(keyID(secret, "cache"))
+	}
+	var resetErr error
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		if stored := meta.Get(boltCacheKeyIDKey); stored != nil && string(stored) != string(wantCacheKeyID) {
+			return fmt.Errorf("%w: disk cache %s was written with another cache key or encryption setting", errCacheIntegrity, path)
+		}
+		if stored := meta.Get(boltHashKeyIDKey); stored != nil && string(stored) != hashKeyID {
+			// Masks built with another hash key must not leak into this run.
+			var names [][]byte
+			if err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				if string(name) != string(boltMetaBucket) {
+					names = append(names, append([]byte(nil), name...))
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, name := range names {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			resetErr = fmt.Errorf("disk cache %s was built with a different hash key, starting with an empty cache", path)
+		}
+		if meta.Get(boltOwnersKey) == nil {
+			if err := b.indexOwners(tx); err != nil {
+				return fmt.Errorf("disk cache %s: %w", path, err)
+			}
+		}
+		if err := meta.Put(boltOwnersKey, []byte("1")); err != nil {
+			return err
+		}
+		if err := meta.Put(boltCacheKeyIDKey, wantCacheKeyID); err != nil {
+			return err
+		}
+		return meta.Put(boltHashKeyIDKey, []byte(hashKeyID))
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return b, resetErr
+}
+
+// indexOwners records the owners of the masks stored in the data type
+// buckets. Where two values share a mask, the first one in key order owns
+// it.
+func (b *boltCacheBackend) indexOwners(tx *bolt.Tx) error {
+	root, err := tx.CreateBucketIfNotExists(boltOwnersBucket)
+	if err != nil {
+		return err
+	}
+	var names [][]byte
+	if err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if string(name) != string(boltMetaBucket) && string(name) != string(boltOwnersBucket) {
+			names = append(names, append([]byte(nil), name...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, name := range names {
+		owners, err := root.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(name).ForEach(func(key, stored []byte) error {
+			masked, err := b.open(key, stored)
+			if err != nil {
+				return err
+			}
+			if maskKey := b.storageKey(masked); owners.Get(maskKey) == nil {
+				return owners.Put(maskKey, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storageKey maps an original value to its bucket key.
+func (b *boltCacheBackend) storageKey(value string) []byte {
+	if b.secret == nil {
+		return []byte(value)
+	}
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Get implements CacheBackend.
+func (b *boltCacheBackend) Get(typeName, value string) (string, bool, error) {
+	b.mu.Lock()
+	if masked, ok := b.pending[typeName][value]; ok {
+		b.mu.Unlock()
+		return masked, true, nil
+	}
+	b.mu.Unlock()
+
+	key := b.storageKey(value)
+	var stored []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(typeName)); bucket != nil {
+			if v := bucket.Get(key); v != nil {
+				stored = append([]byte(nil), v...)
+			}
+		}
+		return nil
+	})
+	if err != nil || stored == nil {
+		return "", false, err
+	}
+	masked, err := b.open(key, stored)
+	if err != nil {
+		return "", false, err
+	}
+	return masked, true, nil
+}
+
+// open returns the mask stored under key, decrypting it with a cache key.
+func (b *boltCacheBackend) open(key, stored []byte) (string, error) {
+	if b.aead == nil {
+		return string(stored), nil
+	}
+	if len(stored) < b.aead.NonceSize() {
+		return "", fmt.Errorf("%w: truncated disk cache entry", errCacheIntegrity)
+	}
+	plain, err := b.aead.Open(nil, stored[:b.aead.NonceSize()], stored[b.aead.NonceSize():], key)
+	if err != nil {
+		return "", fmt.Errorf("%w: disk cache entry was modified", errCacheIntegrity)
+	}
+	return string(plain), nil
+}
+
+// Put implements CacheBackend.
+func (b *boltCacheBackend) Put(typeName, value, masked string) error {
+	b.mu.Lock()
+	if b.pending[typeName] == nil {
+		b.pending[typeName] = make(map[string]string)
+	}
+	if _, ok := b.pending[typeName][value]; !ok {
+		b.pendingN++
+	}
+	b.pending[typeName][value] = masked
+	full := b.pendingN >= b.batchSize
+	b.mu.Unlock()
+
+	if full {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Claim implements CacheBackend. The claim is buffered like a Put.
+func (b *boltCacheBackend) Claim(typeName, value, masked string) (bool, error) {
+	b.mu.Lock()
+	free, err := b.claimable(typeName, value, masked)
+	if !free || err != nil {
+		b.mu.Unlock()
+		return free, err
+	}
+	if b.pendingOwners[typeName] == nil {
+		b.pendingOwners[typeName] = make(map[string]string)
+	}
+	if _, ok := b.pendingOwners[typeName][masked]; !ok {
+		b.pendingOwners[typeName][masked] = string(b.storageKey(value))
+		b.pendingN++
+	}
+	full := b.pendingN >= b.batchSize
+	b.mu.Unlock()
+
+	if full {
+		return true, b.Flush()
+	}
+	return true, nil
+}
+
+// Claimable implements CacheBackend.
+func (b *boltCacheBackend) Claimable(typeName, value, masked string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.claimable(typeName, value, masked)
+}
+
+// claimable compares the owner of masked, buffered or stored, with value.
+// The caller holds mu, so no claim is buffered in between.
+func (b *boltCacheBackend) claimable(typeName, value, masked string) (bool, error) {
+	owner := b.storageKey(value)
+	if stored, ok := b.pendingOwners[typeName][masked]; ok {
+		return stored == string(owner), nil
+	}
+	free := true
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if root := tx.Bucket(boltOwnersBucket); root != nil {
+			if owners := root.Bucket([]byte(typeName)); owners != nil {
+				if stored := owners.Get(b.storageKey(masked)); stored != nil {
+					free = string(stored) == string(owner)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return free, nil
+}
+
+// Flush implements CacheBackend.
+func (b *boltCacheBackend) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pendingN == 0 {
+		return nil
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for typeName, entries := range b.pending {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(typeName))
+			if err != nil {
+				return err
+			}
+			for value, masked := range entries {
+				key := b.storageKey(value)
+				stored := []byte(masked)
+				if b.aead != nil {
+					nonce := make([]byte, b.aead.NonceSize())
+					if _, err := rand.Read(nonce); err != nil {
+						return err
+					}
+					stored = b.aead.Seal(nonce, nonce, stored, key)
+				}
+				if err := bucket.Put(key, stored); err != nil {
+					return err
+				}
+			}
+		}
+		root, err := tx.CreateBucketIfNotExists(boltOwnersBucket)
+		if err != nil {
+			return err
+		}
+		for typeName, owners := range b.pendingOwners {
+			bucket, err := root.CreateBucketIfNotExists([]byte(typeName))
+			if err != nil {
+				return err
+			}
+			for masked, owner := range owners {
+				if err := bucket.Put(b.storageKey(masked), []byte(owner)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.pending = make(map[string]map[string]string)
+	b.pendingOwners = make(map[string]map[string]string)
+	b.pendingN = 0
+	return nil
+}
+
+// Purge implements CacheBackend. Buffered writes are committed first so no
+// entry is lost.
+func (b *boltCacheBackend) Purge() {
+	if err := b.Flush(); err != nil && logger != nil {
+		logger.Warn("Disk cache flush warning: %v", err)
+	}
+}
+
+// Close implements CacheBackend.
+func (b *boltCacheBackend) Close() error {
+	flushErr := b.Flush()
+	if err := b.db.Sync(); err != nil && flushErr == nil {
+		flushErr = err
+	}
+	if err := b.db.Close(); err != nil && flushErr == nil {
+		flushErr = err
+	}
+	return flushErr
+}
+
+// tieredCacheBackend puts the LRU tier in front of the disk tier: hits from
+// disk are promoted to memory, writes go to both. Owners are kept in memory
+// once known, as they never change.
+type tieredCacheBackend struct {
+	memory *lruCacheBackend
+	disk   CacheBackend
+}
+
+// Get implements CacheBackend.
+func (t *tieredCacheBackend) Get(typeName, value string) (string, bool, error) {
+	if masked, ok, _ := t.memory.Get(typeName, value); ok {
+		return masked, true, nil
+	}
+	masked, ok, err := t.disk.Get(typeName, value)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	_ = t.memory.Put(typeName, value, masked)
+	return masked, true, nil
+}
+
+// Put implements CacheBackend.
+func (t *tieredCacheBackend) Put(typeName, value, masked string) error {
+	_ = t.memory.Put(typeName, value, masked)
+	return t.disk.Put(typeName, value, masked)
+}
+
+// Claim implements CacheBackend.
+func (t *tieredCacheBackend) Claim(typeName, value, masked string) (bool, error) {
+	if owner, ok, _ := t.memory.Get(ownersTypeName(typeName), masked); ok {
+		return owner == value, nil
+	}
+	free, err := t.disk.Claim(typeName, value, masked)
+	if free && err == nil {
+		_ = t.memory.Put(ownersTypeName(typeName), masked, value)
+	}
+	return free, err
+}
+
+// Claimable implements CacheBackend.
+func (t *tieredCacheBackend) Claimable(typeName, value, masked string) (bool, error) {
+	if owner, ok, _ := t.memory.Get(ownersTypeName(typeName), masked); ok {
+		return owner == value, nil
+	}
+	return t.disk.Claimable(typeName, value, masked)
+}
+
+// Flush implements CacheBackend.
+func (t *tieredCacheBackend) Flush() error { return t.disk.Flush() }
+
+// Purge implements CacheBackend.
+func (t *tieredCacheBackend) Purge() {
+	t.memory.Purge()
+	t.disk.Purge()
+}
+
+// Close implements CacheBackend.
+func (t *tieredCacheBackend) Close() error { return t.disk.Close() }
+
+// openDiskCache builds a Cache backed by the LRU and on-disk tiers. A nil
+// cache means the database could not be opened.
+func openDiskCache() (*Cache, error) {
+	disk, err := openBoltCacheBackend(AppConfig.CachePath, AppConfig.CacheFlushCount, keyID(HashKey, "hash"), CacheKey)
+	if disk == nil {
+		return nil, err
+	}
+	cache := newCache()
+	cache.backend = &tieredCacheBackend{
+		memory: newLRUCacheBackend(AppConfig.CacheMemoryEntries),
+		disk:   disk,
+	}
+	return cache, err
+}
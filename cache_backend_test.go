@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestLRUCacheBackendEvictsLeastRecentlyUsed(t *testing.T) {
+	lru := newLRUCacheBackend(2)
+	_ = lru.Put(EmailTypeName, "a@b.com", "x@b.com")
+	_ = lru.Put(EmailTypeName, "c@d.com", "y@d.com")
+
+	// Touch the first entry so the second one becomes the eviction victim.
+	if _, ok, _ := lru.Get(EmailTypeName, "a@b.com"); !ok {
+		t.Fatal("expected entry present")
+	}
+	_ = lru.Put(PhoneTypeName, "+79001112233", "+79551112233")
+
+	if lru.Len() != 2 {
+		t.Fatalf("expected capacity respected, got %d entries", lru.Len())
+	}
+	if _, ok, _ := lru.Get(EmailTypeName, "c@d.com"); ok {
+		t.Fatal("expected least recently used entry evicted")
+	}
+	if masked, ok, _ := lru.Get(EmailTypeName, "a@b.com"); !ok || masked != "x@b.com" {
+		t.Fatalf("expected recently used entry kept, got %q", masked)
+	}
+}
+
+func TestDiskCacheSurvivesEvictionAndReopen(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.db")
+		AppConfig.CacheBackend = CacheBackendDisk
+		AppConfig.CacheMemoryEntries = 1
+		AppConfig.CacheFlushCount = 2
+
+		cache, err := loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rt := newTestRuntime()
+		first := rt.MaskEmailWithRules("first@example.com", cache)
+		rt.MaskEmailWithRules("second@example.com", cache)
+		rt.MaskEmailWithRules("third@example.com", cache)
+
+		// The memory tier holds one entry; the rest must come from disk.
+		if masked, ok := cache.lookup(EmailTypeName, "first@example.com"); !ok || masked != first {
+			t.Fatalf("expected evicted entry served from disk, got %q", masked)
+		}
+		freeMemory(cache)
+		if err := saveCache(cache); err != nil {
+			t.Fatalf("unexpected save error: %v", err)
+		}
+		if err := closeCache(cache); err != nil {
+			t.Fatalf("unexpected close error: %v", err)
+		}
+
+		reopened, err := loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = closeCache(reopened) }()
+		if masked, ok := reopened.lookup(EmailTypeName, "third@example.com"); !ok || masked != rt.MaskEmailWithRules("third@example.com", nil) {
+			t.Fatalf("expected entries persisted across runs, got %q", masked)
+		}
+	})
+}
+
+func TestEncryptedDiskCache(t *testing.T) {
+	withTestGlobals(t, func() {
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.db")
+		AppConfig.CacheBackend = CacheBackendDisk
+		CacheKey = []byte("cache-secret-0123456789")
+
+		cache, err := loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cache.store(EmailTypeName, "secret@example.com", "s1a2b3c@example.com")
+		if err := closeCache(cache); err != nil {
+			t.Fatalf("unexpected close error: %v", err)
+		}
+
+		data, err := os.ReadFile(AppConfig.CachePath)
+		if err != nil {
+			t.Fatalf("failed to read disk cache: %v", err)
+		}
+		if strings.Contains(string(data), "secret@example.com") || strings.Contains(string(data), "s1a2b3c") {
+			t.Fatal("expected no plaintext values in the encrypted disk cache")
+		}
+
+		CacheKey = []byte("another-secret-0123456789")
+		if _, err := loadCache(); !errors.Is(err, errCacheIntegrity) {
+			t.Fatalf("expected disk cache of another key refused, got: %v", err)
+		}
+	})
+}
+
+func TestDiskCacheReportsModifiedEntries(t *testing.T) {
+	withTestGlobals(t, func() {
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.db")
+		AppConfig.CacheBackend = CacheBackendDisk
+		CacheKey = []byte("cache-secret-0123456789")
+
+		cache, err := loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cache.store(EmailTypeName, "secret@example.com", "s1a2b3c@example.com")
+		if err := closeCache(cache); err != nil {
+			t.Fatalf("unexpected close error: %v", err)
+		}
+
+		db, err := bolt.Open(AppConfig.CachePath, 0600, nil)
+		if err != nil {
+			t.Fatalf("failed to open disk cache: %v", err)
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(EmailTypeName))
+			return bucket.ForEach(func(k, v []byte) error {
+				v = append([]byte(nil), v...)
+				v[len(v)-1] ^= 1
+				return bucket.Put(k, v)
+			})
+		})
+		if err != nil {
+			t.Fatalf("failed to modify disk cache: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close disk cache: %v", err)
+		}
+
+		cache, err = loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = closeCache(cache) }()
+		if _, ok := cache.lookup(EmailTypeName, "secret@example.com"); ok {
+			t.Fatal("expected a modified entry to miss")
+		}
+		if err := cache.Err(); !errors.Is(err, errCacheIntegrity) {
+			t.Fatalf("expected a modified entry to fail the cache, got: %v", err)
+		}
+	})
+}
+
+func TestDiskCacheIndexesOwnersOfOlderCaches(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		AppConfig.Masking.Email = MaskingRule{Target: "username:1-", Value: "*"}
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.db")
+		AppConfig.CacheBackend = CacheBackendDisk
+		CacheKey = []byte("cache-secret-0123456789")
+
+		cache, err := loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cache.store(EmailTypeName, "ab@example.com", "**@example.com")
+		if err := closeCache(cache); err != nil {
+			t.Fatalf("unexpected close error: %v", err)
+		}
+
+		// A cache written before masks had owners holds the entries only.
+		db, err := bolt.Open(AppConfig.CachePath, 0600, nil)
+		if err != nil {
+			t.Fatalf("failed to open disk cache: %v", err)
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			if err := tx.Bucket(boltMetaBucket).Delete(boltOwnersKey); err != nil {
+				return err
+			}
+			return tx.DeleteBucket(boltOwnersBucket)
+		})
+		if err != nil {
+			t.Fatalf("failed to downgrade disk cache: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close disk cache: %v", err)
+		}
+
+		cache, err = loadCache()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = closeCache(cache) }()
+		if masked, outcome := newTestRuntime().maskEmail("cd@example.com", cache); outcome != outcomeCollision || masked == "**@example.com" {
+			t.Fatalf("expected the owner indexed from the entries, got %q (outcome %d)", masked, outcome)
+		}
+
+		data, err := os.ReadFile(AppConfig.CachePath)
+		if err != nil {
+			t.Fatalf("failed to read disk cache: %v", err)
+		}
+		if strings.Contains(string(data), "example.com") {
+			t.Fatal("expected no plaintext values or masks in the encrypted disk cache")
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+// cacheBatch lets a batch of masking jobs run on a worker ahead of the
+// batches submitted before it. Masks of colliding values depend on which
+// value claimed a mask first, so the jobs must see the cache as a serial run
+// would. The jobs of the batch work on a private overlay of the shared cache
+// and record every operation; commit replays the record in submission order
+// and applies it when every read gives what the jobs saw. When a batch before
+// it changed one of those reads, nothing is applied and the batch is masked
+// again in direct mode, with its operations going straight to the shared
+// cache.
+type cacheBatch struct {
+	shared *Cache
+	// direct sends every operation straight to the shared cache.
+	direct bool
+	// replay marks the overlay that checks a record: it records nothing.
+	replay bool
+	ops    []cacheOp
+	// stores and owners overlay the shared cache: masks stored by the
+	// batch keyed by cacheEntryKey(type, value), and the values owning the
+	// masks it claimed keyed by cacheEntryKey(type, mask).
+	stores map[string]string
+	owners map[string]string
+}
+
+type cacheOpKind uint8
+
+const (
+	cacheOpLookup cacheOpKind = iota
+	cacheOpClaim
+	cacheOpStore
+	cacheOpEffect
+)
+
+// cacheOp is one recorded operation and, for reads, its result.
+type cacheOp struct {
+	kind     cacheOpKind
+	typeName string
+	value    string
+	masked   string
+	ok       bool
+	effect   func()
+}
+
+func newCacheBatch(shared *Cache) *cacheBatch {
+	return &cacheBatch{
+		shared: shared,
+		stores: make(map[string]string),
+		owners: make(map[string]string),
+	}
+}
+
+// newCacheView returns the cache a batch of jobs masks with: lookups,
+// stores, claims and effects go to a new cacheBatch over shared.
+func newCacheView(shared *Cache) *Cache {
+	return &Cache{batch: newCacheBatch(shared)}
+}
+
+func (b *cacheBatch) lookup(typeName, value string) (string, bool) {
+	if b.direct {
+		return b.shared.lookup(typeName, value)
+	}
+	masked, ok := b.stores[cacheEntryKey(typeName, value)]
+	if !ok {
+		masked, ok = b.shared.lookup(typeName, value)
+	}
+	b.record(cacheOp{kind: cacheOpLookup, typeName: typeName, value: value, masked: masked, ok: ok})
+	return masked, ok
+}
+
+func (b *cacheBatch) store(typeName, value, masked string) {
+	if b.direct {
+		b.shared.store(typeName, value, masked)
+		return
+	}
+	b.stores[cacheEntryKey(typeName, value)] = masked
+	b.record(cacheOp{kind: cacheOpStore, typeName: typeName, value: value, masked: masked})
+}
+
+func (b *cacheBatch) claim(typeName, value, masked string) bool {
+	if b.direct {
+		return b.shared.claim(typeName, value, masked)
+	}
+	key := cacheEntryKey(typeName, masked)
+	owner, ok := b.owners[key]
+	free := owner == value
+	if !ok {
+		free = b.shared.claimable(typeName, value, masked)
+	}
+	if free {
+		b.owners[key] = value
+	}
+	b.record(cacheOp{kind: cacheOpClaim, typeName: typeName, value: value, masked: masked, ok: free})
+	return free
+}
+
+func (b *cacheBatch) effect(f func()) {
+	if b.direct {
+		f()
+		return
+	}
+	b.record(cacheOp{kind: cacheOpEffect, effect: f})
+}
+
+func (b *cacheBatch) record(op cacheOp) {
+	if !b.replay {
+		b.ops = append(b.ops, op)
+	}
+}
+
+// commit applies the record to the shared cache and runs the effects when
+// replaying it gives the results the jobs saw, and reports whether it did.
+// Either way the batch is in direct mode afterwards. Commits must run in
+// submission order, one at a time.
+func (b *cacheBatch) commit() bool {
+	ops := b.ops
+	b.ops = nil
+	b.stores = nil
+	b.owners = nil
+	b.direct = true
+
+	check := newCacheBatch(b.shared)
+	check.replay = true
+	for _, op := range ops {
+		switch op.kind {
+		case cacheOpLookup:
+			if masked, ok := check.lookup(op.typeName, op.value); masked != op.masked || ok != op.ok {
+				return false
+			}
+		case cacheOpClaim:
+			if check.claim(op.typeName, op.value, op.masked) != op.ok {
+				return false
+			}
+		case cacheOpStore:
+			check.store(op.typeName, op.value, op.masked)
+		}
+	}
+
+	for _, op := range ops {
+		switch op.kind {
+		case cacheOpClaim:
+			if op.ok {
+				b.shared.claim(op.typeName, op.value, op.masked)
+			}
+		case cacheOpStore:
+			b.shared.store(op.typeName, op.value, op.masked)
+		case cacheOpEffect:
+			op.effect()
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// encryptedCacheMagic prefixes an encrypted cache file. It is also bound to
+// the ciphertext as additional authenticated data.
+var encryptedCacheMagic = []byte("MASKDUMP-CACHE-AESGCM-1\n")
+
+// errCacheIntegrity marks a cache file that must not be used: it was
+// tampered with, encrypted with another key, or its encryption state does
+// not match the configuration. Overwriting it would destroy data, so the run
+// stops instead.
+var errCacheIntegrity = errors.New("cache integrity check failed")
+
+// cacheCipher builds the AES-256-GCM cipher for a cache key. The secret is
+// hashed so that any key file content yields a 256-bit AES key.
+func cacheCipher(secret []byte) (cipher.AEAD, error) {
+	key := sha256.Sum256(append([]byte("maskdump-cache:"), secret...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealCache encrypts serialized cache data: magic | nonce | ciphertext.
+func sealCache(plain, secret []byte) ([]byte, error) {
+	aead, err := cacheCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate cache nonce: %v", err)
+	}
+	out := make([]byte, 0, len(encryptedCacheMagic)+len(nonce)+len(plain)+aead.Overhead())
+	out = append(out, encryptedCacheMagic...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, encryptedCacheMagic), nil
+}
+
+// openCache decrypts and authenticates data produced by sealCache.
+func openCache(data, secret []byte) ([]byte, error) {
+	aead, err := cacheCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	body := data[len(encryptedCacheMagic):]
+	if len(body) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: encrypted cache is truncated", errCacheIntegrity)
+	}
+	nonce, ciphertext := body[:aead.NonceSize()], body[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, encryptedCacheMagic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cache was modified or encrypted with another key", errCacheIntegrity)
+	}
+	return plain, nil
+}
+
+// isEncryptedCache reports whether raw cache file content is encrypted.
+func isEncryptedCache(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedCacheMagic)
+}
+
+// writeFileAtomic replaces path with data via a temporary file in the same
+// directory, so readers never observe a partially written file. The file is
+// created with the given permissions regardless of the umask.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+	}
+
+	if err := tmp.Chmod(perm); err != nil {
+		cleanup()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTieBreakAttempts bounds the tie-breaker variants tried for one value.
+// Each attempt lengthens the tag, so a unique mask is found long before.
+const maxTieBreakAttempts = 15
+
+// claim makes value the owner of masked among the masks of its data type.
+// It reports false when another value already owns masked. The owners are
+// kept with the cache entries: seeded from the loaded cache with the json
+// backend, stored on disk with the disk backend, so masks of earlier runs
+// count too. A nil cache claims everything.
+func (c *Cache) claim(typeName, value, masked string) bool {
+	if c == nil {
+		return true
+	}
+	if c.batch != nil {
+		return c.batch.claim(typeName, value, masked)
+	}
+	if c.backend != nil {
+		return backendClaim(c.backend.Claim(typeName, value, masked))
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	owners := c.ownersOf(typeName)
+	if owner, ok := owners[masked]; ok && owner != value {
+		return false
+	}
+	owners[masked] = value
+	return true
+}
+
+// claimable reports whether claim would succeed, claiming nothing.
+func (c *Cache) claimable(typeName, value, masked string) bool {
+	if c.backend != nil {
+		return backendClaim(c.backend.Claimable(typeName, value, masked))
+	}
+	c.Lock()
+	defer c.Unlock()
+	owner, ok := c.ownersOf(typeName)[masked]
+	return !ok || owner == value
+}
+
+// backendClaim returns the result of a backend claim. An error leaves the
+// mask to value, like a failed lookup leaves the value uncached.
+func backendClaim(free bool, err error) bool {
+	if err != nil && logger != nil {
+		logger.Warn("Cache claim warning: %v", err)
+	}
+	return free || err != nil
+}
+
+// ownersOf returns the owners of the masks of a data type, seeded from the
+// in-memory maps on first use. The caller holds the lock.
+func (c *Cache) ownersOf(typeName string) map[string]string {
+	if c.owners == nil {
+		c.owners = make(map[string]map[string]string)
+	}
+	owners, ok := c.owners[typeName]
+	if !ok {
+		owners = make(map[string]string)
+		for original, mask := range c.entries(typeName) {
+			owners[mask] = original
+		}
+		c.owners[typeName] = owners
+	}
+	return owners
+}
+
+// effect runs f, which reports or counts how a value was masked, once the
+// cache operations before it are final: at once, or when the batch of a
+// view commits. A nil cache runs it at once.
+func (c *Cache) effect(f func()) {
+	if c != nil && c.batch != nil {
+		c.batch.effect(f)
+		return
+	}
+	f()
+}
+
+// entries returns the in-memory map of a data type. The caller holds the
+// lock.
+func (c *Cache) entries(typeName string) map[string]string {
+	switch typeName {
+	case EmailTypeName:
+		return c.Emails
+	case PhoneTypeName:
+		return c.Phones
+	default:
+		return c.Types[typeName]
+	}
+}
+
+// remember stores a computed mask in the cache. When another value already
+// got the same mask, which truncated hashes and constant masks such as "*"
+// make likely, the mask is replaced by its first tie-breaker variant that no
+// other value owns, so UNIQUE columns stay unique.
+func (r *Runtime) remember(typeName, value, masked string, cache *Cache) (string, maskOutcome) {
+	if cache.claim(typeName, value, masked) {
+		cache.store(typeName, value, masked)
+		return masked, outcomeCacheMiss
+	}
+	resolved := false
+	for attempt := 1; attempt <= maxTieBreakAttempts && !resolved; attempt++ {
+		candidate := breakTie(masked, value, attempt, r.HashKey)
+		if cache.claim(typeName, value, candidate) {
+			masked, resolved = candidate, true
+		}
+	}
+	cache.effect(func() { r.reportCollision(typeName, resolved) })
+	cache.store(typeName, value, masked)
+	return masked, outcomeCollision
+}
+
+// breakTie derives a variant of a colliding mask from a keyed hash of the
+// original value: emails get a tag appended to the local part, values with
+// digits get their last digits replaced, anything else gets the tag
+// appended. Later attempts use longer tags.
+func breakTie(masked, value string, attempt int, key []byte) string {
+	tag := truncateHash(hashHex("maskdump:collision:"+value, Email, key), 2+2*attempt)
+
+	if at := strings.IndexByte(masked, '@'); at >= 0 && strings.Count(masked, "@") == 1 {
+		return masked[:at] + "-" + tag + masked[at:]
+	}
+
+	digits := 0
+	for i := 0; i < len(masked); i++ {
+		if masked[i] >= '0' && masked[i] <= '9' {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return masked + "-" + tag
+	}
+	n := min(digits, 1+attempt, len(tag))
+	out := []byte(masked)
+	for i := len(out) - 1; i >= 0 && n > 0; i-- {
+		if out[i] >= '0' && out[i] <= '9' {
+			n--
+			out[i] = byte('0' + hexValue(tag[n])%10)
+		}
+	}
+	return string(out)
+}
+
+// reportCollision logs the first mask collision of each data type; the
+// others are counted in --stats only. With --fail-on-collision the first
+// one aborts the run.
+func (r *Runtime) reportCollision(typeName string, resolved bool) {
+	msg := fmt.Sprintf("%s masks collide: distinct values got the same mask, which was extended to keep it unique", typeName)
+	if !resolved {
+		msg = fmt.Sprintf("%s masks collide and no unique tie-breaker was found: the dump holds duplicate masked values", typeName)
+	}
+
+	r.strictMu.Lock()
+	defer r.strictMu.Unlock()
+	if r.FailOnCollision {
+		if r.strictErr == nil {
+			r.strictErr = fmt.Errorf("--fail-on-collision: %s", msg)
+		}
+		return
+	}
+	if r.collided[typeName] {
+		return
+	}
+	if r.collided == nil {
+		r.collided = make(map[string]bool)
+	}
+	r.collided[typeName] = true
+	if logger != nil {
+		logger.Warn("%s (further collisions are counted in --stats)", msg)
+	}
+}
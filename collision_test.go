@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaskCollisionsKeepMasksUnique(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		AppConfig.Masking.Email = MaskingRule{Target: "username:1-", Value: "*"}
+		rt := newTestRuntime()
+		cache := newCache()
+
+		first := rt.MaskEmailWithRules("ab@example.com", cache)
+		if first != "**@example.com" {
+			t.Fatalf("expected the first value to keep its mask, got %q", first)
+		}
+		seen := map[string]string{first: "ab@example.com"}
+		for _, email := range []string{"cd@example.com", "ef@example.com", "gh@example.com"} {
+			masked, outcome := rt.maskEmail(email, cache)
+			if outcome != outcomeCollision || !strings.HasPrefix(masked, "**-") || !strings.HasSuffix(masked, "@example.com") {
+				t.Fatalf("expected %s to get an extended mask, got %q (outcome %d)", email, masked, outcome)
+			}
+			if owner, ok := seen[masked]; ok {
+				t.Fatalf("%s and %s got the same mask %q", owner, email, masked)
+			}
+			seen[masked] = email
+		}
+
+		// The resolved mask is cached, and the tie-breaker is deterministic.
+		again := rt.MaskEmailWithRules("cd@example.com", cache)
+		fresh := newCache()
+		rt.MaskEmailWithRules("ab@example.com", fresh)
+		if other := rt.MaskEmailWithRules("cd@example.com", fresh); other != again {
+			t.Fatalf("expected the same tie-breaker in every run, got %q and %q", again, other)
+		}
+		if _, outcome := rt.maskEmail("cd@example.com", cache); outcome != outcomeCacheHit {
+			t.Fatalf("expected the resolved mask cached, got outcome %d", outcome)
+		}
+	})
+}
+
+func TestMaskCollisionsOfTruncatedHashes(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		AppConfig.Masking.Email = MaskingRule{Target: "username:1-", Value: "hash:1"}
+		AppConfig.Masking.Phone = MaskingRule{Target: "10-11", Value: "*"}
+		rt := newTestRuntime()
+		cache := newCache()
+
+		emails := map[string]bool{}
+		phones := map[string]bool{}
+		for i := 0; i < 200; i++ {
+			emails[rt.MaskEmailWithRules(fmt.Sprintf("user%d@example.com", i), cache)] = true
+			phones[rt.MaskPhoneWithRules(fmt.Sprintf("+7 916 555-%02d-%02d", i/100, i%100), cache)] = true
+		}
+		if len(emails) != 200 || len(phones) != 200 {
+			t.Fatalf("expected 200 unique masks per type, got %d emails and %d phones", len(emails), len(phones))
+		}
+		for phone := range phones {
+			if stripDigits(phone) != stripDigits("+7 916 555-12-**") || len(phone) != len("+7 916 555-12-**") {
+				t.Fatalf("expected tie-broken phones to keep their format, got %q", phone)
+			}
+		}
+	})
+}
+
+func TestMaskCollisionsHealLoadedCache(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		rt := newTestRuntime()
+		cache := newCache()
+		// A cache written before collision detection holds a shared mask.
+		cache.Emails["a@example.com"] = "x@example.com"
+		cache.Emails["b@example.com"] = "x@example.com"
+
+		first := rt.MaskEmailWithRules("a@example.com", cache)
+		second := rt.MaskEmailWithRules("b@example.com", cache)
+		if first == second {
+			t.Fatalf("expected the shared mask replaced for one value, both got %q", first)
+		}
+	})
+}
+
+func TestMaskCollisionsAcrossPurgesAndRuns(t *testing.T) {
+	for _, backend := range []string{CacheBackendJSON, CacheBackendDisk} {
+		withTestGlobals(t, func() {
+			setupMaskingDefaults(t)
+			AppConfig.Masking.Email = MaskingRule{Target: "username:1-", Value: "*"}
+			AppConfig.CachePath = filepath.Join(t.TempDir(), "cache")
+			AppConfig.CacheBackend = backend
+			AppConfig.CacheMemoryEntries = 1
+			AppConfig.CacheFlushCount = 1
+			rt := newTestRuntime()
+
+			cache, err := loadCache()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", backend, err)
+			}
+			first := rt.MaskEmailWithRules("ab@example.com", cache)
+			freeMemory(cache)
+			second, outcome := rt.maskEmail("cd@example.com", cache)
+			if outcome != outcomeCollision || second == first {
+				t.Fatalf("%s: expected the owner of %q kept across the purge, got %q (outcome %d)", backend, first, second, outcome)
+			}
+			freeMemory(cache)
+			if again := rt.MaskEmailWithRules("cd@example.com", cache); again != second {
+				t.Fatalf("%s: expected one mask per value across purges, got %q and %q", backend, second, again)
+			}
+			if err := saveCache(cache); err != nil {
+				t.Fatalf("%s: unexpected save error: %v", backend, err)
+			}
+			if err := closeCache(cache); err != nil {
+				t.Fatalf("%s: unexpected close error: %v", backend, err)
+			}
+
+			// The next run compares with the masks of this one.
+			cache, err = loadCache()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", backend, err)
+			}
+			defer func() { _ = closeCache(cache) }()
+			if masked, ok := cache.lookup(EmailTypeName, "ab@example.com"); !ok || masked != first {
+				t.Fatalf("%s: expected the purged entry saved, got %q, %v", backend, masked, ok)
+			}
+			if masked, outcome := rt.maskEmail("ef@example.com", cache); outcome != outcomeCollision || masked == first || masked == second {
+				t.Fatalf("%s: expected a collision with the masks of the earlier run, got %q (outcome %d)", backend, masked, outcome)
+			}
+		})
+	}
+}
+
+func TestMaskCollisionsInStatsAndFatal(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		AppConfig.Masking.Email = MaskingRule{Target: "username:1-", Value: "*"}
+		ProcessingTables = map[string]TableConfig{"users": {Email: []string{"email"}}}
+		config := MaskConfig{emailAlgorithm: algorithmLightHash}
+		dump := "INSERT INTO `users` (`id`, `email`) VALUES (1,'ab@example.com'),(2,'cd@example.com'),(3,'ef@example.com');\n"
+
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		parser := NewDialectParser(DialectMySQL, rt)
+		out, _ := parser.ProcessLine(dump, config, newCache())
+		if strings.Count(out, "'**@example.com'") != 1 {
+			t.Fatalf("expected one value to keep the plain mask, got %q", out)
+		}
+		if stats := rt.Stats.Tables["users"]; stats.Collisions[EmailTypeName] != 2 || stats.Masked[EmailTypeName] != 3 || stats.CacheMisses != 3 {
+			t.Fatalf("expected two collisions counted, got %+v", stats)
+		}
+		if err := rt.StrictError(); err != nil {
+			t.Fatalf("expected collisions to be warnings by default, got %v", err)
+		}
+
+		rt = newTestRuntime()
+		rt.FailOnCollision = true
+		NewDialectParser(DialectMySQL, rt).ProcessLine(dump, config, newCache())
+		if err := rt.StrictError(); err == nil || !strings.Contains(err.Error(), "--fail-on-collision: email masks collide") {
+			t.Fatalf("expected a collision error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Magic bytes of the compressed input formats.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// openDumpInput returns the dump stream of r, decompressing gzip, zstd,
+// bzip2 and xz input recognized by its magic bytes. Other input is returned
+// as is. The name of the detected format is "" for plain input.
+func openDumpInput(r io.Reader) (io.ReadCloser, string, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, "", fmt.Errorf("failed to read input: %v", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid gzip input: %v", err)
+		}
+		return zr, "gzip", nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid zstd input: %v", err)
+		}
+		return zr.IOReadCloser(), "zstd", nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return io.NopCloser(bzip2.NewReader(br)), "bzip2", nil
+	case bytes.HasPrefix(magic, xzMagic):
+		zr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid xz input: %v", err)
+		}
+		return io.NopCloser(zr), "xz", nil
+	}
+	return io.NopCloser(br), "", nil
+}
+
+// outputCompression selects the compression of the masked dump.
+type outputCompression struct {
+	// format is "gzip", "zstd" or "" for plain output.
+	format string
+	// level is the format's compression level; 0 picks its default.
+	level int
+}
+
+// parseOutputCompression validates the --output-compression and
+// --output-compression-level flags.
+func parseOutputCompression(format string, level int) (outputCompression, error) {
+	switch format {
+	case "", "none":
+		if level != 0 {
+			return outputCompression{}, fmt.Errorf("--output-compression-level requires --output-compression")
+		}
+		return outputCompression{}, nil
+	case "gzip":
+		if level < 0 || level > gzip.BestCompression {
+			return outputCompression{}, fmt.Errorf("gzip compression level must be 1-9, got %d", level)
+		}
+	case "zstd":
+		if level < 0 || level > 22 {
+			return outputCompression{}, fmt.Errorf("zstd compression level must be 1-22, got %d", level)
+		}
+	default:
+		return outputCompression{}, fmt.Errorf("unsupported output compression %q (expected none|gzip|zstd)", format)
+	}
+	return outputCompression{format: format, level: level}, nil
+}
+
+// writer wraps w with the compressor, or returns nil for plain output.
+func (c outputCompression) writer(w io.Writer) (io.WriteCloser, error) {
+	switch c.format {
+	case "gzip":
+		level := c.level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case "zstd":
+		level := zstd.SpeedDefault
+		if c.level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+	}
+	return nil, nil
+}
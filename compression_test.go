@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const compressionSample = "INSERT INTO users VALUES (1,'alice@example.com');\n"
+
+func TestOpenDumpInputDetectsFormats(t *testing.T) {
+	compress := func(newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+		var buf bytes.Buffer
+		w, err := newWriter(&buf)
+		if err != nil {
+			t.Fatalf("failed to create compressor: %v", err)
+		}
+		if _, err := io.WriteString(w, compressionSample); err != nil {
+			t.Fatalf("failed to compress: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to close compressor: %v", err)
+		}
+		return buf.Bytes()
+	}
+	bz2, err := os.ReadFile(filepath.Join("testdata", "compressed", "users.sql.bz2"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	inputs := map[string][]byte{
+		"": []byte(compressionSample),
+		"gzip": compress(func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}),
+		"zstd": compress(func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		}),
+		"xz": compress(func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		}),
+		"bzip2": bz2,
+	}
+	for want, input := range inputs {
+		r, format, err := openDumpInput(bytes.NewReader(input))
+		if err != nil {
+			t.Fatalf("%q: open failed: %v", want, err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%q: read failed: %v", want, err)
+		}
+		_ = r.Close()
+		if format != want || string(data) != compressionSample {
+			t.Fatalf("%q: got format %q and data %q", want, format, data)
+		}
+	}
+
+	// Short and empty plain input must not trip the magic byte check.
+	for _, input := range []string{"", "x"} {
+		r, format, err := openDumpInput(strings.NewReader(input))
+		if err != nil || format != "" {
+			t.Fatalf("%q: expected plain input, got format %q, err %v", input, format, err)
+		}
+		if data, _ := io.ReadAll(r); string(data) != input {
+			t.Fatalf("%q: got data %q", input, data)
+		}
+	}
+}
+
+func TestParseOutputCompression(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		level  int
+		ok     bool
+	}{
+		{"", 0, true},
+		{"none", 0, true},
+		{"gzip", 0, true},
+		{"gzip", 9, true},
+		{"gzip", 10, false},
+		{"zstd", 19, true},
+		{"zstd", 23, false},
+		{"none", 3, false},
+		{"bzip2", 0, false},
+	} {
+		_, err := parseOutputCompression(tt.format, tt.level)
+		if (err == nil) != tt.ok {
+			t.Fatalf("parseOutputCompression(%q, %d): unexpected error state: %v", tt.format, tt.level, err)
+		}
+	}
+}
+
+func TestDumpOutputCompresses(t *testing.T) {
+	for _, format := range []string{"gzip", "zstd"} {
+		compression, err := parseOutputCompression(format, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		path := filepath.Join(t.TempDir(), "masked.sql")
+		out, err := openDumpOutput(path, false, compression)
+		if err != nil {
+			t.Fatalf("%s: open failed: %v", format, err)
+		}
+		if _, err := out.WriteString(compressionSample); err != nil {
+			t.Fatalf("%s: write failed: %v", format, err)
+		}
+		if err := out.Commit(); err != nil {
+			t.Fatalf("%s: commit failed: %v", format, err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		r, detected, err := openDumpInput(file)
+		if err != nil {
+			t.Fatalf("%s: reopen failed: %v", format, err)
+		}
+		data, _ := io.ReadAll(r)
+		_ = r.Close()
+		_ = file.Close()
+		if detected != format || string(data) != compressionSample {
+			t.Fatalf("%s: got format %q and data %q", format, detected, data)
+		}
+	}
+}
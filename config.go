@@ -32,33 +32,36 @@ type MaskingConfig struct {
 	Phone MaskingRule `json:"phone"`
 }
 
-// TableConfig stores table field names to be masked per data type.
-type TableConfig struct {
-	Email []string `json:"email"`
-	Phone []string `json:"phone"`
-}
-
 // Config holds the full application configuration.
 //
 // skip_insert_into_table_list and processing_tables are deprecated aliases
 // of skip_table_data_list and masking_tables; LoadConfig folds them into the
 // canonical fields and warns.
 type Config struct {
-	DBFormat                string                 `json:"db_format"`
-	CachePath               string                 `json:"cache_path"`
-	EmailRegex              string                 `json:"email_regex"`
-	PhoneRegex              string                 `json:"phone_regex"`
-	EmailWhiteList          string                 `json:"email_white_list"`
-	PhoneWhiteList          string                 `json:"phone_white_list"`
-	MemoryLimitMB           int                    `json:"memory_limit_mb"`
-	CacheFlushCount         int                    `json:"cache_flush_count"`
-	SkipInsertIntoTableList string                 `json:"skip_insert_into_table_list"`
-	SkipTableDataList       string                 `json:"skip_table_data_list"`
-	NoMaskingTableList      string                 `json:"no_masking_table_list"`
-	Masking                 MaskingConfig          `json:"masking"`
-	ProcessingTables        map[string]TableConfig `json:"processing_tables"`
-	MaskingTables           map[string]TableConfig `json:"masking_tables"`
-	Logging                 LogConfig              `json:"logging"`
+	DBFormat                string                    `json:"db_format"`
+	CachePath               string                    `json:"cache_path"`
+	EmailRegex              string                    `json:"email_regex"`
+	PhoneRegex              string                    `json:"phone_regex"`
+	EmailWhiteList          string                    `json:"email_white_list"`
+	PhoneWhiteList          string                    `json:"phone_white_list"`
+	HashKeyFile             string                    `json:"hash_key_file"`
+	HashKeyEnv              string                    `json:"hash_key_env"`
+	FPEKeyFile              string                    `json:"fpe_key_file"`
+	FPEKeyEnv               string                    `json:"fpe_key_env"`
+	CacheKeyFile            string                    `json:"cache_key_file"`
+	CacheKeyEnv             string                    `json:"cache_key_env"`
+	CacheBackend            string                    `json:"cache_backend"`
+	CacheMemoryEntries      int                       `json:"cache_memory_entries"`
+	MemoryLimitMB           int                       `json:"memory_limit_mb"`
+	CacheFlushCount         int                       `json:"cache_flush_count"`
+	SkipInsertIntoTableList string                    `json:"skip_insert_into_table_list"`
+	SkipTableDataList       string                    `json:"skip_table_data_list"`
+	NoMaskingTableList      string                    `json:"no_masking_table_list"`
+	Masking                 MaskingConfig             `json:"masking"`
+	DataTypes               map[string]DataTypeConfig `json:"data_types"`
+	ProcessingTables        map[string]TableConfig    `json:"processing_tables"`
+	MaskingTables           map[string]TableConfig    `json:"masking_tables"`
+	Logging                 LogConfig                 `json:"logging"`
 }
 
 func getDefaultConfigPaths() []string {
@@ -158,15 +161,17 @@ func LoadSkipList(path string) (map[string]struct{}, error) {
 func LoadConfig(explicitPath string) error {
 	// 1. Set default values first
 	defaultConfig := Config{
-		DBFormat:          string(DialectAuto),
-		CachePath:         filepath.Join(os.Getenv("HOME"), defaultCacheFileName),
-		EmailRegex:        defaultEmailRegex,
-		PhoneRegex:        defaultPhoneRegex,
-		EmailWhiteList:    "",
-		PhoneWhiteList:    "",
-		MemoryLimitMB:     defaultMemoryLimitMB,
-		CacheFlushCount:   defaultCacheFlushCount,
-		SkipTableDataList: "",
+		DBFormat:           string(DialectAuto),
+		CachePath:          filepath.Join(os.Getenv("HOME"), defaultCacheFileName),
+		CacheBackend:       CacheBackendJSON,
+		CacheMemoryEntries: defaultCacheMemoryEntries,
+		EmailRegex:         defaultEmailRegex,
+		PhoneRegex:         defaultPhoneRegex,
+		EmailWhiteList:     "",
+		PhoneWhiteList:     "",
+		MemoryLimitMB:      defaultMemoryLimitMB,
+		CacheFlushCount:    defaultCacheFlushCount,
+		SkipTableDataList:  "",
 		Masking: MaskingConfig{
 			Email: MaskingRule{
 				Target: "username:2-",
@@ -234,6 +239,30 @@ func LoadConfig(explicitPath string) error {
 		if fileConfig.PhoneWhiteList != "" {
 			AppConfig.PhoneWhiteList = fileConfig.PhoneWhiteList
 		}
+		if fileConfig.HashKeyFile != "" {
+			AppConfig.HashKeyFile = fileConfig.HashKeyFile
+		}
+		if fileConfig.HashKeyEnv != "" {
+			AppConfig.HashKeyEnv = fileConfig.HashKeyEnv
+		}
+		if fileConfig.FPEKeyFile != "" {
+			AppConfig.FPEKeyFile = fileConfig.FPEKeyFile
+		}
+		if fileConfig.FPEKeyEnv != "" {
+			AppConfig.FPEKeyEnv = fileConfig.FPEKeyEnv
+		}
+		if fileConfig.CacheKeyFile != "" {
+			AppConfig.CacheKeyFile = fileConfig.CacheKeyFile
+		}
+		if fileConfig.CacheKeyEnv != "" {
+			AppConfig.CacheKeyEnv = fileConfig.CacheKeyEnv
+		}
+		if fileConfig.CacheBackend != "" {
+			AppConfig.CacheBackend = fileConfig.CacheBackend
+		}
+		if fileConfig.CacheMemoryEntries != 0 {
+			AppConfig.CacheMemoryEntries = fileConfig.CacheMemoryEntries
+		}
 		if fileConfig.MemoryLimitMB != 0 {
 			AppConfig.MemoryLimitMB = fileConfig.MemoryLimitMB
 		}
@@ -265,6 +294,9 @@ func LoadConfig(explicitPath string) error {
 		if fileConfig.Masking.Phone.Value != "" {
 			AppConfig.Masking.Phone.Value = fileConfig.Masking.Phone.Value
 		}
+		if len(fileConfig.DataTypes) > 0 {
+			AppConfig.DataTypes = fileConfig.DataTypes
+		}
 		if fileConfig.Logging.Path != "" {
 			AppConfig.Logging.Path = fileConfig.Logging.Path
 		}
@@ -302,6 +334,15 @@ func validateConfig() error {
 	}
 	AppConfig.DBFormat = string(dialect)
 
+	switch AppConfig.CacheBackend {
+	case CacheBackendJSON, CacheBackendDisk:
+	default:
+		return fmt.Errorf("unsupported cache_backend %q (expected json|disk)", AppConfig.CacheBackend)
+	}
+	if AppConfig.CacheMemoryEntries < 0 {
+		return fmt.Errorf("cache_memory_entries must not be negative")
+	}
+
 	// For the cache, we check the directory's availability and write permissions
 	cacheDir := filepath.Dir(AppConfig.CachePath)
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
@@ -365,6 +406,24 @@ func validateConfig() error {
 		return fmt.Errorf("failed to load phone white list: %v", err)
 	}
 
+	// Load the keyed hashing secret
+	HashKey, err = loadSecret("hash key", AppConfig.HashKeyFile, AppConfig.HashKeyEnv)
+	if err != nil {
+		return err
+	}
+
+	// Load the format-preserving encryption secret
+	FPEKey, err = loadSecret("fpe key", AppConfig.FPEKeyFile, AppConfig.FPEKeyEnv)
+	if err != nil {
+		return err
+	}
+
+	// Load the cache encryption secret
+	CacheKey, err = loadSecret("cache key", AppConfig.CacheKeyFile, AppConfig.CacheKeyEnv)
+	if err != nil {
+		return err
+	}
+
 	// Load table lists
 	SkipTableList, err = LoadSkipList(AppConfig.SkipTableDataList)
 	if err != nil {
@@ -376,6 +435,16 @@ func validateConfig() error {
 		return fmt.Errorf("failed to load no-masking table list: %v", err)
 	}
 
+	// Register custom data types and make sure every masking_tables entry
+	// points at a known type
+	CustomDataTypes, err = loadDataTypes(AppConfig.DataTypes)
+	if err != nil {
+		return err
+	}
+	if err := validateTableTypes(AppConfig.ProcessingTables, CustomDataTypes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -135,3 +136,134 @@ func TestCheckFileAccessRemovesProbeFile(t *testing.T) {
 		t.Fatalf("expected probe file removed when it did not exist before, stat err: %v", err)
 	}
 }
+
+func TestLoadConfigDataTypes(t *testing.T) {
+	withTestGlobals(t, func() {
+		configPath := writeConfigFixture(t, `{
+			"cache_path": "__CACHE__",
+			"data_types": {
+				"inn": {
+					"regex": "\\b\\d{12}\\b",
+					"algorithm": "light-mask",
+					"masking": {"target": "3-10", "value": "hash"}
+				}
+			},
+			"masking_tables": {"users": {"email": ["email"], "inn": ["tax_id"], "profile": {"json": {"$.inn": "inn", "contacts[*].email": "email"}}, "options": {"php": ["email", "inn"]}}}
+		}`)
+
+		if err := LoadConfig(configPath); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		dt, ok := CustomDataTypes["inn"]
+		if !ok || dt.Algorithm != "light-mask" || !dt.Regex.MatchString("500100732259") {
+			t.Fatalf("expected inn data type registered, got: %+v", CustomDataTypes)
+		}
+		cfg := ProcessingTables["users"]
+		if len(cfg.Email) != 1 || len(cfg.Types["inn"]) != 1 || cfg.Types["inn"][0] != "tax_id" {
+			t.Fatalf("expected custom type columns parsed, got: %+v", cfg)
+		}
+		if want := map[string]string{"$.inn": "inn", "contacts[*].email": "email"}; !reflect.DeepEqual(cfg.JSON["profile"], want) {
+			t.Fatalf("expected JSON column paths parsed, got: %+v", cfg.JSON)
+		}
+		if !reflect.DeepEqual(cfg.PHP["options"], []string{"email", "inn"}) {
+			t.Fatalf("expected PHP column types parsed, got: %+v", cfg.PHP)
+		}
+	})
+}
+
+func TestLoadConfigRejectsUnknownDataTypes(t *testing.T) {
+	cases := map[string]string{
+		"unknown type in masking_tables": `{
+			"cache_path": "__CACHE__",
+			"masking_tables": {"users": {"passport": ["doc"]}}
+		}`,
+		"unknown type in a JSON column": `{
+			"cache_path": "__CACHE__",
+			"masking_tables": {"users": {"profile": {"json": {"$.doc": "passport"}}}}
+		}`,
+		"invalid JSON column path": `{
+			"cache_path": "__CACHE__",
+			"masking_tables": {"users": {"profile": {"json": {"$.phones[x]": "phone"}}}}
+		}`,
+		"unknown type in a PHP column": `{
+			"cache_path": "__CACHE__",
+			"masking_tables": {"b_user": {"options": {"php": ["passport"]}}}
+		}`,
+		"column object with two formats": `{
+			"cache_path": "__CACHE__",
+			"masking_tables": {"b_user": {"options": {"php": ["email"], "json": {"$.email": "email"}}}}
+		}`,
+		"JSON column without paths": `{
+			"cache_path": "__CACHE__",
+			"masking_tables": {"users": {"profile": {"paths": {"$.phone": "phone"}}}}
+		}`,
+		"built-in type redefined": `{
+			"cache_path": "__CACHE__",
+			"data_types": {"email": {"regex": "x", "algorithm": "light-hash", "masking": {"target": "1-", "value": "*"}}}
+		}`,
+		"unsupported algorithm": `{
+			"cache_path": "__CACHE__",
+			"data_types": {"inn": {"regex": "\\d{12}", "algorithm": "rot13", "masking": {"target": "1-", "value": "*"}}}
+		}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			withTestGlobals(t, func() {
+				configPath := writeConfigFixture(t, body)
+				if err := LoadConfig(configPath); err == nil {
+					t.Fatal("expected config error")
+				}
+			})
+		})
+	}
+}
+
+func TestLoadConfigHashKey(t *testing.T) {
+	withTestGlobals(t, func() {
+		t.Setenv("MASKDUMP_TEST_HASH_KEY", "  0123456789abcdef-secret\n")
+		configPath := writeConfigFixture(t, `{
+			"cache_path": "__CACHE__",
+			"hash_key_env": "MASKDUMP_TEST_HASH_KEY"
+		}`)
+
+		if err := LoadConfig(configPath); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(HashKey) != "0123456789abcdef-secret" {
+			t.Fatalf("expected trimmed key loaded from env, got %d bytes", len(HashKey))
+		}
+	})
+}
+
+func TestLoadConfigRejectsBadHashKey(t *testing.T) {
+	cases := map[string]string{
+		"short key": `{
+			"cache_path": "__CACHE__",
+			"hash_key_env": "MASKDUMP_TEST_SHORT_KEY"
+		}`,
+		"unset env": `{
+			"cache_path": "__CACHE__",
+			"hash_key_env": "MASKDUMP_TEST_MISSING_KEY"
+		}`,
+		"both sources": `{
+			"cache_path": "__CACHE__",
+			"hash_key_file": "__SKIP__",
+			"hash_key_env": "MASKDUMP_TEST_SHORT_KEY"
+		}`,
+	}
+	t.Setenv("MASKDUMP_TEST_SHORT_KEY", "short")
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			withTestGlobals(t, func() {
+				configPath := writeConfigFixture(t, body)
+				err := LoadConfig(configPath)
+				if err == nil {
+					t.Fatal("expected hash key error")
+				}
+				if strings.Contains(err.Error(), "short\"") {
+					t.Fatalf("expected the key value kept out of errors, got: %v", err)
+				}
+			})
+		})
+	}
+}
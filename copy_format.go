@@ -0,0 +1,644 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// COPY "schema"."table" [(col1, col2, ...)] FROM stdin [[WITH] options];
+var pgCopyRegex = regexp.MustCompile(`(?i)^COPY\s+([^\s(]+)\s*(?:\(([^)]*)\))?\s*FROM\s+stdin\b\s*(.*?)\s*;\s*$`)
+
+const pgCopyTerminator = `\.`
+
+// copyStatement is a parsed COPY ... FROM stdin statement.
+type copyStatement struct {
+	table string
+	// columns is the column list, nil when it cannot be parsed; hasColumns
+	// tells whether the statement has one.
+	columns    []string
+	hasColumns bool
+	format     copyFormat
+	// err reports options the data rows cannot be read with.
+	err error
+}
+
+// parseCopyStatement parses a COPY ... FROM stdin statement line.
+func parseCopyStatement(body string) (copyStatement, bool) {
+	matches := pgCopyRegex.FindStringSubmatch(body)
+	if matches == nil {
+		return copyStatement{}, false
+	}
+	stmt := copyStatement{table: matches[1]}
+	if strings.TrimSpace(matches[2]) != "" {
+		stmt.columns = splitColumnList(matches[2])
+		stmt.hasColumns = true
+	}
+	stmt.format, stmt.err = parseCopyOptions(matches[3])
+	return stmt, true
+}
+
+// copyFormat holds the COPY options that decide how data rows are read and
+// written.
+type copyFormat struct {
+	csv       bool
+	delimiter byte
+	// null marks NULL values, defaultMarker column defaults ("" for none).
+	null          string
+	defaultMarker string
+	quote         byte
+	escape        byte
+	// header makes the first data row a header line.
+	header bool
+	// loadData selects the backslash escapes of MySQL's LOAD DATA INFILE
+	// and SELECT ... INTO OUTFILE for the text format.
+	loadData bool
+}
+
+// textCopyFormat is the format pg_dump writes.
+var textCopyFormat = copyFormat{delimiter: '\t', null: `\N`}
+
+// loadDataFormat is the format mysqldump --tab writes its .txt files in.
+var loadDataFormat = copyFormat{delimiter: '\t', null: `\N`, loadData: true}
+
+// parseCopyOptions reads the options after FROM stdin, in the option list
+// syntax "[WITH] (FORMAT csv, DELIMITER ';', ...)" or the pre-9.0 syntax
+// "[WITH] CSV DELIMITER [AS] ';' ...".
+func parseCopyOptions(text string) (copyFormat, error) {
+	tokens, err := copyOptionTokens(text)
+	if err != nil {
+		return textCopyFormat, err
+	}
+	if len(tokens) > 0 && tokens[0].is("with") {
+		tokens = tokens[1:]
+	}
+	options := make(map[string]string)
+	if len(tokens) > 0 && tokens[0].is("(") {
+		err = parseCopyOptionList(tokens, options)
+	} else {
+		err = parseLegacyCopyOptions(tokens, options)
+	}
+	if err != nil {
+		return textCopyFormat, err
+	}
+	return newCopyFormat(options)
+}
+
+// parseCopyOptionList reads "(name [value], ...)". Values that are column
+// lists are skipped.
+func parseCopyOptionList(tokens []copyToken, options map[string]string) error {
+	for i := 1; i < len(tokens); {
+		name := strings.ToLower(tokens[i].text)
+		i++
+		value := "true"
+		switch {
+		case i < len(tokens) && tokens[i].is("("):
+			for i < len(tokens) && !tokens[i].is(")") {
+				i++
+			}
+			i++
+		case i < len(tokens) && !tokens[i].is(",") && !tokens[i].is(")"):
+			value = tokens[i].text
+			i++
+		}
+		options[name] = value
+		switch {
+		case i >= len(tokens):
+		case tokens[i].is(")") && i == len(tokens)-1:
+			return nil
+		case tokens[i].is(","):
+			i++
+			continue
+		default:
+			return fmt.Errorf("unexpected %q in the COPY option list", tokens[i].text)
+		}
+	}
+	return fmt.Errorf("unterminated COPY option list")
+}
+
+// parseLegacyCopyOptions reads the keyword options of the pre-9.0 COPY
+// syntax.
+func parseLegacyCopyOptions(tokens []copyToken, options map[string]string) error {
+	for i := 0; i < len(tokens); {
+		keyword := strings.ToLower(tokens[i].text)
+		i++
+		switch keyword {
+		case "binary", "csv":
+			options["format"] = keyword
+		case "header":
+			options["header"] = "true"
+		case "delimiter", "null", "quote", "escape", "encoding":
+			if i < len(tokens) && tokens[i].is("as") {
+				i++
+			}
+			if i >= len(tokens) {
+				return fmt.Errorf("missing value of COPY option %s", keyword)
+			}
+			options[keyword] = tokens[i].text
+			i++
+		case "force":
+			// FORCE NOT NULL / FORCE QUOTE column lists do not change
+			// how values are delimited.
+			for i < len(tokens) && (tokens[i].is("not") || tokens[i].is("null") || tokens[i].is("quote")) {
+				i++
+			}
+			for i++; i < len(tokens) && tokens[i].is(","); i += 2 {
+			}
+		default:
+			return fmt.Errorf("unsupported COPY option %s", tokens[i-1].text)
+		}
+	}
+	return nil
+}
+
+// newCopyFormat applies parsed options to the defaults of their format.
+func newCopyFormat(options map[string]string) (copyFormat, error) {
+	f := textCopyFormat
+	switch strings.ToLower(options["format"]) {
+	case "", "text":
+	case "csv":
+		f = copyFormat{csv: true, delimiter: ',', quote: '"', escape: '"'}
+	case "binary":
+		return textCopyFormat, fmt.Errorf("binary COPY data is not supported")
+	default:
+		return textCopyFormat, fmt.Errorf("unknown COPY format %s", options["format"])
+	}
+
+	char := func(name string, target *byte) error {
+		value, ok := options[name]
+		if !ok {
+			return nil
+		}
+		if len(value) != 1 {
+			return fmt.Errorf("COPY %s must be a single one-byte character", name)
+		}
+		*target = value[0]
+		return nil
+	}
+	for name, value := range options {
+		switch name {
+		case "format", "encoding", "freeze", "force_not_null", "force_null", "force_quote", "on_error", "log_verbosity", "reject_limit":
+		case "delimiter":
+			if err := char(name, &f.delimiter); err != nil {
+				return textCopyFormat, err
+			}
+		case "null":
+			f.null = value
+		case "default":
+			f.defaultMarker = value
+		case "header":
+			switch strings.ToLower(value) {
+			case "true", "on", "1", "match":
+				f.header = true
+			case "false", "off", "0":
+				f.header = false
+			default:
+				return textCopyFormat, fmt.Errorf("invalid COPY header value %s", value)
+			}
+		case "quote", "escape":
+			if !f.csv {
+				return textCopyFormat, fmt.Errorf("COPY %s is only available in CSV mode", name)
+			}
+		default:
+			return textCopyFormat, fmt.Errorf("unsupported COPY option %s", name)
+		}
+	}
+	if f.csv {
+		if err := char("quote", &f.quote); err != nil {
+			return textCopyFormat, err
+		}
+		f.escape = f.quote
+		if err := char("escape", &f.escape); err != nil {
+			return textCopyFormat, err
+		}
+	}
+	if f.delimiter == '\r' || f.delimiter == '\n' || (!f.csv && f.delimiter == '\\') || (f.csv && f.delimiter == f.quote) {
+		return textCopyFormat, fmt.Errorf("invalid COPY delimiter %q", f.delimiter)
+	}
+	return f, nil
+}
+
+// copyToken is a word, a punctuation character or, with literal set, the
+// value of a string literal.
+type copyToken struct {
+	text    string
+	literal bool
+}
+
+// is reports whether the token is the keyword or punctuation s.
+func (t copyToken) is(s string) bool {
+	return !t.literal && strings.EqualFold(t.text, s)
+}
+
+// copyOptionTokens splits COPY options into tokens.
+func copyOptionTokens(text string) ([]copyToken, error) {
+	var tokens []copyToken
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '*':
+			tokens = append(tokens, copyToken{text: string(c)})
+			i++
+		case c == '\'' || ((c == 'E' || c == 'e') && i+1 < len(text) && text[i+1] == '\''):
+			value, end, err := copyOptionString(text, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, copyToken{text: value, literal: true})
+			i = end
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted identifier")
+			}
+			tokens = append(tokens, copyToken{text: text[i+1 : i+1+end], literal: true})
+			i += end + 2
+		default:
+			start := i
+			for i < len(text) && !strings.ContainsRune(" \t\r\n(),*'\"", rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, copyToken{text: text[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// copyOptionString reads the string literal at text[start:]: '...' with
+// doubled quotes or E'...' with backslash escapes.
+func copyOptionString(text string, start int) (string, int, error) {
+	escapes := text[start] != '\''
+	if escapes {
+		start++
+	}
+	var value strings.Builder
+	for i := start + 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			value.WriteByte('\'')
+			i++
+		case c == '\'':
+			return value.String(), i + 1, nil
+		case c == '\\' && escapes && i+1 < len(text):
+			i++
+			switch text[i] {
+			case 't':
+				value.WriteByte('\t')
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 'b':
+				value.WriteByte('\b')
+			case 'f':
+				value.WriteByte('\f')
+			default:
+				value.WriteByte(text[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string literal")
+}
+
+// copyField is one value of a COPY data row.
+type copyField struct {
+	// raw is the value as written in the row, quotes and escapes included.
+	raw    string
+	quoted bool
+	null   bool
+}
+
+// split cuts a data row (without its line break) into fields. The raw
+// fields joined with the delimiter give the row back.
+func (f copyFormat) split(row string) []copyField {
+	var fields []copyField
+	start, quoted, inQuotes := 0, false, false
+	for i := 0; i < len(row); i++ {
+		c := row[i]
+		switch {
+		case !f.csv && c == '\\':
+			i++ // the escaped character is never a delimiter
+		case f.csv && inQuotes && c == f.escape && f.escape != f.quote && i+1 < len(row) && (row[i+1] == f.quote || row[i+1] == f.escape):
+			i++
+		case f.csv && c == f.quote:
+			inQuotes = !inQuotes
+			quoted = true
+		case c == f.delimiter && !inQuotes:
+			fields = append(fields, f.field(row[start:i], quoted))
+			start, quoted = i+1, false
+		}
+	}
+	return append(fields, f.field(row[start:], quoted))
+}
+
+func (f copyFormat) field(raw string, quoted bool) copyField {
+	// A quoted CSV value is never NULL, whatever it holds.
+	null := !quoted && (raw == f.null || (f.defaultMarker != "" && raw == f.defaultMarker))
+	return copyField{raw: raw, quoted: quoted, null: null}
+}
+
+// join writes fields back into a data row.
+func (f copyFormat) join(fields []copyField) string {
+	var row strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			row.WriteByte(f.delimiter)
+		}
+		row.WriteString(field.raw)
+	}
+	return row.String()
+}
+
+// decode returns the value a raw field stands for.
+func (f copyFormat) decode(raw string) string {
+	if f.csv {
+		return f.decodeCSV(raw)
+	}
+	if !strings.Contains(raw, `\`) {
+		return raw
+	}
+	if f.loadData {
+		return decodeLoadData(raw)
+	}
+	var value strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 == len(raw) {
+			value.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = raw[i]; {
+		case c >= '0' && c <= '7':
+			n := int(c - '0')
+			for k := 0; k < 2 && i+1 < len(raw) && raw[i+1] >= '0' && raw[i+1] <= '7'; k++ {
+				i++
+				n = n*8 + int(raw[i]-'0')
+			}
+			value.WriteByte(byte(n))
+		case c == 'x' && i+1 < len(raw) && isHexDigit(raw[i+1]):
+			n := 0
+			for k := 0; k < 2 && i+1 < len(raw) && isHexDigit(raw[i+1]); k++ {
+				i++
+				n = n*16 + hexValue(raw[i])
+			}
+			value.WriteByte(byte(n))
+		case c == 'b':
+			value.WriteByte('\b')
+		case c == 'f':
+			value.WriteByte('\f')
+		case c == 'n':
+			value.WriteByte('\n')
+		case c == 'r':
+			value.WriteByte('\r')
+		case c == 't':
+			value.WriteByte('\t')
+		case c == 'v':
+			value.WriteByte('\v')
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return value.String()
+}
+
+// decodeLoadData decodes the escapes of LOAD DATA INFILE: \0, \b, \n, \r,
+// \t and \Z; any other escaped character stands for itself.
+func decodeLoadData(raw string) string {
+	var value strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 == len(raw) {
+			value.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = raw[i]; c {
+		case '0':
+			value.WriteByte(0)
+		case 'b':
+			value.WriteByte('\b')
+		case 'n':
+			value.WriteByte('\n')
+		case 'r':
+			value.WriteByte('\r')
+		case 't':
+			value.WriteByte('\t')
+		case 'Z':
+			value.WriteByte(0x1a)
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return value.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= 'a':
+		return int(c-'a') + 10
+	case c >= 'A':
+		return int(c-'A') + 10
+	}
+	return int(c - '0')
+}
+
+func (f copyFormat) decodeCSV(raw string) string {
+	if strings.IndexByte(raw, f.quote) < 0 {
+		return raw
+	}
+	var value strings.Builder
+	inQuotes := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case inQuotes && c == f.escape && i+1 < len(raw) && (raw[i+1] == f.quote || raw[i+1] == f.escape):
+			i++
+			value.WriteByte(raw[i])
+		case c == f.quote:
+			inQuotes = !inQuotes
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return value.String()
+}
+
+// encode writes a value the way COPY TO would. CSV values are quoted when
+// quoted is set or the value needs it.
+func (f copyFormat) encode(value string, quoted bool) string {
+	if f.csv {
+		return f.encodeCSV(value, quoted)
+	}
+	if f.loadData {
+		return f.encodeLoadData(value)
+	}
+	var raw strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '\b':
+			raw.WriteString(`\b`)
+		case '\f':
+			raw.WriteString(`\f`)
+		case '\n':
+			raw.WriteString(`\n`)
+		case '\r':
+			raw.WriteString(`\r`)
+		case '\t':
+			raw.WriteString(`\t`)
+		case '\v':
+			raw.WriteString(`\v`)
+		case '\\':
+			raw.WriteString(`\\`)
+		default:
+			if c == f.delimiter {
+				raw.WriteByte('\\')
+			}
+			raw.WriteByte(c)
+		}
+	}
+	return raw.String()
+}
+
+// encodeLoadData escapes a value the way SELECT ... INTO OUTFILE does: NUL
+// as \0, and the backslash, delimiter and line break behind a backslash.
+func (f copyFormat) encodeLoadData(value string) string {
+	var raw strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == 0:
+			raw.WriteString(`\0`)
+		case c == '\\' || c == '\n' || c == f.delimiter:
+			raw.WriteByte('\\')
+			raw.WriteByte(c)
+		default:
+			raw.WriteByte(c)
+		}
+	}
+	return raw.String()
+}
+
+func (f copyFormat) encodeCSV(value string, quoted bool) string {
+	if !quoted {
+		quoted = value == f.null || value == pgCopyTerminator ||
+			strings.IndexByte(value, f.delimiter) >= 0 || strings.IndexByte(value, f.quote) >= 0 ||
+			strings.ContainsAny(value, "\r\n")
+	}
+	if !quoted {
+		return value
+	}
+	var raw strings.Builder
+	raw.WriteByte(f.quote)
+	for i := 0; i < len(value); i++ {
+		if value[i] == f.quote || value[i] == f.escape {
+			raw.WriteByte(f.escape)
+		}
+		raw.WriteByte(value[i])
+	}
+	raw.WriteByte(f.quote)
+	return raw.String()
+}
+
+// values returns the decoded values of a data row, NULL as `\N`.
+func (f copyFormat) values(row string) []string {
+	fields := f.split(row)
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		if field.null {
+			values[i] = `\N`
+			continue
+		}
+		values[i] = f.decode(field.raw)
+	}
+	return values
+}
+
+// inQuotes reports whether a CSV quoted value is still open after s, given
+// whether it was open before.
+func (f copyFormat) inQuotes(s string, open bool) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case open && c == f.escape && f.escape != f.quote && i+1 < len(s) && (s[i+1] == f.quote || s[i+1] == f.escape):
+			i++
+		case c == f.quote:
+			open = !open
+		}
+	}
+	return open
+}
+
+// copyRowCollector joins the lines of CSV data rows whose quoted values span
+// line breaks, and of LOAD DATA rows whose line breaks are escaped with a
+// backslash. PostgreSQL text format rows are always one line.
+type copyRowCollector struct {
+	format  copyFormat
+	open    bool
+	pending strings.Builder
+}
+
+// collect returns the data row once line completes it, or ok=false while
+// a quoted value is still open.
+func (c *copyRowCollector) collect(rt *Runtime, line string) (string, bool) {
+	switch {
+	case c.format.csv:
+		c.open = c.format.inQuotes(line, c.open)
+	case c.format.loadData:
+		c.open = endsEscaped(strings.TrimSuffix(line, "\n"))
+	default:
+		return line, true
+	}
+	if c.pending.Len() == 0 && !c.open {
+		return line, true
+	}
+	c.pending.WriteString(line)
+	if c.open {
+		if c.pending.Len() < maxPendingStatementSize {
+			return "", false
+		}
+		rt.reportUnmasked("%s value exceeds %d bytes without closing: the open row passes through unmasked", c.kind(), maxPendingStatementSize)
+		c.open = false
+	}
+	row := c.pending.String()
+	c.pending.Reset()
+	return row, true
+}
+
+// takePending returns the lines still held at end of input.
+func (c *copyRowCollector) takePending(rt *Runtime) string {
+	if c.pending.Len() == 0 {
+		return ""
+	}
+	rt.reportUnmasked("input ended inside a %s value: the open row passes through unmasked", c.kind())
+	pending := c.pending.String()
+	c.pending.Reset()
+	c.open = false
+	return pending
+}
+
+func (c *copyRowCollector) kind() string {
+	if c.format.loadData {
+		return "LOAD DATA"
+	}
+	return "CSV"
+}
+
+// endsEscaped reports whether s ends with an odd number of backslashes, so
+// that the line break after it belongs to the value.
+func endsEscaped(s string) bool {
+	n := 0
+	for n < len(s) && s[len(s)-1-n] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
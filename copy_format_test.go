@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCopyStatementOptions(t *testing.T) {
+	csv := copyFormat{csv: true, delimiter: ',', quote: '"', escape: '"'}
+	for _, tt := range []struct {
+		stmt   string
+		table  string
+		format copyFormat
+		ok     bool
+	}{
+		{"COPY public.users (id, email) FROM stdin;", "public.users", textCopyFormat, true},
+		{"copy users from stdin ;", "users", textCopyFormat, true},
+		{"COPY users (id) FROM stdin WITH (FORMAT csv);", "users", csv, true},
+		{"COPY users (id) FROM stdin (FORMAT 'csv', DELIMITER ';', HEADER, NULL 'NULL', QUOTE '''', ESCAPE '\\');", "users",
+			copyFormat{csv: true, delimiter: ';', null: "NULL", quote: '\'', escape: '\\', header: true}, true},
+		{"COPY users (id) FROM stdin WITH (DELIMITER ',', FORMAT csv, FORCE_NOT_NULL (id, email), HEADER false);", "users",
+			csv, true},
+		{"COPY users (id) FROM stdin (DELIMITER E'\\t', NULL '', DEFAULT '\\D');", "users",
+			copyFormat{delimiter: '\t', defaultMarker: `\D`}, true},
+		{"COPY users (id) FROM stdin WITH DELIMITER AS '|' NULL AS 'nil';", "users",
+			copyFormat{delimiter: '|', null: "nil"}, true},
+		{"COPY users (id) FROM stdin CSV HEADER QUOTE AS '\"' FORCE NOT NULL id, email;", "users",
+			copyFormat{csv: true, delimiter: ',', quote: '"', escape: '"', header: true}, true},
+		{"COPY users (id) FROM stdin WITH (FORMAT binary);", "users", textCopyFormat, false},
+		{"COPY users (id) FROM stdin WITH (DELIMITER ';;');", "users", textCopyFormat, false},
+		{"COPY users (id) FROM stdin WITH (QUOTE '\"');", "users", textCopyFormat, false},
+		{"COPY users (id) FROM stdin WITH (FORMAT csv, SHOUT true);", "users", textCopyFormat, false},
+		{"COPY users (id) FROM stdin WITH (FORMAT csv;", "users", textCopyFormat, false},
+	} {
+		stmt, ok := parseCopyStatement(tt.stmt)
+		if !ok {
+			t.Fatalf("%q: not recognized as COPY", tt.stmt)
+		}
+		if stmt.table != tt.table || (stmt.err == nil) != tt.ok || stmt.format != tt.format {
+			t.Fatalf("%q: got table %q, format %+v, err %v", tt.stmt, stmt.table, stmt.format, stmt.err)
+		}
+	}
+
+	for _, stmt := range []string{"COPY users TO stdout;", "COPY users (id) FROM '/tmp/users.csv';"} {
+		if _, ok := parseCopyStatement(stmt); ok {
+			t.Fatalf("%q: unexpectedly recognized", stmt)
+		}
+	}
+	if stmt, _ := parseCopyStatement("COPY users FROM stdin;"); stmt.hasColumns {
+		t.Fatal("expected a COPY without column list")
+	}
+}
+
+func TestCopyFormatDecodesAndEncodes(t *testing.T) {
+	text := textCopyFormat
+	fields := text.split(`1` + "\t" + `a\tb\\c\x41\101\n` + "\t" + `\N` + "\t")
+	if len(fields) != 4 || !fields[2].null || fields[3].null || fields[3].raw != "" {
+		t.Fatalf("unexpected text fields: %+v", fields)
+	}
+	if value := text.decode(fields[1].raw); value != "a\tb\\cAA\n" {
+		t.Fatalf("unexpected decoded value %q", value)
+	}
+	if raw := text.encode("a\tb\\c|\r", false); raw != `a\tb\\c|\r` {
+		t.Fatalf("unexpected encoded value %q", raw)
+	}
+	pipe := copyFormat{delimiter: '|', null: `\N`}
+	if got := pipe.split(`a\|b|c`); len(got) != 2 || pipe.decode(got[0].raw) != "a|b" || pipe.encode("a|b", false) != `a\|b` {
+		t.Fatalf("unexpected escaped delimiter handling: %+v", got)
+	}
+
+	csv := copyFormat{csv: true, delimiter: ';', quote: '"', escape: '"'}
+	fields = csv.split(`1;"a;""b""";;"";x"y"z`)
+	if len(fields) != 5 || !fields[2].null || fields[3].null || !fields[1].quoted {
+		t.Fatalf("unexpected CSV fields: %+v", fields)
+	}
+	if got := []string{csv.decode(fields[1].raw), csv.decode(fields[4].raw)}; !reflect.DeepEqual(got, []string{`a;"b"`, "xyz"}) {
+		t.Fatalf("unexpected decoded CSV values %q", got)
+	}
+	for value, want := range map[string]string{"plain": "plain", "a;b": `"a;b"`, `say "hi"`: `"say ""hi"""`, "": `""`, "two\nlines": "\"two\nlines\""} {
+		if raw := csv.encode(value, false); raw != want {
+			t.Fatalf("encode(%q) = %q, want %q", value, raw, want)
+		}
+	}
+	if raw := csv.encode("plain", true); raw != `"plain"` {
+		t.Fatalf("expected a quoted value to stay quoted, got %q", raw)
+	}
+	backslash := copyFormat{csv: true, delimiter: ',', quote: '"', escape: '\\'}
+	if fields := backslash.split(`"a\"b,c",d`); len(fields) != 2 || backslash.decode(fields[0].raw) != `a"b,c` || backslash.encode(`a"b\`, false) != `"a\"b\\"` {
+		t.Fatalf("unexpected backslash escape handling: %+v", fields)
+	}
+
+	load := loadDataFormat
+	fields = load.split("1\t" + `a\\b\0\Z\x` + "\\\tc\\\nd\t" + `\N`)
+	if len(fields) != 3 || !fields[2].null || load.decode(fields[1].raw) != "a\\b\x00\x1ax\tc\nd" {
+		t.Fatalf("unexpected LOAD DATA fields: %+v", fields)
+	}
+	if raw := load.encode("a\\b\x00\tc\nd\r", false); raw != "a\\\\b\\0\\\tc\\\nd\r" {
+		t.Fatalf("unexpected encoded LOAD DATA value %q", raw)
+	}
+
+	var rows copyRowCollector
+	rows.format = loadDataFormat
+	if _, ok := rows.collect(nil, "1\tfirst\\\n"); ok {
+		t.Fatal("expected a row with an escaped line break held")
+	}
+	if row, ok := rows.collect(nil, "second\\\\\n"); !ok || row != "1\tfirst\\\nsecond\\\\\n" {
+		t.Fatalf("expected the joined row, got %q", row)
+	}
+
+	rows = copyRowCollector{}
+	rows.format = csv
+	if _, ok := rows.collect(nil, "1;\"first\n"); ok {
+		t.Fatal("expected an open quoted value held")
+	}
+	if row, ok := rows.collect(nil, "second\";x\n"); !ok || row != "1;\"first\nsecond\";x\n" {
+		t.Fatalf("expected the joined row, got %q", row)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// configCoverage records which masking_tables entries matched the dump. A
+// table counts as seen when a data statement (INSERT or COPY) referenced it;
+// a column counts as resolved when it was found in a column list of that
+// table. Entries that never match usually are typos, and their data ships
+// unmasked.
+type configCoverage struct {
+	mu      sync.Mutex
+	tables  map[string]struct{}
+	columns map[string]map[string]struct{}
+}
+
+func newConfigCoverage() *configCoverage {
+	return &configCoverage{
+		tables:  make(map[string]struct{}),
+		columns: make(map[string]map[string]struct{}),
+	}
+}
+
+// markTable records a masking_tables key as seen. A nil coverage ignores
+// the call.
+func (c *configCoverage) markTable(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[key] = struct{}{}
+}
+
+// markColumn records a configured column of a masking_tables key as
+// resolved.
+func (c *configCoverage) markColumn(key, column string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.columns[key] == nil {
+		c.columns[key] = make(map[string]struct{})
+	}
+	c.columns[key][column] = struct{}{}
+}
+
+// unmatched describes every configured table never seen and every
+// configured column never resolved, sorted by table.
+func (c *configCoverage) unmatched(tables map[string]TableConfig) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(tables))
+	for key := range tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		if _, ok := c.tables[key]; !ok {
+			problems = append(problems, fmt.Sprintf("masking_tables.%s: table never seen in the dump data", key))
+			continue
+		}
+		cfg := tables[key]
+		for _, typeName := range cfg.typeNames() {
+			for _, column := range cfg.columnsFor(typeName) {
+				if _, ok := c.columns[key][column]; !ok {
+					problems = append(problems, fmt.Sprintf("masking_tables.%s: %s column %q never resolved to a position", key, typeName, column))
+				}
+			}
+		}
+		for _, column := range cfg.documentColumns() {
+			if _, ok := c.columns[key][column]; !ok {
+				kind := "php"
+				if _, ok := cfg.JSON[column]; ok {
+					kind = "json"
+				}
+				problems = append(problems, fmt.Sprintf("masking_tables.%s: %s column %q never resolved to a position", key, kind, column))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// EmailTypeName is the registry name of the built-in email type.
+	EmailTypeName = "email"
+	// PhoneTypeName is the registry name of the built-in phone type.
+	PhoneTypeName = "phone"
+
+	algorithmLightHash = "light-hash"
+	algorithmLightMask = "light-mask"
+)
+
+// DataTypeConfig declares a custom PII type in the data_types config section.
+type DataTypeConfig struct {
+	Regex     string      `json:"regex"`
+	Algorithm string      `json:"algorithm"`
+	Masking   MaskingRule `json:"masking"`
+	WhiteList string      `json:"white_list"`
+}
+
+// DataType is one registered kind of PII: how values are detected and how
+// they are masked. Email and phone are built in; further types come from the
+// data_types config section.
+type DataType struct {
+	Name string
+	// Regex finds values of this type inside a line or a column value.
+	Regex *regexp.Regexp
+	// Algorithm is light-hash (characters from an MD5 hex digest) or
+	// light-mask (digits only, formatting preserved).
+	Algorithm string
+	Rule      MaskingRule
+	WhiteList map[string]struct{}
+}
+
+// hashFamily maps the type's algorithm to the hash source used by
+// applyMasking.
+func (dt *DataType) hashFamily() TypeMaskingInfo {
+	if dt.Algorithm == algorithmLightMask {
+		return Phone
+	}
+	return Email
+}
+
+// TableConfig stores table field names to be masked per data type. The JSON
+// form is an object keyed by data type name; "email" and "phone" fill the
+// dedicated fields, any other registered type goes to Types. A key holding
+// an object instead of a list names a column of structured documents:
+// {"json": {path: type}} masks the values at the JSON paths inside it,
+// {"php": [types]} the strings of PHP serialize() data.
+type TableConfig struct {
+	Email []string `json:"email"`
+	Phone []string `json:"phone"`
+	// Types maps custom data type names to column names.
+	Types map[string][]string `json:"-"`
+	// JSON maps JSON column names to the data type of each JSON path.
+	JSON map[string]map[string]string `json:"-"`
+	// PHP maps columns of PHP serialize() data to the data types masked in
+	// their strings.
+	PHP map[string][]string `json:"-"`
+}
+
+// documentColumnConfig is the object form of a masking_tables key. Exactly
+// one field is set.
+type documentColumnConfig struct {
+	JSON map[string]string `json:"json,omitempty"`
+	PHP  []string          `json:"php,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (tc *TableConfig) UnmarshalJSON(data []byte) error {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	*tc = TableConfig{}
+	for name, entry := range entries {
+		if trimmed := bytes.TrimSpace(entry); len(trimmed) > 0 && trimmed[0] == '{' {
+			var column documentColumnConfig
+			dec := json.NewDecoder(bytes.NewReader(trimmed))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&column); err != nil || (len(column.JSON) == 0) == (len(column.PHP) == 0) {
+				return fmt.Errorf("column %q: expected {\"json\": {\"<path>\": \"<data type>\"}} or {\"php\": [\"<data type>\", ...]}", name)
+			}
+			if len(column.JSON) > 0 {
+				if tc.JSON == nil {
+					tc.JSON = make(map[string]map[string]string)
+				}
+				tc.JSON[name] = column.JSON
+				continue
+			}
+			if tc.PHP == nil {
+				tc.PHP = make(map[string][]string)
+			}
+			tc.PHP[name] = column.PHP
+			continue
+		}
+		var columns []string
+		if err := json.Unmarshal(entry, &columns); err != nil {
+			return fmt.Errorf("%q: expected a list of column names or a column object", name)
+		}
+		switch name {
+		case EmailTypeName:
+			tc.Email = columns
+		case PhoneTypeName:
+			tc.Phone = columns
+		default:
+			if tc.Types == nil {
+				tc.Types = make(map[string][]string)
+			}
+			tc.Types[name] = columns
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (tc TableConfig) MarshalJSON() ([]byte, error) {
+	raw := make(map[string]any, len(tc.Types)+len(tc.JSON)+len(tc.PHP)+2)
+	if len(tc.Email) > 0 {
+		raw[EmailTypeName] = tc.Email
+	}
+	if len(tc.Phone) > 0 {
+		raw[PhoneTypeName] = tc.Phone
+	}
+	for name, columns := range tc.Types {
+		raw[name] = columns
+	}
+	for column, paths := range tc.JSON {
+		raw[column] = documentColumnConfig{JSON: paths}
+	}
+	for column, types := range tc.PHP {
+		raw[column] = documentColumnConfig{PHP: types}
+	}
+	return json.Marshal(raw)
+}
+
+// columnsFor returns the configured column names for a data type.
+func (tc TableConfig) columnsFor(typeName string) []string {
+	switch typeName {
+	case EmailTypeName:
+		return tc.Email
+	case PhoneTypeName:
+		return tc.Phone
+	default:
+		return tc.Types[typeName]
+	}
+}
+
+// typeNames lists every data type referenced by the table config.
+func (tc TableConfig) typeNames() []string {
+	var names []string
+	if len(tc.Email) > 0 {
+		names = append(names, EmailTypeName)
+	}
+	if len(tc.Phone) > 0 {
+		names = append(names, PhoneTypeName)
+	}
+	for name := range tc.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// documentColumns lists the JSON and PHP serialize() columns, sorted.
+func (tc TableConfig) documentColumns() []string {
+	names := make([]string, 0, len(tc.JSON)+len(tc.PHP))
+	for name := range tc.JSON {
+		names = append(names, name)
+	}
+	for name := range tc.PHP {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadDataTypes compiles the data_types config section.
+func loadDataTypes(configs map[string]DataTypeConfig) (map[string]*DataType, error) {
+	types := make(map[string]*DataType, len(configs))
+	for name, cfg := range configs {
+		if name == "" {
+			return nil, fmt.Errorf("data type name must not be empty")
+		}
+		if name == EmailTypeName || name == PhoneTypeName {
+			return nil, fmt.Errorf("data type %q is built in and cannot be redefined; use email_regex/phone_regex and masking instead", name)
+		}
+		if cfg.Regex == "" {
+			return nil, fmt.Errorf("data type %q: regex is required", name)
+		}
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("data type %q: invalid regex: %v", name, err)
+		}
+		switch cfg.Algorithm {
+		case algorithmLightHash, algorithmLightMask:
+		default:
+			return nil, fmt.Errorf("data type %q: unsupported algorithm %q (expected light-hash|light-mask)", name, cfg.Algorithm)
+		}
+		if cfg.Masking.Target == "" || cfg.Masking.Value == "" {
+			return nil, fmt.Errorf("data type %q: masking target and value are required", name)
+		}
+		if cfg.WhiteList != "" {
+			if err := checkFileAccess(cfg.WhiteList, false); err != nil {
+				return nil, fmt.Errorf("data type %q white list error: %v", name, err)
+			}
+		}
+		whiteList, err := LoadWhiteList(cfg.WhiteList)
+		if err != nil {
+			return nil, fmt.Errorf("data type %q: failed to load white list: %v", name, err)
+		}
+		types[name] = &DataType{
+			Name:      name,
+			Regex:     regex,
+			Algorithm: cfg.Algorithm,
+			Rule:      cfg.Masking,
+			WhiteList: whiteList,
+		}
+	}
+	return types, nil
+}
+
+// validateTableTypes rejects masking_tables entries that reference data
+// types nobody registered or invalid JSON paths: such columns would
+// silently stay unmasked.
+func validateTableTypes(tables map[string]TableConfig, custom map[string]*DataType) error {
+	known := func(name string) bool {
+		_, ok := custom[name]
+		return ok || name == EmailTypeName || name == PhoneTypeName
+	}
+	for table, cfg := range tables {
+		for name := range cfg.Types {
+			if _, ok := custom[name]; !ok {
+				return fmt.Errorf("masking_tables.%s references unknown data type %q", table, name)
+			}
+		}
+		for column, paths := range cfg.JSON {
+			for path, name := range paths {
+				if !known(name) {
+					return fmt.Errorf("masking_tables.%s.%s references unknown data type %q", table, column, name)
+				}
+				if _, err := parseJSONPath(path); err != nil {
+					return fmt.Errorf("masking_tables.%s.%s: invalid JSON path %q: %v", table, column, path, err)
+				}
+			}
+		}
+		for column, names := range cfg.PHP {
+			for _, name := range names {
+				if !known(name) {
+					return fmt.Errorf("masking_tables.%s.%s references unknown data type %q", table, column, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// buildTypeRegistry returns the ordered registry: email, phone, then custom
+// types sorted by name. The order decides which type masks a value first
+// when several types are configured for one column.
+func buildTypeRegistry(rt *Runtime, custom map[string]*DataType) []*DataType {
+	registry := []*DataType{
+		{
+			Name:      EmailTypeName,
+			Regex:     rt.EmailRegex,
+			Algorithm: algorithmLightHash,
+			Rule:      rt.Config.Masking.Email,
+			WhiteList: rt.EmailWhiteList,
+		},
+		{
+			Name:      PhoneTypeName,
+			Regex:     rt.PhoneRegex,
+			Algorithm: algorithmLightMask,
+			Rule:      rt.Config.Masking.Phone,
+			WhiteList: rt.PhoneWhiteList,
+		},
+	}
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		registry = append(registry, custom[name])
+	}
+	return registry
+}
+
+// activeTypes returns the registered types enabled for this run. Email and
+// phone follow the --mask-email/--mask-phone flags; custom types carry their
+// algorithm in the config and are always active.
+func (r *Runtime) activeTypes(config MaskConfig) []*DataType {
+	active := make([]*DataType, 0, len(r.DataTypes))
+	for _, dt := range r.DataTypes {
+		if dt.Regex == nil {
+			continue
+		}
+		switch dt.Name {
+		case EmailTypeName:
+			if config.emailAlgorithm == "" {
+				continue
+			}
+		case PhoneTypeName:
+			if config.phoneAlgorithm == "" {
+				continue
+			}
+		}
+		active = append(active, dt)
+	}
+	return active
+}
+
+// MaskValue masks one value of the given data type.
+func (r *Runtime) MaskValue(dt *DataType, value string, cache *Cache) string {
+	masked, _ := r.maskValue(dt, value, cache)
+	return masked
+}
+
+// maskValue is MaskValue that also reports how the value was treated.
+func (r *Runtime) maskValue(dt *DataType, value string, cache *Cache) (string, maskOutcome) {
+	switch dt.Name {
+	case EmailTypeName:
+		return r.maskEmail(value, cache)
+	case PhoneTypeName:
+		return r.maskPhone(value, cache)
+	}
+
+	if _, ok := dt.WhiteList[value]; ok {
+		return value, outcomeWhiteListed
+	}
+	if masked, ok := cache.lookup(dt.Name, value); ok && cache.claim(dt.Name, value, masked) {
+		return masked, outcomeCacheHit
+	}
+
+	var masked string
+	if dt.Algorithm == algorithmLightMask {
+		masked = maskDigits(value, dt.Rule, dt.hashFamily(), r.HashKey)
+	} else if strings.HasPrefix(dt.Rule.Target, "username:") || strings.HasPrefix(dt.Rule.Target, "domain:") {
+		masked = maskEmailValue(value, dt.Rule, r.HashKey)
+	} else {
+		masked = applyKeyedMasking(value, parseTargetPositions(dt.Rule.Target, len(value)), dt.Rule.Value, dt.hashFamily(), r.HashKey)
+	}
+
+	return r.remember(dt.Name, value, masked, cache)
+}
+
+// maskMatches replaces every regex match of the data type inside s and
+// counts the outcomes in stats (which may be nil).
+func (r *Runtime) maskMatches(dt *DataType, s string, cache *Cache, stats *tableStats) string {
+	return dt.Regex.ReplaceAllStringFunc(s, func(match string) string {
+		masked, outcome := r.maskValue(dt, match, cache)
+		cache.effect(func() {
+			stats.recordMask(dt.Name, outcome)
+			if masked != match {
+				r.Fingerprints.add(dt.Name, match)
+			}
+		})
+		return masked
+	})
+}
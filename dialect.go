@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -23,6 +24,12 @@ const (
 	DialectSQLite DumpDialect = "sqlite"
 	// DialectFirebird handles Firebird dumps.
 	DialectFirebird DumpDialect = "firebird"
+	// DialectCSV handles comma-separated files with a header line.
+	DialectCSV DumpDialect = "csv"
+	// DialectTSV handles tab-separated files with a header line.
+	DialectTSV DumpDialect = "tsv"
+	// DialectNDJSON handles newline-delimited JSON, one record per line.
+	DialectNDJSON DumpDialect = "ndjson"
 	// DialectGeneric is the internal fallback when no dialect-specific
 	// parsing is available: full-line regex masking only.
 	DialectGeneric DumpDialect = "generic"
@@ -45,8 +52,14 @@ func ParseDumpDialect(value string) (DumpDialect, error) {
 		return DialectSQLite, nil
 	case DialectFirebird:
 		return DialectFirebird, nil
+	case DialectCSV:
+		return DialectCSV, nil
+	case DialectTSV:
+		return DialectTSV, nil
+	case DialectNDJSON:
+		return DialectNDJSON, nil
 	default:
-		return "", fmt.Errorf("unsupported db-format %q (expected auto|mysql|postgresql|oracle|mssql|sqlite|firebird)", value)
+		return "", fmt.Errorf("unsupported db-format %q (expected auto|mysql|postgresql|oracle|mssql|sqlite|firebird|csv|tsv|ndjson)", value)
 	}
 }
 
@@ -65,7 +78,7 @@ type DialectParser interface {
 func NewDialectParser(dialect DumpDialect, rt *Runtime) DialectParser {
 	switch dialect {
 	case DialectMySQL:
-		return newMySQLDialectParser(rt)
+		return newSQLInsertDialectParser(rt, DialectMySQL)
 	case DialectPostgreSQL:
 		return newPostgresDialectParser(rt)
 	case DialectOracle:
@@ -76,6 +89,9 @@ func NewDialectParser(dialect DumpDialect, rt *Runtime) DialectParser {
 		return newSQLInsertDialectParser(rt, DialectSQLite)
 	case DialectFirebird:
 		return newSQLInsertDialectParser(rt, DialectFirebird)
+	case DialectCSV, DialectTSV, DialectNDJSON:
+		// The table is named by the caller: see newTableFileParser.
+		return newTableFileParser(rt, dialect, "")
 	case DialectAuto:
 		return newDetectingDialectParser(rt)
 	default:
@@ -100,31 +116,80 @@ func (p *genericDialectParser) Dialect() DumpDialect { return DialectGeneric }
 
 // ProcessLine implements DialectParser.
 func (p *genericDialectParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *genericDialectParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
 	if !p.warned {
 		p.warned = true
-		if (len(p.rt.SkipTableList) > 0 || len(p.rt.NoMaskTableList) > 0 || len(p.rt.ProcessingTables) > 0) && logger != nil {
-			logger.Warn("selective table filtering is disabled: dump dialect is unknown, applying full-line masking only")
+		if len(p.rt.SkipTableList) > 0 || len(p.rt.NoMaskTableList) > 0 || len(p.rt.ProcessingTables) > 0 {
+			p.rt.reportUnmasked("selective table filtering is disabled: dump dialect is unknown, applying full-line masking only")
 		}
 	}
-	return maskFullLine(p.rt, line, config, cache), false
+	return fullLineJob(p.rt, maskJob{text: line}, config, cache, p.rt.Stats.other()), false
 }
 
-// maskFullLine applies the configured regex masking to a whole line without
-// any table or field awareness.
-func maskFullLine(rt *Runtime, line string, config MaskConfig, cache *Cache) string {
-	if config.emailAlgorithm == "light-hash" && rt.EmailRegex != nil {
-		line = rt.EmailRegex.ReplaceAllStringFunc(line, func(email string) string {
-			return rt.MaskEmailWithRules(email, cache)
-		})
+// prepareFlush implements jobParser: the generic parser holds no input.
+func (p *genericDialectParser) prepareFlush(MaskConfig, *Cache) maskJob {
+	return maskJob{}
+}
+
+// filtering reports whether lines must be attributed to tables: for table
+// lists, column masking, per-table statistics or the row visitor.
+func (r *Runtime) filtering() bool {
+	return len(r.ProcessingTables) > 0 || len(r.SkipTableList) > 0 || len(r.NoMaskTableList) > 0 || r.Stats != nil || r.RowVisitor != nil
+}
+
+// collectsColumns reports whether CREATE TABLE column orders are needed:
+// for column masking or to name the values of visited rows.
+func (r *Runtime) collectsColumns() bool {
+	return len(r.ProcessingTables) > 0 || r.RowVisitor != nil
+}
+
+// reportUnmasked handles configured data that passes through without the
+// requested treatment because its layout is unknown: a warning normally, a
+// fatal error in strict mode. Only the first strict violation is kept.
+func (r *Runtime) reportUnmasked(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if !r.Strict {
+		if logger != nil {
+			logger.Warn("%s", msg)
+		}
+		return
 	}
-	if config.phoneAlgorithm == "light-mask" && rt.PhoneRegex != nil {
-		line = rt.PhoneRegex.ReplaceAllStringFunc(line, func(phone string) string {
-			return rt.MaskPhoneWithRules(phone, cache)
-		})
+	r.strictMu.Lock()
+	defer r.strictMu.Unlock()
+	if r.strictErr == nil {
+		r.strictErr = errors.New("strict mode: " + msg)
+	}
+}
+
+// StrictError returns the strict mode violation or, with --fail-on-collision,
+// the mask collision that must abort the run, if any.
+func (r *Runtime) StrictError() error {
+	r.strictMu.Lock()
+	defer r.strictMu.Unlock()
+	return r.strictErr
+}
+
+// maskFullLine applies the configured regex masking to a whole line without
+// any table or field awareness. Outcomes are counted in stats (may be nil).
+func maskFullLine(rt *Runtime, line string, config MaskConfig, cache *Cache, stats *tableStats) string {
+	for _, dt := range rt.activeTypes(config) {
+		line = rt.maskMatches(dt, line, cache, stats)
 	}
 	return line
 }
 
+// fullLineJob applies maskFullLine to the output of job.
+func fullLineJob(rt *Runtime, job maskJob, config MaskConfig, cache *Cache, stats *tableStats) maskJob {
+	return job.then(func(line string) string {
+		return maskFullLine(rt, line, config, cache, stats)
+	})
+}
+
 // normalizeIdentifier strips dialect quoting from one SQL identifier:
 // `name` (MySQL), "name" (standard), [name] (MSSQL) and surrounding spaces.
 func normalizeIdentifier(raw string) string {
@@ -170,21 +235,24 @@ func tableNameCandidates(raw string) []string {
 // lookupProcessingTable finds the masking config for a table reference,
 // accepting both schema-qualified and plain config keys. With fold the match
 // is case-insensitive (Oracle folds unquoted identifiers to upper case, so
-// dump and config casing routinely differ).
-func lookupProcessingTable(rt *Runtime, rawTable string, fold bool) (TableConfig, bool) {
+// dump and config casing routinely differ). It also returns the matched
+// config key and records the table as seen.
+func lookupProcessingTable(rt *Runtime, rawTable string, fold bool) (string, TableConfig, bool) {
 	for _, name := range tableNameCandidates(rawTable) {
 		if cfg, ok := rt.ProcessingTables[name]; ok {
-			return cfg, true
+			rt.Coverage.markTable(name)
+			return name, cfg, true
 		}
 		if fold {
 			for key, cfg := range rt.ProcessingTables {
 				if strings.EqualFold(key, name) {
-					return cfg, true
+					rt.Coverage.markTable(key)
+					return key, cfg, true
 				}
 			}
 		}
 	}
-	return TableConfig{}, false
+	return "", TableConfig{}, false
 }
 
 // tableInList reports whether a table reference matches a configured table
@@ -216,12 +284,24 @@ func isNoMaskTable(rt *Runtime, rawTable string, fold bool) bool {
 	return tableInList(rt.NoMaskTableList, rawTable, fold)
 }
 
-// fieldPositions resolves configured email/phone column names to 0-based
-// positions using an ordered column list. Unknown names are ignored. With
-// fold the column names match case-insensitively.
-func fieldPositions(tableConfig TableConfig, columns []string, config MaskConfig, fold bool) (emailPos, phonePos map[int]bool) {
-	emailPos = make(map[int]bool)
-	phonePos = make(map[int]bool)
+// columnMask is how one column is masked: by the data types matched
+// anywhere in its value, in registry order, and for a column of JSON or PHP
+// serialize() documents by the masker that parses them.
+type columnMask struct {
+	types []*DataType
+	doc   *documentColumn
+}
+
+// columnMasks maps a 0-based column position to its masking.
+type columnMasks map[int]columnMask
+
+// fieldPositions resolves configured column names of every active data type
+// to 0-based positions using an ordered column list. Unknown names are
+// ignored here and reported by the coverage summary at end of run. With fold
+// the column names match case-insensitively. tableKey is the masking_tables
+// key of tableConfig.
+func fieldPositions(rt *Runtime, tableKey string, tableConfig TableConfig, columns []string, config MaskConfig, fold bool) columnMasks {
+	masks := make(columnMasks)
 
 	key := func(name string) string {
 		if fold {
@@ -235,63 +315,60 @@ func fieldPositions(tableConfig TableConfig, columns []string, config MaskConfig
 		index[key(normalizeIdentifier(col))] = i
 	}
 
-	if config.emailAlgorithm == "light-hash" {
-		for _, name := range tableConfig.Email {
-			if i, ok := index[key(name)]; ok {
-				emailPos[i] = true
+	// Coverage counts every configured column, also of types disabled on
+	// the command line: an unresolved name is a config typo either way.
+	for _, typeName := range tableConfig.typeNames() {
+		for _, name := range tableConfig.columnsFor(typeName) {
+			if _, ok := index[key(name)]; ok {
+				rt.Coverage.markColumn(tableKey, name)
 			}
 		}
 	}
-	if config.phoneAlgorithm == "light-mask" {
-		for _, name := range tableConfig.Phone {
+	for _, name := range tableConfig.documentColumns() {
+		if _, ok := index[key(name)]; ok {
+			rt.Coverage.markColumn(tableKey, name)
+		}
+	}
+
+	active := rt.activeTypes(config)
+	for _, dt := range active {
+		for _, name := range tableConfig.columnsFor(dt.Name) {
 			if i, ok := index[key(name)]; ok {
-				phonePos[i] = true
+				mask := masks[i]
+				mask.types = append(mask.types, dt)
+				masks[i] = mask
 			}
 		}
 	}
-	return emailPos, phonePos
+	for _, name := range tableConfig.documentColumns() {
+		i, ok := index[key(name)]
+		if !ok {
+			continue
+		}
+		var doc *documentColumn
+		if paths, ok := tableConfig.JSON[name]; ok {
+			doc = newJSONColumn(name, paths, active)
+		} else {
+			doc = newPHPColumn(name, tableConfig.PHP[name], active)
+		}
+		if doc != nil {
+			mask := masks[i]
+			mask.doc = doc
+			masks[i] = mask
+		}
+	}
+	return masks
 }
 
-// maskValueAt applies email/phone masking to a single raw SQL value by its
-// column position. It returns the possibly modified value.
-func maskValueAt(rt *Runtime, value string, pos int, emailPos, phonePos map[int]bool, cache *Cache) string {
+// maskValueAt applies data type masking to a single value by its column
+// position: a raw SQL literal, or a COPY or CSV value already decoded. It
+// returns the possibly modified value.
+func maskValueAt(rt *Runtime, value string, pos int, masks columnMasks, cache *Cache, stats *tableStats) string {
 	if value == "" || value == "NULL" {
 		return value
 	}
-	if emailPos[pos] && rt.EmailRegex != nil {
-		value = rt.EmailRegex.ReplaceAllStringFunc(value, func(email string) string {
-			return rt.MaskEmailWithRules(email, cache)
-		})
-	}
-	if phonePos[pos] && rt.PhoneRegex != nil {
-		value = rt.PhoneRegex.ReplaceAllStringFunc(value, func(phone string) string {
-			return rt.MaskPhoneWithRules(phone, cache)
-		})
+	for _, dt := range masks[pos].types {
+		value = rt.maskMatches(dt, value, cache, stats)
 	}
 	return value
 }
-
-// maskTuples masks configured columns inside every (...) tuple found in s.
-func maskTuples(rt *Runtime, s string, emailPos, phonePos map[int]bool, cache *Cache) string {
-	if len(emailPos) == 0 && len(phonePos) == 0 {
-		return s
-	}
-	return tupleRegex.ReplaceAllStringFunc(s, func(tuple string) string {
-		values := parseTuple(tuple)
-		if len(values) == 0 {
-			return tuple
-		}
-		modified := false
-		for pos := range values {
-			masked := maskValueAt(rt, values[pos], pos, emailPos, phonePos, cache)
-			if masked != values[pos] {
-				values[pos] = masked
-				modified = true
-			}
-		}
-		if !modified {
-			return tuple
-		}
-		return "(" + strings.Join(values, ",") + ")"
-	})
-}
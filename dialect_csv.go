@@ -0,0 +1,117 @@
+package main
+
+import "strings"
+
+// delimitedFormats are the RFC 4180 formats of the CSV and TSV dialects:
+// values containing the delimiter, quotes or line breaks are quoted, quotes
+// inside them doubled.
+var delimitedFormats = map[DumpDialect]copyFormat{
+	DialectCSV: {csv: true, delimiter: ',', quote: '"', escape: '"'},
+	DialectTSV: {csv: true, delimiter: '\t', quote: '"', escape: '"'},
+}
+
+// delimitedParser handles a CSV or TSV file holding the rows of one table.
+// The header line names the columns, so masking_tables rules apply by
+// header name; the header itself passes through.
+type delimitedParser struct {
+	rt      *Runtime
+	dialect DumpDialect
+	table   string
+	rows    copyRowCollector
+
+	// header is set until the header line was read.
+	header bool
+	drop   bool
+	noMask bool
+	masks  columnMasks
+	stats  *tableStats
+}
+
+// newDelimitedParser returns a parser for the rows of table in a file of a
+// delimited dialect.
+func newDelimitedParser(rt *Runtime, dialect DumpDialect, table string) *delimitedParser {
+	return &delimitedParser{
+		rt:      rt,
+		dialect: dialect,
+		table:   table,
+		rows:    copyRowCollector{format: delimitedFormats[dialect]},
+		header:  true,
+		stats:   rt.Stats.table(table),
+	}
+}
+
+// Dialect implements DialectParser.
+func (p *delimitedParser) Dialect() DumpDialect { return p.dialect }
+
+// ProcessLine implements DialectParser.
+func (p *delimitedParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *delimitedParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
+	row, ok := p.rows.collect(p.rt, line)
+	if !ok {
+		return maskJob{}, true // held until the quoted value closes
+	}
+	body, newline := splitTrailingNewline(row)
+	if p.header {
+		p.header = false
+		p.readHeader(body, config)
+		return maskJob{text: row}, false
+	}
+
+	p.stats.addRows(1, p.drop, p.noMask)
+	switch {
+	case p.drop:
+		return maskJob{}, true
+	case p.noMask:
+		return maskJob{text: row}, false
+	case len(p.masks) > 0:
+		rt, format, masks, stats := p.rt, p.rows.format, p.masks, p.stats
+		return maskJob{mask: func() string {
+			return maskCopyRow(rt, body, format, masks, cache, stats) + newline
+		}}, false
+	case len(p.rt.ProcessingTables) > 0:
+		// Selective mode masks only configured fields.
+		return maskJob{text: row}, false
+	}
+	return fullLineJob(p.rt, maskJob{text: body}, config, cache, p.stats).withSuffix(newline), false
+}
+
+// readHeader decides how the rows of the table will be treated: dropped,
+// masked by the positions of the configured header names, or passed
+// through.
+func (p *delimitedParser) readHeader(body string, config MaskConfig) {
+	switch {
+	case isSkippedTable(p.rt, p.table, false):
+		p.drop = true
+		return
+	case isNoMaskTable(p.rt, p.table, false):
+		p.noMask = true
+		return
+	}
+	tableKey, tableConfig, ok := lookupProcessingTable(p.rt, p.table, false)
+	if !ok {
+		return
+	}
+	// A UTF-8 byte order mark is not part of the first name.
+	columns := p.rows.format.values(strings.TrimPrefix(body, "\ufeff"))
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+	p.masks = fieldPositions(p.rt, tableKey, tableConfig, columns, config, false)
+}
+
+// Flush implements flushableParser: it emits a row whose quoted value is
+// still open at end of input.
+func (p *delimitedParser) Flush(config MaskConfig, cache *Cache) string {
+	return p.prepareFlush(config, cache).run()
+}
+
+// prepareFlush implements jobParser: a row whose quoted value is still open
+// at end of input passes through.
+func (p *delimitedParser) prepareFlush(MaskConfig, *Cache) maskJob {
+	return maskJob{text: p.rows.takePending(p.rt)}
+}
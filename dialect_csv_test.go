@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readCSVFixture(t *testing.T) []byte {
+	t.Helper()
+
+	input, err := os.ReadFile(filepath.Join(repoRoot(t), "testdata", "csv", "tst_users_multi.csv"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return input
+}
+
+func TestDelimitedParserMasksByHeader(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"tst_users": {Email: []string{"email"}, Phone: []string{"phone"}},
+		}
+
+		input := string(readCSVFixture(t))
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		out := processDump(t, newDelimitedParser(rt, DialectCSV, "tst_users"), bothAlgorithms(), input)
+
+		lines := strings.Split(out, "\n")
+		if lines[0] != "id,login,name,email,phone,group_id" {
+			t.Fatalf("expected the header kept, got %q", lines[0])
+		}
+		// login holds emails, but is not configured.
+		for i, want := range map[int]string{
+			1: "1,ivan.petrov@yandex.ru,Иван Петров,i690245@yandex.ru,+7 (506) 405-52-34,1",
+			5: "5,erik.andersson@telia.se,Erik Andersson,ed763e6@telia.se,+46 8 123 45 67,1",
+		} {
+			if lines[i] != want {
+				t.Fatalf("line %d: expected %q, got %q", i, want, lines[i])
+			}
+		}
+		if stats := rt.Stats.Tables["tst_users"]; stats == nil || stats.RowsSeen != 5 {
+			t.Fatalf("expected 5 rows counted without the header, got %+v", stats)
+		}
+	})
+}
+
+func TestDelimitedParserQuotingAndTables(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{"users": {Email: []string{"E-Mail"}}}
+		SkipTableList = map[string]struct{}{"secrets": {}}
+
+		input := "\ufeffid\t\"E-Mail\"\tnote\r\n" +
+			"1\t\"test@example.com\"\t\"multi\r\nline\ttest@example.com\"\r\n" +
+			"2\t\tplain\r\n" +
+			"3\ttest@example.com\t\"say \"\"hi\"\"\"\r\n"
+		want := "\ufeffid\t\"E-Mail\"\tnote\r\n" +
+			"1\t\"t098f6b@example.com\"\t\"multi\r\nline\ttest@example.com\"\r\n" +
+			"2\t\tplain\r\n" +
+			"3\tt098f6b@example.com\t\"say \"\"hi\"\"\"\r\n"
+		if out := processDump(t, newDelimitedParser(newTestRuntime(), DialectTSV, "users"), bothAlgorithms(), input); out != want {
+			t.Fatalf("unexpected TSV masking:\n%q\nwant:\n%q", out, want)
+		}
+
+		secrets := "id,token\n1,test@example.com\n"
+		if out := processDump(t, newDelimitedParser(newTestRuntime(), DialectCSV, "secrets"), bothAlgorithms(), secrets); out != "id,token\n" {
+			t.Fatalf("expected only the header of a skipped table, got %q", out)
+		}
+		open := "id,E-Mail\n1,\"test@example.com\n"
+		if out := processDump(t, newDelimitedParser(newTestRuntime(), DialectCSV, "users"), bothAlgorithms(), open); out != open {
+			t.Fatalf("expected a row open at end of input passed through, got %q", out)
+		}
+	})
+}
+
+func TestCLIMasksCSV(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"tst_users": {"email": ["email"], "phone": ["phone"]}}`)
+	input := readCSVFixture(t)
+
+	stdout, stderr, err := run(input, "--db-format=csv", "--table", "tst_users")
+	if err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "\n2,(646) 555-0199,Emily Carter,e526362@yahoo.com,(673) 548-0798,2\n") {
+		t.Fatalf("expected login kept and email and phone masked, got:\n%s", stdout)
+	}
+	if _, stderr, err := run(input, "--db-format=csv"); err == nil || !strings.Contains(stderr, "name it with --table") {
+		t.Fatalf("expected --table required, got err=%v, stderr=%s", err, stderr)
+	}
+
+	inDir := filepath.Join(runtimeDir, "export")
+	writeDumpFiles(t, inDir, map[string]string{"tst_users.csv.gz": string(input), "README": "exported\n"})
+	outDir := filepath.Join(runtimeDir, "masked")
+	if _, stderr, err := run(nil, "--db-format=csv", "--input-dir", inDir, "--output", outDir); err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if users, format := readDumpFile(t, filepath.Join(outDir, "tst_users.csv.gz")); format != "gzip" || users != stdout {
+		t.Fatalf("expected the file masked like stdin, got %s %q", format, users)
+	}
+	if readme, err := os.ReadFile(filepath.Join(outDir, "README")); err != nil || string(readme) != "exported\n" {
+		t.Fatalf("expected other files copied, got %q, %v", readme, err)
+	}
+}
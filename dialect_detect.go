@@ -1,9 +1,6 @@
 package main
 
-import (
-	"regexp"
-	"strings"
-)
+import "regexp"
 
 // detectMaxBufferedLines bounds how much input the auto-detector may buffer
 // before giving up and falling back, keeping the pipeline streaming-friendly.
@@ -45,15 +42,21 @@ func (p *detectingDialectParser) Dialect() DumpDialect {
 
 // ProcessLine implements DialectParser.
 func (p *detectingDialectParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *detectingDialectParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
 	if p.delegate != nil {
-		return p.delegate.ProcessLine(line, config, cache)
+		return lineJob(p.delegate, line, config, cache)
 	}
 
 	dialect, ok := detectDialectLine(line)
 	if !ok {
 		p.buffer = append(p.buffer, line)
 		if len(p.buffer) < detectMaxBufferedLines {
-			return "", true // buffered, emitted later on flush
+			return maskJob{}, true // buffered, emitted later on flush
 		}
 		// No decisive marker within the buffer window: degrade safely to
 		// generic full-line masking.
@@ -69,21 +72,27 @@ func (p *detectingDialectParser) ProcessLine(line string, config MaskConfig, cac
 		logger.Info("detected dump dialect: %s", p.delegate.Dialect())
 	}
 	out, drop := p.flushBuffer(config, cache)
-	tail, tailDrop := p.delegate.ProcessLine(line, config, cache)
+	tail, tailDrop := lineJob(p.delegate, line, config, cache)
 	if tailDrop {
-		if out == "" {
-			return "", drop
-		}
-		return out, false
+		return out, drop
 	}
-	return out + tail, false
+	return joinJobs(out, tail), false
 }
 
-// Flush emits any input still buffered at end of stream through the generic
-// fallback (detection never became confident).
+// Flush emits any input still buffered at end of stream: the delegate's, or
+// the detection buffer through the generic fallback (detection never became
+// confident).
 func (p *detectingDialectParser) Flush(config MaskConfig, cache *Cache) string {
-	if p.delegate != nil || len(p.buffer) == 0 {
-		return ""
+	return p.prepareFlush(config, cache).run()
+}
+
+// prepareFlush implements jobParser.
+func (p *detectingDialectParser) prepareFlush(config MaskConfig, cache *Cache) maskJob {
+	if p.delegate != nil {
+		return flushJob(p.delegate, config, cache)
+	}
+	if len(p.buffer) == 0 {
+		return maskJob{}
 	}
 	if logger != nil {
 		logger.Warn("could not detect dump dialect: falling back to generic masking")
@@ -93,6 +102,21 @@ func (p *detectingDialectParser) Flush(config MaskConfig, cache *Cache) string {
 	return out
 }
 
+// streamLexer implements tupleStreamer. Before detection the line itself
+// must carry a decisive marker.
+func (p *detectingDialectParser) streamLexer(head string) (sqlLexer, bool) {
+	if p.delegate != nil {
+		if s, ok := p.delegate.(tupleStreamer); ok {
+			return s.streamLexer(head)
+		}
+		return sqlLexer{}, false
+	}
+	if dialect, ok := detectDialectLine(head); ok {
+		return newSQLLexer(dialect), true
+	}
+	return sqlLexer{}, false
+}
+
 func (p *detectingDialectParser) selectDialect(dialect DumpDialect) {
 	if dialect == DialectGeneric {
 		p.delegate = newGenericDialectParser(p.rt)
@@ -101,22 +125,17 @@ func (p *detectingDialectParser) selectDialect(dialect DumpDialect) {
 	p.delegate = NewDialectParser(dialect, p.rt)
 }
 
-// flushBuffer replays buffered lines through the chosen delegate.
-func (p *detectingDialectParser) flushBuffer(config MaskConfig, cache *Cache) (string, bool) {
-	var out strings.Builder
-	dropped := true
+// flushBuffer replays buffered lines through the chosen delegate. The drop
+// flag reports that every buffered line was dropped.
+func (p *detectingDialectParser) flushBuffer(config MaskConfig, cache *Cache) (maskJob, bool) {
+	jobs := make([]maskJob, 0, len(p.buffer))
 	for _, buffered := range p.buffer {
-		processed, drop := p.delegate.ProcessLine(buffered, config, cache)
-		if !drop {
-			out.WriteString(processed)
-			dropped = false
+		if job, drop := lineJob(p.delegate, buffered, config, cache); !drop {
+			jobs = append(jobs, job)
 		}
 	}
 	p.buffer = nil
-	if out.Len() == 0 {
-		return "", dropped
-	}
-	return out.String(), false
+	return joinJobs(jobs...), len(jobs) == 0
 }
 
 // detectDialectLine checks one line against the decisive dialect markers.
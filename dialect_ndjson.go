@@ -0,0 +1,91 @@
+package main
+
+import "strings"
+
+// ndjsonParser handles newline-delimited JSON holding the records of one
+// table, one per line. The masking_tables entry of the table lists JSON
+// paths instead of columns; without masking_tables every string value is
+// masked. Values are decoded before masking, so JSON escapes never hide or
+// break a match, and records keep their key order and formatting.
+type ndjsonParser struct {
+	rt    *Runtime
+	table string
+	stats *tableStats
+
+	// started is set once the first line decided how records are treated.
+	started  bool
+	drop     bool
+	noMask   bool
+	tableKey string
+	rules    []*jsonPathRule
+}
+
+// newNDJSONParser returns a parser for the records of table.
+func newNDJSONParser(rt *Runtime, table string) *ndjsonParser {
+	return &ndjsonParser{rt: rt, table: table, stats: rt.Stats.table(table)}
+}
+
+// Dialect implements DialectParser.
+func (p *ndjsonParser) Dialect() DumpDialect { return DialectNDJSON }
+
+// ProcessLine implements DialectParser.
+func (p *ndjsonParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *ndjsonParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
+	if !p.started {
+		p.started = true
+		p.start(config)
+	}
+	body, newline := splitTrailingNewline(line)
+	if strings.TrimSpace(body) == "" {
+		return maskJob{text: line}, false
+	}
+
+	p.stats.addRows(1, p.drop, p.noMask)
+	switch {
+	case p.drop:
+		return maskJob{}, true
+	case p.noMask, len(p.rules) == 0:
+		// Selective mode masks only configured fields.
+		return maskJob{text: line}, false
+	}
+	rt, table, tableKey, rules, stats := p.rt, p.table, p.tableKey, p.rules, p.stats
+	return maskJob{mask: func() string {
+		masked, err := maskJSON(rt, body, tableKey, rules, cache, stats)
+		if err != nil {
+			cache.effect(func() {
+				rt.reportUnmasked("record of %s is not valid JSON (%v): it passes through unmasked", table, err)
+			})
+			return body + newline
+		}
+		return masked + newline
+	}}, false
+}
+
+// start decides how the records of the table are treated: dropped, masked
+// at the configured paths, or passed through.
+func (p *ndjsonParser) start(config MaskConfig) {
+	switch {
+	case isSkippedTable(p.rt, p.table, false):
+		p.drop = true
+	case isNoMaskTable(p.rt, p.table, false):
+		p.noMask = true
+	case len(p.rt.ProcessingTables) == 0:
+		p.rules = []*jsonPathRule{{types: p.rt.activeTypes(config)}}
+	default:
+		if tableKey, tableConfig, ok := lookupProcessingTable(p.rt, p.table, false); ok {
+			p.tableKey = tableKey
+			p.rules = jsonPathRules(p.rt, tableKey, tableConfig, config)
+		}
+	}
+}
+
+// prepareFlush implements jobParser: records are single lines, so nothing
+// is held.
+func (p *ndjsonParser) prepareFlush(MaskConfig, *Cache) maskJob {
+	return maskJob{}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNDJSONParserMasksPaths(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"events": {Email: []string{"user.email"}, Phone: []string{"user.phones[*]"}},
+		}
+		SkipTableList = map[string]struct{}{"audit": {}}
+
+		input := `{"user":{"email":"test@example.com","phones":["+7 916 555-12-34"],"login":"test@example.com"},"ts":1}` + "\n" +
+			"\n" +
+			`{"user":{"email":null}}` + "\r\n" +
+			`{"user": broken` + "\n"
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		out := processDump(t, newNDJSONParser(rt, "events"), bothAlgorithms(), input)
+
+		lines := strings.SplitAfter(out, "\n")
+		if len(lines) != 5 || !strings.HasPrefix(lines[0], `{"user":{"email":"t098f6b@example.com","phones":["+7 `) ||
+			strings.Contains(lines[0], "916 555-12-34") || !strings.HasSuffix(lines[0], `"],"login":"test@example.com"},"ts":1}`+"\n") {
+			t.Fatalf("unexpected masked records %q", out)
+		}
+		if lines[1] != "\n" || lines[2] != `{"user":{"email":null}}`+"\r\n" || lines[3] != `{"user": broken`+"\n" {
+			t.Fatalf("expected other lines kept, got %q", out)
+		}
+		if stats := rt.Stats.Tables["events"]; stats == nil || stats.RowsSeen != 3 {
+			t.Fatalf("expected 3 records counted, got %+v", stats)
+		}
+
+		if out := processDump(t, newNDJSONParser(newTestRuntime(), "audit"), bothAlgorithms(), `{"email":"test@example.com"}`+"\n"); out != "" {
+			t.Fatalf("expected the records of a skipped table dropped, got %q", out)
+		}
+	})
+}
+
+func TestNDJSONParserMasksEveryStringWithoutConfig(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+
+		input := `{"a":"test@example.com","b":["x test@example.com"],"test@example.com":1}` + "\n"
+		want := `{"a":"t098f6b@example.com","b":["x t098f6b@example.com"],"test@example.com":1}` + "\n"
+		if out := processDump(t, newNDJSONParser(newTestRuntime(), "events"), bothAlgorithms(), input); out != want {
+			t.Fatalf("expected %q, got %q", want, out)
+		}
+
+		rt := newTestRuntime()
+		rt.Strict = true
+		processDump(t, newNDJSONParser(rt, "events"), bothAlgorithms(), "not json\n")
+		if err := rt.StrictError(); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+			t.Fatalf("expected invalid records to fail strict mode, got %v", err)
+		}
+	})
+}
+
+func TestCLIMasksNDJSON(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"events": {"email": ["user.contacts[*].email"]}}`)
+	input := `{"id":1,"user":{"contacts":[{"email":"test@example.com"}],"login":"test@example.com"}}` + "\n"
+	want := `{"id":1,"user":{"contacts":[{"email":"t098f6b@example.com"}],"login":"test@example.com"}}` + "\n"
+
+	stdout, stderr, err := run([]byte(input), "--db-format=ndjson", "--table", "events")
+	if err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if stdout != want {
+		t.Fatalf("expected %q, got %q", want, stdout)
+	}
+
+	inDir := filepath.Join(runtimeDir, "export")
+	writeDumpFiles(t, inDir, map[string]string{"events.jsonl.zst": input})
+	outDir := filepath.Join(runtimeDir, "masked")
+	if _, stderr, err := run(nil, "--db-format=ndjson", "--input-dir", inDir, "--output", outDir); err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if events, format := readDumpFile(t, filepath.Join(outDir, "events.jsonl.zst")); format != "zstd" || events != want {
+		t.Fatalf("expected the file masked like stdin, got %s %q", format, events)
+	}
+}
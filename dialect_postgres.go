@@ -1,15 +1,5 @@
 package main
 
-import (
-	"regexp"
-	"strings"
-)
-
-// COPY "schema"."table" (col1, col2, ...) FROM stdin;
-var pgCopyRegex = regexp.MustCompile(`(?i)^COPY\s+([^\s(]+)\s*\(([^)]*)\)\s+FROM\s+stdin;\s*$`)
-
-const pgCopyTerminator = `\.`
-
 // postgresDialectParser handles pg_dump output in both COPY and INSERT
 // styles. INSERT statements and CREATE TABLE parsing are shared with the
 // generic SQL machinery; COPY blocks are handled here.
@@ -21,14 +11,21 @@ type postgresDialectParser struct {
 	copyActive bool
 	copyDrop   bool
 	copyNoMask bool
-	copyEmail  map[int]bool
-	copyPhone  map[int]bool
+	copyMasks  columnMasks
+	copyStats  *tableStats
+	// copyTable and copyColumns name the rows for the row visitor.
+	copyTable   string
+	copyColumns []string
+	// copyHeader is set while the header line of a COPY block with the
+	// HEADER option is still ahead.
+	copyHeader bool
+	copyRows   copyRowCollector
 }
 
 func newPostgresDialectParser(rt *Runtime) *postgresDialectParser {
 	return &postgresDialectParser{
 		rt:   rt,
-		proc: newSQLStatementProcessor(rt, false),
+		proc: newSQLStatementProcessor(rt, DialectPostgreSQL),
 	}
 }
 
@@ -37,8 +34,58 @@ func (p *postgresDialectParser) Dialect() DumpDialect { return DialectPostgreSQL
 
 // ProcessLine implements DialectParser.
 func (p *postgresDialectParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *postgresDialectParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
+	if p.copyActive {
+		row, ok := p.copyRows.collect(p.rt, line)
+		if !ok {
+			return maskJob{}, true // held until the quoted value closes
+		}
+		line = row
+	} else if p.rt.filtering() {
+		joined, ok := p.proc.collectStatement(line, p.proc.insertActive)
+		if !ok {
+			return maskJob{}, true // held until the open literal closes
+		}
+		line = joined
+	}
+	return p.processLine(line, config, cache)
+}
+
+// streamLexer implements tupleStreamer. COPY rows are never streamed.
+func (p *postgresDialectParser) streamLexer(string) (sqlLexer, bool) {
+	return p.proc.lex, !p.copyActive && p.proc.pending.Len() == 0
+}
+
+// Flush implements flushableParser: it emits an INSERT statement or a COPY
+// CSV row still open at end of input.
+func (p *postgresDialectParser) Flush(config MaskConfig, cache *Cache) string {
+	return p.prepareFlush(config, cache).run()
+}
+
+// prepareFlush implements jobParser.
+func (p *postgresDialectParser) prepareFlush(config MaskConfig, cache *Cache) maskJob {
+	if pending := p.copyRows.takePending(p.rt); pending != "" {
+		return maskJob{text: pending}
+	}
+	pending := p.proc.takePending()
+	if pending == "" {
+		return maskJob{}
+	}
+	job, drop := p.processLine(pending, config, cache)
+	if drop {
+		return maskJob{}
+	}
+	return job
+}
+
+func (p *postgresDialectParser) processLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
 	selective := len(p.rt.ProcessingTables) > 0
-	filtering := selective || len(p.rt.SkipTableList) > 0 || len(p.rt.NoMaskTableList) > 0
+	filtering := p.rt.filtering()
 	body, newline := splitTrailingNewline(line)
 
 	// Rows inside an open COPY block.
@@ -46,104 +93,145 @@ func (p *postgresDialectParser) ProcessLine(line string, config MaskConfig, cach
 		if body == pgCopyTerminator {
 			drop := p.copyDrop
 			p.resetCopy()
-			return line, drop
+			return maskJob{text: line}, drop
+		}
+		if p.copyHeader {
+			p.copyHeader = false
+			return maskJob{text: line}, p.copyDrop
 		}
+		p.copyStats.addRows(1, p.copyDrop, p.copyNoMask)
 		if p.copyDrop {
-			return "", true
+			return maskJob{}, true
+		}
+		if p.rt.RowVisitor != nil {
+			p.rt.RowVisitor(p.copyTable, p.copyColumns, p.copyRows.format.values(body))
 		}
 		if p.copyNoMask {
-			return line, false
+			return maskJob{text: line}, false
 		}
-		if len(p.copyEmail) > 0 || len(p.copyPhone) > 0 {
-			return p.maskCopyRow(body, cache) + newline, false
+		if len(p.copyMasks) > 0 {
+			rt, format, masks, stats := p.rt, p.copyRows.format, p.copyMasks, p.copyStats
+			return maskJob{mask: func() string {
+				return maskCopyRow(rt, body, format, masks, cache, stats) + newline
+			}}, false
 		}
 		if selective {
 			// Selective mode masks only configured fields.
-			return line, false
+			return maskJob{text: line}, false
 		}
-		return maskFullLine(p.rt, body, config, cache) + newline, false
+		return fullLineJob(p.rt, maskJob{text: body}, config, cache, p.copyStats).withSuffix(newline), false
 	}
 
 	if filtering {
-		if matches := pgCopyRegex.FindStringSubmatch(body); matches != nil {
-			return p.startCopyBlock(matches[1], matches[2], line, config)
+		if stmt, ok := parseCopyStatement(body); ok {
+			out, drop := p.startCopyBlock(stmt, line, config)
+			return maskJob{text: out}, drop
 		}
 	}
 
-	if selective && !p.proc.insertActive && p.proc.processCreateTableLine(body) {
-		return line, false
+	if p.rt.collectsColumns() && !p.proc.insertActive && p.proc.processCreateTableLine(body) {
+		return maskJob{text: line}, false
 	}
 
 	if filtering {
-		out, action := p.proc.processInsertLine(body, config, cache)
+		job, action := p.proc.processInsertLine(body, config, cache)
 		switch action {
 		case insertDropped:
-			return "", true
+			return maskJob{}, true
 		case insertHandledRaw:
-			return out + newline, false
+			return job.withSuffix(newline), false
 		case insertHandled:
 			if selective {
-				return out + newline, false
+				return job.withSuffix(newline), false
 			}
-			return maskFullLine(p.rt, out, config, cache) + newline, false
+			return fullLineJob(p.rt, job, config, cache, p.proc.stats).withSuffix(newline), false
 		}
 	}
 
 	if selective {
 		// Selective mode masks only configured fields; unrelated lines
 		// pass through unchanged.
-		return line, false
+		return maskJob{text: line}, false
 	}
-	return maskFullLine(p.rt, line, config, cache), false
+	return fullLineJob(p.rt, maskJob{text: line}, config, cache, p.rt.Stats.other()), false
 }
 
 // startCopyBlock opens a COPY ... FROM stdin block and decides how its rows
 // will be treated: dropped, masked by column position, or passed through.
-func (p *postgresDialectParser) startCopyBlock(table, columnList, line string, config MaskConfig) (string, bool) {
+func (p *postgresDialectParser) startCopyBlock(stmt copyStatement, line string, config MaskConfig) (string, bool) {
+	table := stmt.table
 	p.copyActive = true
+	p.copyStats = p.rt.Stats.table(table)
+	p.copyRows.format = stmt.format
+	p.copyHeader = stmt.format.header
 
 	if isSkippedTable(p.rt, table, p.proc.fold) {
 		p.copyDrop = true
 		return "", true
 	}
+	if p.rt.RowVisitor != nil {
+		p.copyTable, _ = normalizeTableName(table)
+		p.copyColumns = stmt.columns
+		if !stmt.hasColumns {
+			p.copyColumns, _ = p.proc.columnsFor(table)
+		}
+	}
 
 	if isNoMaskTable(p.rt, table, p.proc.fold) {
 		p.copyNoMask = true
 		return line, false
 	}
 
-	if tableConfig, ok := lookupProcessingTable(p.rt, table, p.proc.fold); ok {
-		columns := splitColumnList(columnList)
-		if len(columns) == 0 {
+	if tableKey, tableConfig, ok := lookupProcessingTable(p.rt, table, p.proc.fold); ok {
+		columns := stmt.columns
+		if !stmt.hasColumns {
+			// Without a column list the rows follow the CREATE TABLE order.
+			columns, _ = p.proc.columnsFor(table)
+		}
+		switch {
+		case stmt.err != nil:
+			p.rt.reportUnmasked("cannot read COPY data of table %s (%v): rows pass through unmasked", table, stmt.err)
+		case len(columns) == 0:
 			// Safety rule: no confident column positions, no masking.
-			if logger != nil {
-				logger.Warn("cannot parse COPY column list for table %s: rows pass through unmasked", table)
-			}
-		} else {
-			p.copyEmail, p.copyPhone = fieldPositions(tableConfig, columns, config, p.proc.fold)
+			p.rt.reportUnmasked("cannot parse COPY column list for table %s: rows pass through unmasked", table)
+		default:
+			p.copyMasks = fieldPositions(p.rt, tableKey, tableConfig, columns, config, p.proc.fold)
 		}
 	}
 	return line, false
 }
 
-// maskCopyRow masks configured columns of one tab-separated COPY data row.
-// Literal tabs inside values are escaped as "\t" by pg_dump, so splitting on
-// the tab character is unambiguous. "\N" marks NULL and is left untouched.
-func (p *postgresDialectParser) maskCopyRow(body string, cache *Cache) string {
-	values := strings.Split(body, "\t")
-	for pos := range values {
-		if values[pos] == `\N` {
+// maskCopyRow masks configured columns of one COPY data row. Values are
+// decoded per the block's format before masking and encoded again when
+// masking changed them; NULL markers and the other values keep their exact
+// text.
+func maskCopyRow(rt *Runtime, body string, format copyFormat, masks columnMasks, cache *Cache, stats *tableStats) string {
+	fields := format.split(body)
+	for pos, field := range fields {
+		mask, ok := masks[pos]
+		if field.null || !ok {
 			continue
 		}
-		values[pos] = maskValueAt(p.rt, values[pos], pos, p.copyEmail, p.copyPhone, cache)
+		value := format.decode(field.raw)
+		masked := value
+		if mask.doc != nil {
+			masked = mask.doc.mask(rt, masked, cache, stats)
+		}
+		if masked = maskValueAt(rt, masked, pos, masks, cache, stats); masked != value {
+			fields[pos].raw = format.encode(masked, field.quoted)
+		}
 	}
-	return strings.Join(values, "\t")
+	return format.join(fields)
 }
 
 func (p *postgresDialectParser) resetCopy() {
 	p.copyActive = false
 	p.copyDrop = false
 	p.copyNoMask = false
-	p.copyEmail = nil
-	p.copyPhone = nil
+	p.copyMasks = nil
+	p.copyStats = nil
+	p.copyTable = ""
+	p.copyColumns = nil
+	p.copyHeader = false
+	p.copyRows = copyRowCollector{}
 }
@@ -5,18 +5,23 @@ import (
 	"strings"
 )
 
-// Shared statement-level parsing for dialects whose data lines are standard
-// SQL INSERT statements: PostgreSQL (--inserts), Oracle, MS SQL Server,
-// SQLite and Firebird. Identifiers may be bare, double-quoted or bracketed.
+// Shared statement-level parsing for dialects whose data lines are SQL
+// INSERT statements: MySQL, PostgreSQL (--inserts), Oracle, MS SQL Server,
+// SQLite and Firebird. Identifiers may be bare, backtick-quoted,
+// double-quoted or bracketed.
 var (
-	// INSERT INTO <table> [(col, ...)] VALUES <rest>
-	sqlInsertRegex = regexp.MustCompile(`(?i)^\s*INSERT\s+INTO\s+([` + "`" + `"\[\]\w$.]+)\s*(?:\(([^)]*)\)\s*)?VALUES\s*(.*)$`)
+	// One possibly schema-qualified table reference. Quoted parts may hold
+	// any character but the closing quote.
+	sqlTableRefPattern = "(?:`[^`]+`|\"[^\"]+\"|\\[[^\\]]+\\]|[\\w$]+)(?:\\.(?:`[^`]+`|\"[^\"]+\"|\\[[^\\]]+\\]|[\\w$]+))*"
+	// INSERT [IGNORE] INTO | REPLACE INTO <table> [(col, ...)] VALUES <rest>
+	sqlInsertRegex = regexp.MustCompile(`(?is)^\s*(?:INSERT|REPLACE)(?:\s+(?:LOW_PRIORITY|DELAYED|HIGH_PRIORITY|IGNORE))*\s+INTO\s+(` + sqlTableRefPattern + `)\s*(?:\(([^)]*)\)\s*)?VALUES\s*(.*)$`)
 	// CREATE TABLE [IF NOT EXISTS] <table> [(...]
-	sqlCreateTableRegex = regexp.MustCompile(`(?i)^\s*CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([` + "`" + `"\[\]\w$.]+)\s*(\(?)(.*)$`)
-	// A continuation line of a multi-row VALUES list: "(...)," or "(...);"
-	sqlTupleLineRegex = regexp.MustCompile(`^\s*\(.*\)\s*[,;]?\s*$`)
-	// First identifier of a column definition line inside CREATE TABLE.
-	sqlColumnDefRegex = regexp.MustCompile("^\\s*([`\"\\[]?)([\\w$]+)[`\"\\]]?\\s+")
+	sqlCreateTableRegex = regexp.MustCompile(`(?i)^\s*CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + sqlTableRefPattern + `)\s*(\(?)(.*)$`)
+	// First identifier of a column definition line inside CREATE TABLE:
+	// quoted (groups 1-3) or bare (group 4).
+	sqlColumnDefRegex = regexp.MustCompile("^\\s*(?:`([^`]+)`|\"([^\"]+)\"|\\[([^\\]]+)\\]|([\\w$]+))\\s+")
+	// The ");" that closes a CREATE TABLE definition.
+	endTableRegex = regexp.MustCompile(`\)[^)]*;`)
 )
 
 // sqlConstraintKeywords are line starters inside CREATE TABLE that do not
@@ -35,6 +40,8 @@ type sqlStatementProcessor struct {
 	// fold enables case-insensitive identifier matching (Oracle folds
 	// unquoted identifiers to upper case).
 	fold bool
+	// lex scans VALUES lists with the dialect's literal rules.
+	lex sqlLexer
 	// tables collects column order per table (normalized full and plain
 	// names both point at the same entry).
 	tables map[string][]string
@@ -47,16 +54,38 @@ type sqlStatementProcessor struct {
 	insertActive bool
 	insertDrop   bool
 	insertNoMask bool
-	emailPos     map[int]bool
-	phonePos     map[int]bool
+	masks        columnMasks
+	// rowTable and rowColumns name the tuples of the open statement for
+	// the row visitor.
+	rowTable   string
+	rowColumns []string
+	// stats counts the table of the latest INSERT statement; it outlives
+	// resetInsert so the caller can attribute full-line masking of the
+	// statement's last line. Nil when stats are off.
+	stats *tableStats
+
+	// pending collects the physical lines of an INSERT line whose last
+	// tuple is still open (a string literal with an embedded newline).
+	pending strings.Builder
 }
 
-func newSQLStatementProcessor(rt *Runtime, fold bool) *sqlStatementProcessor {
-	return &sqlStatementProcessor{
+// maxPendingStatementSize bounds the input held while waiting for an open
+// literal to close. A statement that grows beyond it is processed as is.
+const maxPendingStatementSize = 256 << 20
+
+func newSQLStatementProcessor(rt *Runtime, dialect DumpDialect) *sqlStatementProcessor {
+	p := &sqlStatementProcessor{
 		rt:     rt,
-		fold:   fold,
 		tables: make(map[string][]string),
 	}
+	p.setDialect(dialect)
+	return p
+}
+
+// setDialect applies the identifier and literal rules of a dialect.
+func (p *sqlStatementProcessor) setDialect(dialect DumpDialect) {
+	p.fold = dialect == DialectOracle
+	p.lex = newSQLLexer(dialect)
 }
 
 // tableKey normalizes a table map key according to the fold mode.
@@ -203,12 +232,15 @@ func columnFromDefinitionLine(line string) (string, bool) {
 	if matches == nil {
 		return "", false
 	}
-	name := matches[2]
-	if matches[1] == "" {
-		if _, ok := sqlConstraintKeywords[strings.ToUpper(name)]; ok {
-			return "", false
+	for _, quoted := range matches[1:4] {
+		if quoted != "" {
+			return quoted, true
 		}
 	}
+	name := matches[4]
+	if _, ok := sqlConstraintKeywords[strings.ToUpper(name)]; ok {
+		return "", false
+	}
 	return name, true
 }
 
@@ -229,26 +261,30 @@ const (
 )
 
 // processInsertLine handles INSERT statements, multi-line VALUES lists and
-// skip/no-mask-listed tables. It returns the transformed line and the action
-// the caller must take.
-func (p *sqlStatementProcessor) processInsertLine(line string, config MaskConfig, cache *Cache) (string, insertAction) {
+// skip/no-mask-listed tables. It returns the job producing the transformed
+// line and the action the caller must take.
+func (p *sqlStatementProcessor) processInsertLine(line string, config MaskConfig, cache *Cache) (maskJob, insertAction) {
 	// Continuation of an open multi-line VALUES list.
 	if p.insertActive {
-		if sqlTupleLineRegex.MatchString(line) {
+		if p.isTupleLine(line) {
 			drop, noMask := p.insertDrop, p.insertNoMask
-			emailPos, phonePos := p.emailPos, p.phonePos
+			masks := p.masks
+			p.countRows(line, drop, noMask)
+			if !drop {
+				p.visitRows(p.rowTable, p.rowColumns, line)
+			}
 			if statementTerminated(line) {
 				p.resetInsert()
 			}
 			switch {
 			case drop:
-				return "", insertDropped
+				return maskJob{}, insertDropped
 			case noMask:
-				return line, insertHandledRaw
-			case len(emailPos) == 0 && len(phonePos) == 0:
-				return line, insertHandled
+				return maskJob{text: line}, insertHandledRaw
+			case len(masks) == 0:
+				return maskJob{text: line}, insertHandled
 			default:
-				return maskTuples(p.rt, line, emailPos, phonePos, cache), insertHandled
+				return p.tuplesJob(line, 0, masks, cache), insertHandled
 			}
 		}
 		// The line does not look like a tuple: the statement ended
@@ -257,76 +293,188 @@ func (p *sqlStatementProcessor) processInsertLine(line string, config MaskConfig
 		p.resetInsert()
 	}
 
-	matches := sqlInsertRegex.FindStringSubmatch(line)
+	matches := sqlInsertRegex.FindStringSubmatchIndex(line)
 	if matches == nil {
-		return line, insertNotHandled
+		return maskJob{text: line}, insertNotHandled
 	}
-	table := matches[1]
-	columnList := matches[2]
-	rest := matches[3]
+	table := line[matches[2]:matches[3]]
+	columnList := ""
+	if matches[4] >= 0 {
+		columnList = line[matches[4]:matches[5]]
+	}
+	restStart := matches[6]
+	rest := line[restStart:]
 
 	// Multi-line statements keep state until the closing ";".
 	multiLine := !statementTerminated(rest)
+	p.stats = p.rt.Stats.table(table)
 
 	if isSkippedTable(p.rt, table, p.fold) {
+		p.countRows(rest, true, false)
 		if multiLine {
 			p.insertActive = true
 			p.insertDrop = true
 		}
-		return "", insertDropped
+		return maskJob{}, insertDropped
+	}
+
+	if p.rt.RowVisitor != nil {
+		columns := p.insertColumns(table, columnList)
+		p.visitRows(table, columns, rest)
+		if multiLine {
+			p.rowTable, p.rowColumns = table, columns
+		}
 	}
 
 	if isNoMaskTable(p.rt, table, p.fold) {
+		p.countRows(rest, false, true)
 		if multiLine {
 			p.insertActive = true
 			p.insertNoMask = true
 		}
-		return line, insertHandledRaw
+		return maskJob{text: line}, insertHandledRaw
 	}
 
-	tableConfig, ok := lookupProcessingTable(p.rt, table, p.fold)
+	p.countRows(rest, false, false)
+	tableKey, tableConfig, ok := lookupProcessingTable(p.rt, table, p.fold)
 	if !ok {
-		if multiLine && strings.TrimSpace(rest) == "" {
+		if multiLine {
 			// Open multi-line VALUES list of an unconfigured table: keep
-			// passing tuple lines through with no field awareness.
+			// passing tuple lines through with no field awareness, counting
+			// their rows.
 			p.insertActive = true
 			p.insertDrop = false
-			p.emailPos = nil
-			p.phonePos = nil
+			p.masks = nil
 		}
-		return line, insertHandled
+		return maskJob{text: line}, insertHandled
 	}
 
-	var columns []string
-	if strings.TrimSpace(columnList) != "" {
-		columns = splitColumnList(columnList)
-	} else {
-		columns, _ = p.columnsFor(table)
-	}
+	columns := p.insertColumns(table, columnList)
 	if len(columns) == 0 {
 		// Safety rule: without confident column positions no field-aware
 		// masking is applied.
-		if logger != nil {
-			logger.Warn("no column information for table %s: leaving INSERT unmasked", table)
+		p.rt.reportUnmasked("no column information for table %s: leaving INSERT unmasked", table)
+		if multiLine {
+			p.insertActive = true
+			p.insertDrop = false
+			p.masks = nil
 		}
-		return line, insertHandled
+		return maskJob{text: line}, insertHandled
 	}
 
-	emailPos, phonePos := fieldPositions(tableConfig, columns, config, p.fold)
+	masks := fieldPositions(p.rt, tableKey, tableConfig, columns, config, p.fold)
 	if multiLine {
 		p.insertActive = true
 		p.insertDrop = false
-		p.emailPos = emailPos
-		p.phonePos = phonePos
+		p.masks = masks
 	}
 	if strings.TrimSpace(rest) == "" {
-		return line, insertHandled
+		return maskJob{text: line}, insertHandled
 	}
-	masked := maskTuples(p.rt, rest, emailPos, phonePos, cache)
-	if masked == rest {
-		return line, insertHandled
+	return p.tuplesJob(line, restStart, masks, cache), insertHandled
+}
+
+// insertColumns returns the columns of an INSERT statement: its column list
+// or, without one, the CREATE TABLE order of the table.
+func (p *sqlStatementProcessor) insertColumns(table, columnList string) []string {
+	if strings.TrimSpace(columnList) != "" {
+		return splitColumnList(columnList)
 	}
-	return line[:len(line)-len(rest)] + masked, insertHandled
+	columns, _ := p.columnsFor(table)
+	return columns
+}
+
+// visitRows shows the VALUES tuples in s to the row visitor, if any.
+func (p *sqlStatementProcessor) visitRows(table string, columns []string, s string) {
+	if p.rt.RowVisitor == nil {
+		return
+	}
+	full, _ := normalizeTableName(table)
+	for _, values := range p.lex.tupleValues(s) {
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		p.rt.RowVisitor(full, columns, values)
+	}
+}
+
+// tuplesJob defers masking the VALUES tuples in line[start:], counted for
+// the current statement's table.
+func (p *sqlStatementProcessor) tuplesJob(line string, start int, masks columnMasks, cache *Cache) maskJob {
+	rt, lex, stats := p.rt, p.lex, p.stats
+	return maskJob{mask: func() string {
+		rest := line[start:]
+		masked := maskTuples(rt, lex, rest, masks, cache, stats)
+		if masked == rest {
+			return line
+		}
+		return line[:start] + masked
+	}}
+}
+
+// collectStatement joins physical lines while a tuple of an INSERT line
+// stays open across a newline, so that values with embedded newlines are
+// masked by column like any other. It returns the logical line once every
+// tuple closed, or ok=false while more input is needed. inValues tells
+// whether line continues a multi-line VALUES list.
+func (p *sqlStatementProcessor) collectStatement(line string, inValues bool) (string, bool) {
+	if p.pending.Len() == 0 && !p.opensTuple(line, inValues) {
+		return line, true
+	}
+	p.pending.WriteString(line)
+	joined := p.pending.String()
+	if p.opensTuple(joined, inValues) {
+		if p.pending.Len() < maxPendingStatementSize {
+			return "", false
+		}
+		p.rt.reportUnmasked("INSERT value exceeds %d bytes without closing: the open row passes through unmasked", maxPendingStatementSize)
+	}
+	p.pending.Reset()
+	return joined, true
+}
+
+// takePending returns the input still held by collectStatement at end of
+// input. Its open row cannot be masked.
+func (p *sqlStatementProcessor) takePending() string {
+	if p.pending.Len() == 0 {
+		return ""
+	}
+	p.rt.reportUnmasked("input ended inside an INSERT value: the open row passes through unmasked")
+	pending := p.pending.String()
+	p.pending.Reset()
+	return pending
+}
+
+// opensTuple reports whether s, an INSERT line or a VALUES continuation
+// line, ends inside a tuple.
+func (p *sqlStatementProcessor) opensTuple(s string, inValues bool) bool {
+	if inValues && strings.HasPrefix(strings.TrimSpace(s), "(") {
+		return p.lex.unclosed(s)
+	}
+	if matches := sqlInsertRegex.FindStringSubmatch(s); matches != nil {
+		return p.lex.unclosed(matches[3])
+	}
+	return false
+}
+
+// isTupleLine reports whether a line continues a multi-row VALUES list: it
+// starts with a complete tuple, as in "(...)," or "(...);".
+func (p *sqlStatementProcessor) isTupleLine(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(trimmed, "(") {
+		return false
+	}
+	_, end := p.lex.tuple(trimmed, 0)
+	return end > 0
+}
+
+// countRows counts the VALUES tuples of s as rows of the current table.
+func (p *sqlStatementProcessor) countRows(s string, dropped, raw bool) {
+	if p.stats == nil {
+		return
+	}
+	tuples, _ := p.lex.tuples(s)
+	p.stats.addRows(len(tuples), dropped, raw)
 }
 
 // resetInsert clears the multi-line INSERT statement state.
@@ -334,12 +482,13 @@ func (p *sqlStatementProcessor) resetInsert() {
 	p.insertActive = false
 	p.insertDrop = false
 	p.insertNoMask = false
-	p.emailPos = nil
-	p.phonePos = nil
+	p.masks = nil
+	p.rowTable = ""
+	p.rowColumns = nil
 }
 
 // sqlInsertDialectParser adapts sqlStatementProcessor to the DialectParser
-// interface for Oracle, MSSQL, SQLite and Firebird dumps.
+// interface for MySQL, Oracle, MSSQL, SQLite and Firebird dumps.
 type sqlInsertDialectParser struct {
 	dialect DumpDialect
 	rt      *Runtime
@@ -350,7 +499,7 @@ func newSQLInsertDialectParser(rt *Runtime, dialect DumpDialect) *sqlInsertDiale
 	return &sqlInsertDialectParser{
 		dialect: dialect,
 		rt:      rt,
-		proc:    newSQLStatementProcessor(rt, dialect == DialectOracle),
+		proc:    newSQLStatementProcessor(rt, dialect),
 	}
 }
 
@@ -359,36 +508,77 @@ func (p *sqlInsertDialectParser) Dialect() DumpDialect { return p.dialect }
 
 // ProcessLine implements DialectParser.
 func (p *sqlInsertDialectParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *sqlInsertDialectParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
+	if p.rt.filtering() {
+		joined, ok := p.proc.collectStatement(line, p.proc.insertActive)
+		if !ok {
+			return maskJob{}, true // held until the open literal closes
+		}
+		line = joined
+	}
+	return p.processLine(line, config, cache)
+}
+
+// streamLexer implements tupleStreamer.
+func (p *sqlInsertDialectParser) streamLexer(string) (sqlLexer, bool) {
+	return p.proc.lex, p.proc.pending.Len() == 0
+}
+
+// Flush implements flushableParser: it emits a statement still open at end
+// of input.
+func (p *sqlInsertDialectParser) Flush(config MaskConfig, cache *Cache) string {
+	return p.prepareFlush(config, cache).run()
+}
+
+// prepareFlush implements jobParser.
+func (p *sqlInsertDialectParser) prepareFlush(config MaskConfig, cache *Cache) maskJob {
+	pending := p.proc.takePending()
+	if pending == "" {
+		return maskJob{}
+	}
+	job, drop := p.processLine(pending, config, cache)
+	if drop {
+		return maskJob{}
+	}
+	return job
+}
+
+func (p *sqlInsertDialectParser) processLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
 	selective := len(p.rt.ProcessingTables) > 0
-	filtering := selective || len(p.rt.SkipTableList) > 0 || len(p.rt.NoMaskTableList) > 0
+	filtering := p.rt.filtering()
 	body, newline := splitTrailingNewline(line)
 
-	if selective && !p.proc.insertActive && p.proc.processCreateTableLine(body) {
-		return line, false
+	if p.rt.collectsColumns() && !p.proc.insertActive && p.proc.processCreateTableLine(body) {
+		return maskJob{text: line}, false
 	}
 
 	if filtering {
-		out, action := p.proc.processInsertLine(body, config, cache)
+		job, action := p.proc.processInsertLine(body, config, cache)
 		switch action {
 		case insertDropped:
-			return "", true
+			return maskJob{}, true
 		case insertHandledRaw:
-			return out + newline, false
+			return job.withSuffix(newline), false
 		case insertHandled:
 			if selective {
 				// Selective mode masks only configured fields.
-				return out + newline, false
+				return job.withSuffix(newline), false
 			}
-			return maskFullLine(p.rt, out, config, cache) + newline, false
+			return fullLineJob(p.rt, job, config, cache, p.proc.stats).withSuffix(newline), false
 		}
 	}
 
 	if selective {
 		// Selective mode masks only configured fields; unrelated lines
 		// pass through unchanged.
-		return line, false
+		return maskJob{text: line}, false
 	}
-	return maskFullLine(p.rt, line, config, cache), false
+	return fullLineJob(p.rt, maskJob{text: line}, config, cache, p.rt.Stats.other()), false
 }
 
 // splitTrailingNewline separates the line body from its trailing newline so
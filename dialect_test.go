@@ -1,6 +1,7 @@
 package main
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -40,6 +41,9 @@ func TestParseDumpDialect(t *testing.T) {
 		"mssql":      DialectMSSQL,
 		"sqlite":     DialectSQLite,
 		"firebird":   DialectFirebird,
+		"CSV":        DialectCSV,
+		"tsv":        DialectTSV,
+		"ndjson":     DialectNDJSON,
 	} {
 		dialect, err := ParseDumpDialect(value)
 		if err != nil {
@@ -124,6 +128,112 @@ func TestMySQLDialectSelectiveMasksOnce(t *testing.T) {
 	})
 }
 
+// MySQL statements go through the shared SQL statement processor: keyword
+// case, modifiers, schema-qualified names, column lists and trailing clauses
+// must not hide data from table lists or column masking.
+func TestMySQLDialectStatementVariants(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"e-mail"}},
+		}
+		SkipTableList = map[string]struct{}{"secrets": {}}
+		NoMaskTableList = map[string]struct{}{"shop.raw": {}}
+
+		dump := "CREATE TABLE `users` (\n" +
+			"  `id` int NOT NULL,\n" +
+			"  `e-mail` varchar(255),\n" +
+			"  PRIMARY KEY (`id`)\n" +
+			") ENGINE=InnoDB;\n" +
+			"INSERT IGNORE INTO `shop`.`users` VALUES (1,'one@example.com');\n" +
+			"REPLACE INTO `users` VALUES (2,'two@example.com');\n" +
+			"insert into `users` (`e-mail`, `id`) values ('three@example.com', 3) " +
+			"ON DUPLICATE KEY UPDATE `e-mail`=VALUES(`e-mail`);\n" +
+			"INSERT INTO `users` VALUES\n" +
+			"(4,'four@example.com'),\n" +
+			"(5,'five@example.com');\n" +
+			"INSERT IGNORE INTO `shop`.`secrets` VALUES\n" +
+			"(1,'gone@example.com');\n" +
+			"REPLACE INTO `shop`.`raw` VALUES (1,'keep@example.com');\n"
+
+		parser := NewDialectParser(DialectMySQL, newTestRuntime())
+		out := processDump(t, parser, bothAlgorithms(), dump)
+
+		for _, original := range []string{"one@", "two@", "three@", "four@", "five@"} {
+			if strings.Contains(out, original) {
+				t.Fatalf("expected %s masked, got: %s", original, out)
+			}
+		}
+		if strings.Contains(out, "secrets") || strings.Contains(out, "gone@example.com") {
+			t.Fatalf("expected skipped multi-line INSERT IGNORE dropped, got: %s", out)
+		}
+		if !strings.Contains(out, "keep@example.com") {
+			t.Fatalf("expected schema-qualified no-mask table kept, got: %s", out)
+		}
+		if !strings.Contains(out, "ON DUPLICATE KEY UPDATE `e-mail`=VALUES(`e-mail`);\n") {
+			t.Fatalf("expected ON DUPLICATE KEY UPDATE clause kept verbatim, got: %s", out)
+		}
+	})
+}
+
+// A string literal with embedded newlines must not end the statement: the
+// rows after it are still masked by column and skip-listed rows still go.
+func TestMultiLineLiteralsMaskedByColumn(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}},
+		}
+		SkipTableList = map[string]struct{}{"secrets": {}}
+
+		tests := []struct {
+			dialect DumpDialect
+			dump    string
+		}{
+			{DialectMySQL, "CREATE TABLE `users` (\n  `id` int,\n  `bio` text,\n  `email` varchar(255)\n);\n" +
+				"INSERT INTO `users` VALUES (1,'line one\nline (two),\n','test@example.com'),(2,'x','test@example.com');\n" +
+				"INSERT INTO `secrets` VALUES (1,'gone\nstill gone');\n"},
+			{DialectPostgreSQL, "INSERT INTO public.users (id, bio, email) VALUES\n" +
+				"(1, E'it\\'s\n', 'test@example.com'),\n" +
+				"(2, 'multi\n(line),', 'test@example.com');\n" +
+				"INSERT INTO public.secrets (id, note) VALUES (1, 'gone\nstill gone');\n"},
+			{DialectOracle, "INSERT INTO users (id, bio, email) VALUES (1, 'O''Brien\n', 'test@example.com');\n" +
+				"INSERT INTO secrets (id, note) VALUES (1, 'gone\nstill gone');\n"},
+		}
+		for _, tt := range tests {
+			out := processDump(t, NewDialectParser(tt.dialect, newTestRuntime()), bothAlgorithms(), tt.dump)
+			if strings.Contains(out, "test@example.com") || !strings.Contains(out, "t098f6b@example.com") {
+				t.Fatalf("%s: expected emails after multi-line literals masked, got: %s", tt.dialect, out)
+			}
+			if strings.Contains(out, "gone") {
+				t.Fatalf("%s: expected skipped multi-line row dropped, got: %s", tt.dialect, out)
+			}
+			if got, want := strings.Count(out, "\n"), strings.Count(tt.dump, "\n")-2; got != want {
+				t.Fatalf("%s: expected %d output lines, got %d: %s", tt.dialect, want, got, out)
+			}
+		}
+	})
+}
+
+// A literal still open at end of input is emitted unchanged on flush.
+func TestUnterminatedLiteralFlushedAtEOF(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}},
+		}
+
+		dump := "INSERT INTO users (id, email) VALUES (1, 'test@example.com'), (2, 'open\n" +
+			"-- not a comment\n"
+		parser := NewDialectParser(DialectSQLite, newTestRuntime())
+		out := processDump(t, parser, bothAlgorithms(), dump)
+
+		if out != strings.Replace(dump, "test@example.com", "t098f6b@example.com", 1) {
+			t.Fatalf("expected held lines flushed with the closed row masked, got: %q", out)
+		}
+	})
+}
+
 func TestPostgresCopyMasking(t *testing.T) {
 	withTestGlobals(t, func() {
 		setupMaskingDefaults(t)
@@ -184,6 +294,66 @@ func TestPostgresCopyMatchesPlainConfigKey(t *testing.T) {
 	})
 }
 
+func TestPostgresCopyDecodesTextEscapes(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"public.tst_users": {Email: []string{"email"}},
+		}
+
+		dump := "COPY public.tst_users (id, email, note) FROM stdin;\n" +
+			`1	test\x40example.com	keep\tme` + "\n" +
+			`\.` + "\n" +
+			"COPY public.tst_users (id, note, email) FROM stdin WITH (DELIMITER '|', NULL '');\n" +
+			`2|a\|b|test@example.com` + "\n" +
+			`3||` + "\n" +
+			`\.` + "\n"
+
+		parser := NewDialectParser(DialectPostgreSQL, newTestRuntime())
+		out := processDump(t, parser, bothAlgorithms(), dump)
+
+		if !strings.Contains(out, "1\tt098f6b@example.com\tkeep\\tme\n") {
+			t.Fatalf("expected escaped email decoded and masked, other values untouched, got: %s", out)
+		}
+		if !strings.Contains(out, `2|a\|b|t098f6b@example.com`+"\n") || !strings.Contains(out, "3||\n") {
+			t.Fatalf("expected escaped delimiter kept in its column, got: %s", out)
+		}
+	})
+}
+
+func TestPostgresCopyCSVMasking(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"public.tst_users": {Email: []string{"email"}},
+		}
+
+		header := "COPY public.tst_users (id, email, note) FROM stdin WITH (FORMAT csv, DELIMITER ';', HEADER true, NULL 'NULL');\n" +
+			"id;email;note\n"
+		rows := "1;\"test@example.com\";\"multi\nline; note test@example.com\"\n" +
+			"2;NULL;plain\n" +
+			"3;test@example.com;\"say \"\"hi\"\"\"\n"
+		dump := header + rows + `\.` + "\n" + "SELECT 1;\n"
+
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		parser := NewDialectParser(DialectPostgreSQL, rt)
+		out := processDump(t, parser, bothAlgorithms(), dump)
+
+		want := header +
+			"1;\"t098f6b@example.com\";\"multi\nline; note test@example.com\"\n" +
+			"2;NULL;plain\n" +
+			"3;t098f6b@example.com;\"say \"\"hi\"\"\"\n" +
+			`\.` + "\n" + "SELECT 1;\n"
+		if out != want {
+			t.Fatalf("unexpected CSV masking:\n%s\nwant:\n%s", out, want)
+		}
+		if stats := rt.Stats.Tables["public.tst_users"]; stats == nil || stats.RowsSeen != 3 {
+			t.Fatalf("expected 3 rows counted without the header, got %+v", stats)
+		}
+	})
+}
+
 func TestPostgresCopySkipTable(t *testing.T) {
 	withTestGlobals(t, func() {
 		setupMaskingDefaults(t)
@@ -376,6 +546,69 @@ func TestSelectiveModeWithoutColumnInfoLeavesLineUntouched(t *testing.T) {
 	})
 }
 
+func TestStrictModeReportsUnmaskedData(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect DumpDialect
+		dump    string
+		want    string
+	}{
+		{"insert without columns", DialectOracle, "INSERT INTO users VALUES (1,'test@example.com');\n", "no column information for table users"},
+		{"unparsable copy columns", DialectPostgreSQL, "COPY users (id, ) FROM stdin;\n1\ttest@example.com\n\\.\n", "cannot parse COPY column list for table users"},
+		{"generic fallback", DialectAuto, "no markers here test@example.com\n", "dump dialect is unknown"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestGlobals(t, func() {
+				setupMaskingDefaults(t)
+				ProcessingTables = map[string]TableConfig{
+					"users": {Email: []string{"email"}},
+				}
+
+				rt := newTestRuntime()
+				processDump(t, NewDialectParser(tc.dialect, rt), bothAlgorithms(), tc.dump)
+				if err := rt.StrictError(); err != nil {
+					t.Fatalf("expected only a warning without strict mode, got: %v", err)
+				}
+
+				rt = newTestRuntime()
+				rt.Strict = true
+				processDump(t, NewDialectParser(tc.dialect, rt), bothAlgorithms(), tc.dump)
+				err := rt.StrictError()
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("expected strict mode error containing %q, got: %v", tc.want, err)
+				}
+			})
+		})
+	}
+}
+
+func TestConfigCoverageReportsUnmatchedEntries(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"public.users": {Email: []string{"email", "emial"}, Phone: []string{"phone"}},
+			"ordres":       {Email: []string{"email"}},
+		}
+
+		dump := "COPY public.users (id, email, phone) FROM stdin;\n" +
+			"1\ttest@example.com\t+7 999 123-45-67\n" +
+			"\\.\n"
+
+		// Phone masking is off: its columns still count as resolved.
+		rt := newTestRuntime()
+		processDump(t, NewDialectParser(DialectPostgreSQL, rt), MaskConfig{emailAlgorithm: "light-hash"}, dump)
+
+		got := strings.Join(rt.Coverage.unmatched(rt.ProcessingTables), "\n")
+		want := "masking_tables.ordres: table never seen in the dump data\n" +
+			`masking_tables.public.users: email column "emial" never resolved to a position`
+		if got != want {
+			t.Fatalf("unexpected coverage summary:\n%s", got)
+		}
+	})
+}
+
 func TestDialectAutoDetection(t *testing.T) {
 	cases := []struct {
 		name      string
@@ -719,3 +952,44 @@ func TestDialectAutoDetectionMoreMarkers(t *testing.T) {
 		})
 	}
 }
+
+// Custom data types from the registry are masked by column like the
+// built-in ones, and in full-line mode over the whole line.
+func TestCustomDataTypeMasking(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		CustomDataTypes = map[string]*DataType{
+			"inn": {
+				Name:      "inn",
+				Regex:     regexp.MustCompile(`\b\d{12}\b`),
+				Algorithm: "light-mask",
+				Rule:      MaskingRule{Target: "1-", Value: "*"},
+			},
+		}
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}, Types: map[string][]string{"inn": {"tax_id"}}},
+		}
+
+		dump := "INSERT INTO users (id, email, tax_id, note) VALUES (1, 'test@example.com', '500100732259', '500100732259');\n"
+
+		parser := NewDialectParser(DialectOracle, newTestRuntime())
+		out := processDump(t, parser, bothAlgorithms(), dump)
+
+		if !strings.Contains(out, "'************', '500100732259'") {
+			t.Fatalf("expected only the configured tax_id column masked, got: %s", out)
+		}
+		if !strings.Contains(out, "t098f6b@example.com") {
+			t.Fatalf("expected built-in email column still masked, got: %s", out)
+		}
+
+		ProcessingTables = nil
+		cache := &Cache{Emails: map[string]string{}, Phones: map[string]string{}}
+		line := maskFullLine(newTestRuntime(), "tax 500100732259\n", MaskConfig{}, cache, nil)
+		if line != "tax ************\n" {
+			t.Fatalf("expected custom type masked in full-line mode without CLI flags, got: %q", line)
+		}
+		if cache.Types["inn"]["500100732259"] != "************" {
+			t.Fatalf("expected custom type cached under its name, got: %v", cache.Types)
+		}
+	})
+}
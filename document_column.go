@@ -0,0 +1,60 @@
+package main
+
+import "strings"
+
+// documentColumn masks the structured documents stored in one column, such
+// as JSON or PHP serialize() data, where masking must understand the
+// document to find values and keep it readable.
+type documentColumn struct {
+	name string
+	// format names the document format in warnings.
+	format string
+	// rewrite masks a decoded document or fails when it cannot be parsed.
+	rewrite func(rt *Runtime, doc string, cache *Cache, stats *tableStats) (string, error)
+}
+
+// mask masks a decoded document of the column. A value that cannot be
+// parsed is reported and kept.
+func (c *documentColumn) mask(rt *Runtime, doc string, cache *Cache, stats *tableStats) string {
+	if strings.TrimSpace(doc) == "" {
+		return doc
+	}
+	masked, err := c.rewrite(rt, doc, cache, stats)
+	if err != nil {
+		cache.effect(func() {
+			rt.reportUnmasked("%s value of column %s cannot be parsed (%v): it passes through unmasked", c.format, c.name, err)
+		})
+		return doc
+	}
+	return masked
+}
+
+// maskLiteral masks the document held by a raw SQL value of the column: the
+// string literal is unescaped with the lexer's rules, masked and quoted
+// again in the same form. NULL passes through; any other value that is not
+// a plain string literal, such as a function call, or a literal with an
+// escape that cannot be decoded, is reported and kept.
+func (c *documentColumn) maskLiteral(rt *Runtime, lex sqlLexer, raw string, cache *Cache, stats *tableStats) string {
+	if value := strings.TrimSpace(raw); value == "" || strings.EqualFold(value, "NULL") {
+		return raw
+	}
+	literal, ok := lex.stringLiteral(raw)
+	if !ok {
+		cache.effect(func() {
+			rt.reportUnmasked("%s value of column %s is not a string literal: it passes through unmasked", c.format, c.name)
+		})
+		return raw
+	}
+	doc, ok := literal.value()
+	if !ok {
+		cache.effect(func() {
+			rt.reportUnmasked("%s value of column %s has an escape that cannot be decoded: it passes through unmasked", c.format, c.name)
+		})
+		return raw
+	}
+	masked := c.mask(rt, doc, cache, stats)
+	if masked == doc {
+		return raw
+	}
+	return literal.withValue(masked)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// dumpFile is a file of a dump directory that needs masking.
+type dumpFile struct {
+	// name is the path relative to the dump directory, used in errors.
+	name string
+	// what describes the content in errors, e.g. "data of public.users".
+	what string
+	// mask masks the file and returns the number of lines read.
+	mask func() (int, error)
+}
+
+// mirrorDumpDirectory creates the subdirectories of inDir in outDir and
+// returns the files classify picks for masking; it copies every other file
+// unchanged. classify gets the path of a file, its path relative to inDir
+// and its output path.
+func mirrorDumpDirectory(inDir, outDir string, classify func(path, rel, outPath string) (dumpFile, bool, error)) ([]dumpFile, error) {
+	var files []dumpFile
+	err := filepath.WalkDir(inDir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(inDir, path)
+		if err != nil {
+			return err
+		}
+		outPath := filepath.Join(outDir, rel)
+		if de.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			info, err := de.Info()
+			if err != nil {
+				return err
+			}
+			return os.Mkdir(outPath, info.Mode().Perm())
+		}
+		if !de.Type().IsRegular() {
+			return fmt.Errorf("unexpected %s in dump directory", rel)
+		}
+		file, ok, err := classify(path, rel, outPath)
+		if err != nil {
+			return err
+		}
+		if ok {
+			files = append(files, file)
+			return nil
+		}
+		return copyDumpFile(path, outPath)
+	})
+	return files, err
+}
+
+// maskDumpFiles masks files one after another and adds their lines to
+// m.lines. Each file is masked on the worker pool; masking files in a fixed
+// order keeps collision tie-breakers, and so the output, the same in every
+// run. The first error is returned.
+func (m *streamMasker) maskDumpFiles(files []dumpFile) error {
+	for _, file := range files {
+		lines, err := file.mask()
+		m.lines += lines
+		if err != nil {
+			return fmt.Errorf("%s (%s): %v", file.name, file.what, err)
+		}
+	}
+	return nil
+}
+
+// fileMasker returns a masker for one file of a dump directory: it shares
+// the run state of m but has a parser of its own.
+func (m *streamMasker) fileMasker(parser DialectParser) *streamMasker {
+	return &streamMasker{
+		parser:  parser,
+		rt:      m.rt,
+		config:  m.config,
+		cache:   m.cache,
+		workers: m.workers,
+	}
+}
+
+// rewriteDumpFile writes the file at inPath to outPath through mask. The
+// output keeps the gzip or zstd compression of the input, gzip at gzipLevel
+// (0 for the default), and its permissions.
+func rewriteDumpFile(inPath, outPath string, gzipLevel int, mask func(r io.Reader, w *bufio.Writer) error) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	data, format, err := openDumpInput(in)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = data.Close() }()
+	compression := outputCompression{format: format}
+	switch format {
+	case "", "zstd":
+	case "gzip":
+		compression.level = gzipLevel
+	default:
+		return fmt.Errorf("unexpected %s compression", format)
+	}
+
+	out, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+	var dest io.Writer = out
+	compressor, err := compression.writer(out)
+	if err != nil {
+		return err
+	}
+	if compressor != nil {
+		dest = compressor
+	}
+	sink := bufio.NewWriterSize(dest, defaultMaxBufferSize)
+	if err := mask(data, sink); err != nil {
+		return err
+	}
+	if err := sink.Flush(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// copyDumpFile copies a file unchanged, keeping its permissions.
+func copyDumpFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// tupleStreamer is implemented by parsers that accept an overlong INSERT
+// line cut into pieces after each VALUES tuple. streamLexer returns the
+// lexer for the VALUES list of a line starting with head, or false when the
+// line must be read whole.
+type tupleStreamer interface {
+	streamLexer(head string) (sqlLexer, bool)
+}
+
+// dumpReader splits the input into the pieces the parsers consume: whole
+// lines, except that an INSERT line longer than the reader buffer is cut
+// into its header ("INSERT INTO t VALUES ") and one piece per tuple with its
+// trailing separator. Parsers handle those pieces like a multi-line VALUES
+// list, so the output is the same as for the whole line while memory stays
+// bounded by the largest tuple instead of the line.
+type dumpReader struct {
+	r *bufio.Reader
+	// lexer decides whether an overlong line may be streamed.
+	lexer func(head string) (sqlLexer, bool)
+
+	// state of an overlong INSERT line being streamed
+	streaming bool
+	lex       sqlLexer
+	window    string
+	eof       bool
+}
+
+func newDumpReader(r io.Reader, size int, lexer func(head string) (sqlLexer, bool)) *dumpReader {
+	return &dumpReader{r: bufio.NewReaderSize(r, size), lexer: lexer}
+}
+
+// parserStreamLexer adapts a parser to dumpReader: only tuple streamers
+// stream.
+func parserStreamLexer(parser DialectParser) func(head string) (sqlLexer, bool) {
+	return func(head string) (sqlLexer, bool) {
+		if s, ok := parser.(tupleStreamer); ok {
+			return s.streamLexer(head)
+		}
+		return sqlLexer{}, false
+	}
+}
+
+// next returns the next piece of input. Like bufio.Reader.ReadString it
+// returns io.EOF together with the last piece.
+func (d *dumpReader) next() (string, error) {
+	if d.streaming {
+		return d.nextPiece()
+	}
+
+	chunk, err := d.r.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return string(chunk), err
+	}
+
+	head := string(chunk)
+	if lex, ok := d.lexer(head); ok {
+		if matches := sqlInsertRegex.FindStringSubmatchIndex(head); matches != nil {
+			d.streaming = true
+			d.lex = lex
+			d.window = head[matches[6]:]
+			return head[:matches[6]], nil
+		}
+	}
+	rest, err := d.r.ReadString('\n')
+	return head + rest, err
+}
+
+// nextPiece cuts the next piece of a streamed line out of the window,
+// reading more input while the piece is incomplete.
+func (d *dumpReader) nextPiece() (string, error) {
+	for {
+		if end, lineEnd, ok := d.pieceEnd(); ok {
+			piece := d.window[:end]
+			d.window = d.window[end:]
+			if lineEnd {
+				d.streaming = false
+			}
+			return piece, nil
+		}
+		if d.eof {
+			piece := d.window
+			d.window = ""
+			d.streaming = false
+			return piece, io.EOF
+		}
+		chunk, err := d.r.ReadSlice('\n')
+		d.window += string(chunk)
+		if err == io.EOF {
+			d.eof = true
+		} else if err != nil && err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+}
+
+// pieceEnd finds the end of the piece at the start of the window: a tuple
+// and the separators after it, plus a trailing clause up to the end of the
+// line. lineEnd reports that the piece ends the line. ok is false when the
+// window does not hold a complete piece yet.
+func (d *dumpReader) pieceEnd() (end int, lineEnd bool, ok bool) {
+	w := d.window
+	i := skipTupleSeparators(w, 0)
+	if i < len(w) && w[i] == '(' {
+		_, tupleEnd := d.lex.tuple(w, i)
+		if tupleEnd < 0 {
+			return 0, false, false
+		}
+		i = skipTupleSeparators(w, tupleEnd)
+	}
+	if i == len(w) {
+		return 0, false, false
+	}
+	switch w[i] {
+	case '\n':
+		return i + 1, true, true
+	case '(':
+		return i, false, true
+	}
+	// A trailing clause ("ON DUPLICATE KEY UPDATE ...") stays with the
+	// last tuple up to the end of the line.
+	if nl := strings.IndexByte(w[i:], '\n'); nl >= 0 {
+		return i + nl + 1, true, true
+	}
+	return 0, false, false
+}
+
+// skipTupleSeparators skips the bytes between VALUES tuples on one line.
+func skipTupleSeparators(s string, i int) int {
+	for i < len(s) {
+		switch s[i] {
+		case ' ', '\t', '\r', ',', ';':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// processStream runs input through a parser the way main does, with a
+// reader buffer of size bytes, and returns the output and the longest piece.
+func processStream(t *testing.T, parser DialectParser, config MaskConfig, input string, size int) (string, int) {
+	t.Helper()
+
+	reader := newDumpReader(strings.NewReader(input), size, parserStreamLexer(parser))
+	var out strings.Builder
+	longest := 0
+	for {
+		piece, err := reader.next()
+		if err != nil && err != io.EOF {
+			t.Fatalf("read failed: %v", err)
+		}
+		if len(piece) > longest {
+			longest = len(piece)
+		}
+		if piece != "" {
+			res, drop := parser.ProcessLine(piece, config, nil)
+			if !drop {
+				out.WriteString(res)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if fp, ok := parser.(flushableParser); ok {
+		out.WriteString(fp.Flush(config, nil))
+	}
+	return out.String(), longest
+}
+
+func TestDumpReaderStreamsLongInsertsIdentically(t *testing.T) {
+	var rows []string
+	for i := 0; i < 200; i++ {
+		rows = append(rows, "(1,'user"+strings.Repeat("x", i%7)+"@example.com','+7 912 345-67-89','it''s, \\'ok\\' (1)')")
+	}
+	values := strings.Join(rows, ",")
+
+	dumps := map[DumpDialect]string{
+		DialectMySQL: "-- MySQL dump 10.13\n" +
+			"CREATE TABLE `users` (\n  `id` int,\n  `email` varchar(255),\n  `phone` varchar(32),\n  `note` text\n);\n" +
+			"INSERT INTO `users` VALUES " + strings.ReplaceAll(values, "''", "\\'") + ";\n" +
+			"INSERT IGNORE INTO `shop`.`users` VALUES " + strings.ReplaceAll(values, "''", "\\'") + " ON DUPLICATE KEY UPDATE `email`='a@b.com';\n" +
+			"INSERT INTO `secrets` VALUES (1,'multi\nline secret@example.com'),(2,'x');\n" +
+			"INSERT INTO `secrets` VALUES " + strings.ReplaceAll(values, "''", "\\'") + ",(1,'multi\nline');\n" +
+			"INSERT INTO `raw` VALUES " + strings.ReplaceAll(values, "''", "\\'") + ";\n" +
+			"INSERT INTO `other` VALUES " + strings.ReplaceAll(values, "''", "\\'") + ";\n" +
+			"-- " + strings.Repeat("long comment mail@example.com ", 50) + "\n" +
+			"INSERT INTO `users` VALUES (1,'tail@example.com','','no newline')",
+		DialectOracle: "INSERT INTO users (id, email, phone, note) VALUES " + values + ";\n" +
+			"INSERT INTO secrets (id, note) VALUES " + values + ", (1, 'multi\nline');\n",
+	}
+	configs := map[string]func(){
+		"full-line": func() {},
+		"selective": func() {
+			ProcessingTables = map[string]TableConfig{
+				"users": {Email: []string{"email"}, Phone: []string{"phone"}},
+			}
+		},
+		"tables": func() {
+			ProcessingTables = map[string]TableConfig{
+				"users": {Email: []string{"email"}},
+			}
+			SkipTableList = map[string]struct{}{"secrets": {}}
+			NoMaskTableList = map[string]struct{}{"raw": {}}
+		},
+	}
+
+	for name, configure := range configs {
+		for dialect, dump := range dumps {
+			withTestGlobals(t, func() {
+				setupMaskingDefaults(t)
+				configure()
+
+				for _, parserDialect := range []DumpDialect{dialect, DialectAuto} {
+					lineRT := newTestRuntime()
+					lineRT.Stats = newRunStats()
+					want := processDump(t, NewDialectParser(parserDialect, lineRT), bothAlgorithms(), dump)
+
+					streamRT := newTestRuntime()
+					streamRT.Stats = newRunStats()
+					got, longest := processStream(t, NewDialectParser(parserDialect, streamRT), bothAlgorithms(), dump, 256)
+					if got != want {
+						t.Fatalf("%s/%s/%s: streamed output differs:\n got: %q\nwant: %q", name, dialect, parserDialect, got, want)
+					}
+					if parserDialect == dialect && longest > 2048 {
+						t.Fatalf("%s/%s: expected long INSERT lines cut into tuples, longest piece %d bytes", name, dialect, longest)
+					}
+					for table, stats := range lineRT.Stats.Tables {
+						streamed := streamRT.Stats.Tables[table]
+						if streamed == nil || streamed.RowsSeen != stats.RowsSeen || !reflect.DeepEqual(streamed.Masked, stats.Masked) {
+							t.Fatalf("%s/%s: stats of %s differ: %+v vs %+v", name, dialect, table, streamed, stats)
+						}
+					}
+				}
+			})
+		}
+	}
+}
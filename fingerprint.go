@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	fingerprintHeader = "# maskdump fingerprints v1"
+	fingerprintKeyID  = "# key_id "
+)
+
+// fingerprintSet holds one-way fingerprints of original values that were
+// masked. The set lets "maskdump verify" recognise a leaked original without
+// access to the cache, which maps originals to masks in the clear. The
+// fingerprints are keyed with the hash key, so they cannot be reversed by
+// hashing candidate values.
+type fingerprintSet struct {
+	mu    sync.Mutex
+	key   []byte
+	items map[string]struct{}
+}
+
+// newFingerprintSet returns an empty set keyed with the hash key. Without a
+// key a phone or email list would reverse every fingerprint, so it is
+// refused.
+func newFingerprintSet(key []byte) (*fingerprintSet, error) {
+	if key == nil {
+		return nil, errors.New("fingerprints need a hash key: set hash_key_file or hash_key_env")
+	}
+	return &fingerprintSet{key: key, items: make(map[string]struct{})}, nil
+}
+
+// fingerprint derives the fingerprint of one value of a data type.
+func (s *fingerprintSet) fingerprint(typeName, value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(typeName + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// fingerprintKeyName is the key fingerprint written to the file header.
+func fingerprintKeyName(key []byte) string {
+	return keyID(key, "hash")
+}
+
+// add records an original value. A nil set ignores the call.
+func (s *fingerprintSet) add(typeName, value string) {
+	if s == nil {
+		return
+	}
+	fp := s.fingerprint(typeName, value)
+	s.mu.Lock()
+	s.items[fp] = struct{}{}
+	s.mu.Unlock()
+}
+
+// contains reports whether a value was recorded as an original.
+func (s *fingerprintSet) contains(typeName, value string) bool {
+	if s == nil {
+		return false
+	}
+	fp := s.fingerprint(typeName, value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.items[fp]
+	return ok
+}
+
+// save writes the set sorted, one fingerprint per line, after a header that
+// names the key fingerprint.
+func (s *fingerprintSet) save(path string) error {
+	s.mu.Lock()
+	lines := make([]string, 0, len(s.items))
+	for fp := range s.items {
+		lines = append(lines, fp)
+	}
+	s.mu.Unlock()
+	sort.Strings(lines)
+
+	var b strings.Builder
+	b.WriteString(fingerprintHeader + "\n" + fingerprintKeyID + fingerprintKeyName(s.key) + "\n")
+	for _, fp := range lines {
+		b.WriteString(fp + "\n")
+	}
+	return writeFileAtomic(path, []byte(b.String()), 0600)
+}
+
+// loadFingerprints reads a file written by save. The file must have been
+// produced with the same hash key as the current config.
+func loadFingerprints(path string, key []byte) (*fingerprintSet, error) {
+	set, err := newFingerprintSet(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fingerprint file: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	want := fingerprintKeyName(key)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	keyChecked := false
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case lineNo == 1:
+			if line != fingerprintHeader {
+				return nil, fmt.Errorf("%s is not a maskdump fingerprint file", path)
+			}
+		case strings.HasPrefix(line, fingerprintKeyID):
+			if got := strings.TrimPrefix(line, fingerprintKeyID); got != want {
+				return nil, fmt.Errorf("fingerprint file %s was written with a different hash key", path)
+			}
+			keyChecked = true
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			set.items[line] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fingerprint file: %v", err)
+	}
+	if !keyChecked {
+		return nil, fmt.Errorf("fingerprint file %s has no key_id line", path)
+	}
+	return set, nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	algorithmFF1  = "ff1"
+	algorithmFF31 = "ff3-1"
+
+	// fpeDigits and fpeAlphanumeric are the alphabets of phone digits and
+	// email local parts; a character's index is its numeral.
+	fpeDigits       = "0123456789"
+	fpeAlphanumeric = fpeDigits + "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	// fpeMinDomain is the smallest domain size (radix^length) NIST SP
+	// 800-38G Rev. 1 allows: shorter inputs are too easy to tabulate.
+	fpeMinDomain = 1000000
+)
+
+// isFPEAlgorithm reports whether an algorithm name selects reversible
+// format-preserving encryption.
+func isFPEAlgorithm(algorithm string) bool {
+	return algorithm == algorithmFF1 || algorithm == algorithmFF31
+}
+
+// fpeCipher encrypts emails and phones with FF1 or FF3-1 (NIST SP 800-38G)
+// and decrypts them again. The AES-256 key is derived from the fpe key, so
+// anybody holding that key can reverse the masks and nobody else can.
+type fpeCipher struct {
+	algorithm string
+	// block is AES under the derived key (FF1); reversed is AES under the
+	// byte-reversed key, as FF3-1 specifies.
+	block    cipher.Block
+	reversed cipher.Block
+}
+
+// newFPECipher returns the cipher of an ff1 or ff3-1 algorithm keyed by
+// secret.
+func newFPECipher(algorithm string, secret []byte) (*fpeCipher, error) {
+	if !isFPEAlgorithm(algorithm) {
+		return nil, fmt.Errorf("unsupported format-preserving encryption algorithm: %s", algorithm)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("algorithm %s needs an encryption key: set fpe_key_file or fpe_key_env", algorithm)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("maskdump:fpe"))
+	return newFPECipherKey(algorithm, mac.Sum(nil))
+}
+
+// newFPECipherKey returns the cipher for a raw AES key.
+func newFPECipherKey(algorithm string, key []byte) (*fpeCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	reversedKey := append([]byte(nil), key...)
+	reverseBytes(reversedKey)
+	reversed, err := aes.NewCipher(reversedKey)
+	if err != nil {
+		return nil, err
+	}
+	return &fpeCipher{algorithm: algorithm, block: block, reversed: reversed}, nil
+}
+
+// email encrypts (or with decrypt, decrypts) the letters and digits of an
+// email's local part; the other characters and the domain stay. A local
+// part with too few of them for a safe domain takes the domain's letters
+// and digits along. ok is false when even that is too short.
+func (c *fpeCipher) email(value string, decrypt bool) (string, bool) {
+	at := strings.LastIndexByte(value, '@')
+	if at <= 0 {
+		return value, false
+	}
+	positions := alphabetPositions(value[:at], fpeAlphanumeric, nil)
+	if !fpeDomainFits(len(fpeAlphanumeric), len(positions)) {
+		positions = alphabetPositions(value, fpeAlphanumeric, nil)
+	}
+	return c.transformAt(value, positions, fpeAlphanumeric, EmailTypeName, decrypt)
+}
+
+// phone encrypts (or decrypts) the digits of a phone at the positions the
+// masking rule targets; the other digits and the formatting stay. When the
+// target selects too few digits for a safe domain every digit is
+// encrypted. ok is false when the value is too short even then.
+func (c *fpeCipher) phone(value string, rule MaskingRule, decrypt bool) (string, bool) {
+	digits := alphabetPositions(value, fpeDigits, nil)
+	var positions []int
+	for _, pos := range uniqueSorted(parseTargetPositions(rule.Target, len(digits))) {
+		positions = append(positions, digits[pos])
+	}
+	if !fpeDomainFits(len(fpeDigits), len(positions)) {
+		positions = digits
+	}
+	return c.transformAt(value, positions, fpeDigits, PhoneTypeName, decrypt)
+}
+
+// transformAt encrypts or decrypts the characters of value at the given
+// byte positions as one numeral string over alphabet.
+func (c *fpeCipher) transformAt(value string, positions []int, alphabet, tweak string, decrypt bool) (string, bool) {
+	radix := len(alphabet)
+	if !fpeDomainFits(radix, len(positions)) {
+		return value, false
+	}
+	numerals := make([]int, len(positions))
+	for i, pos := range positions {
+		numerals[i] = strings.IndexByte(alphabet, value[pos])
+	}
+	numerals = c.transform(radix, tweak, numerals, decrypt)
+	out := []byte(value)
+	for i, pos := range positions {
+		out[pos] = alphabet[numerals[i]]
+	}
+	return string(out), true
+}
+
+// transform runs the cipher over a numeral string. FF3-1 limits the input
+// length, so longer strings are split into chunks of nearly equal size,
+// each with its own tweak.
+func (c *fpeCipher) transform(radix int, tweak string, x []int, decrypt bool) []int {
+	if c.algorithm == algorithmFF1 {
+		return ff1(c.block, radix, []byte(tweak), x, decrypt)
+	}
+	maxLen := ff3MaxLen(radix)
+	chunks := (len(x) + maxLen - 1) / maxLen
+	sum := sha256.Sum256([]byte("maskdump:" + tweak))
+	out := make([]int, 0, len(x))
+	for i, start := 0, 0; i < chunks; i++ {
+		end := start + (len(x)-start)/(chunks-i)
+		var t [7]byte
+		copy(t[:], sum[:7])
+		t[6] ^= byte(i)
+		tl, tr := ff31Tweak(t)
+		out = append(out, ff3(c.reversed, radix, tl, tr, x[start:end], decrypt)...)
+		start = end
+	}
+	return out
+}
+
+// ff1 is FF1 of NIST SP 800-38G: a ten-round Feistel network over the
+// numeral string x with AES-CBC-MAC as the round function.
+func ff1(block cipher.Block, radix int, tweak []byte, x []int, decrypt bool) []int {
+	n := len(x)
+	u, v := n/2, n-n/2
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	radixV := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(v)), nil)
+	bLen := (new(big.Int).Sub(radixV, big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((bLen+3)/4) + 4
+	modulus := map[int]*big.Int{
+		u: new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(u)), nil),
+		v: radixV,
+	}
+
+	t := len(tweak)
+	p := []byte{1, 2, 1, byte(radix >> 16), byte(radix >> 8), byte(radix), 10, byte(u), 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(p[8:], uint32(n))
+	binary.BigEndian.PutUint32(p[12:], uint32(t))
+	pad := ((-t-bLen-1)%16 + 16) % 16
+	q := make([]byte, t+pad+1+bLen)
+	copy(q, tweak)
+
+	for i := 0; i < 10; i++ {
+		round, src := i, b
+		if decrypt {
+			round, src = 9-i, a
+		}
+		q[t+pad] = byte(round)
+		numeralValue(src, radix).FillBytes(q[t+pad+1:])
+
+		r := make([]byte, aes.BlockSize)
+		for _, data := range [][]byte{p, q} {
+			for j := 0; j < len(data); j += aes.BlockSize {
+				for k := range r {
+					r[k] ^= data[j+k]
+				}
+				block.Encrypt(r, r)
+			}
+		}
+		s := append([]byte(nil), r...)
+		for j := 1; len(s) < d; j++ {
+			next := append([]byte(nil), r...)
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], uint64(j))
+			for k := range counter {
+				next[8+k] ^= counter[k]
+			}
+			block.Encrypt(next, next)
+			s = append(s, next...)
+		}
+		y := new(big.Int).SetBytes(s[:d])
+
+		m := v
+		if round%2 == 0 {
+			m = u
+		}
+		if decrypt {
+			c := new(big.Int).Sub(numeralValue(b, radix), y)
+			a, b = numeralString(c.Mod(c, modulus[m]), radix, m), a
+		} else {
+			c := new(big.Int).Add(numeralValue(a, radix), y)
+			a, b = b, numeralString(c.Mod(c, modulus[m]), radix, m)
+		}
+	}
+	return append(a, b...)
+}
+
+// ff3 is the eight-round Feistel network of FF3 and FF3-1 (NIST SP
+// 800-38G); block is AES under the byte-reversed key and tl and tr are the
+// tweak halves.
+func ff3(block cipher.Block, radix int, tl, tr [4]byte, x []int, decrypt bool) []int {
+	n := len(x)
+	u, v := (n+1)/2, n/2
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+	modulus := map[int]*big.Int{
+		u: new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(u)), nil),
+		v: new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(v)), nil),
+	}
+
+	for i := 0; i < 8; i++ {
+		round, src := i, b
+		if decrypt {
+			round, src = 7-i, a
+		}
+		m, w := v, tl
+		if round%2 == 0 {
+			m, w = u, tr
+		}
+		var p [aes.BlockSize]byte
+		copy(p[:4], w[:])
+		p[3] ^= byte(round)
+		numeralValue(reversedNumerals(src), radix).FillBytes(p[4:])
+		reverseBytes(p[:])
+		block.Encrypt(p[:], p[:])
+		reverseBytes(p[:])
+		y := new(big.Int).SetBytes(p[:])
+
+		if decrypt {
+			c := new(big.Int).Sub(numeralValue(reversedNumerals(b), radix), y)
+			a, b = reversedNumerals(numeralString(c.Mod(c, modulus[m]), radix, m)), a
+		} else {
+			c := new(big.Int).Add(numeralValue(reversedNumerals(a), radix), y)
+			a, b = b, reversedNumerals(numeralString(c.Mod(c, modulus[m]), radix, m))
+		}
+	}
+	return append(a, b...)
+}
+
+// ff31Tweak splits the 56-bit FF3-1 tweak into the 32-bit halves of FF3.
+func ff31Tweak(t [7]byte) (tl, tr [4]byte) {
+	tl = [4]byte{t[0], t[1], t[2], t[3] & 0xf0}
+	tr = [4]byte{t[4], t[5], t[6], t[3] << 4}
+	return tl, tr
+}
+
+// ff3MaxLen is the longest numeral string FF3-1 accepts: 2*floor(log_radix(2^96)).
+func ff3MaxLen(radix int) int {
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	power := big.NewInt(int64(radix))
+	k := 0
+	for power.Cmp(limit) <= 0 {
+		power.Mul(power, big.NewInt(int64(radix)))
+		k++
+	}
+	return 2 * k
+}
+
+// fpeDomainFits reports whether numeral strings of length n over radix
+// form a domain of the allowed size.
+func fpeDomainFits(radix, n int) bool {
+	if n < 2 {
+		return false
+	}
+	domain := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(n)), nil)
+	return domain.Cmp(big.NewInt(fpeMinDomain)) >= 0
+}
+
+// alphabetPositions appends the byte positions of s whose character is in
+// alphabet.
+func alphabetPositions(s, alphabet string, positions []int) []int {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(alphabet, s[i]) >= 0 {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+func uniqueSorted(values []int) []int {
+	sort.Ints(values)
+	out := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// numeralValue is NUM_radix: the number a numeral string stands for, most
+// significant numeral first.
+func numeralValue(x []int, radix int) *big.Int {
+	n := new(big.Int)
+	r := big.NewInt(int64(radix))
+	for _, numeral := range x {
+		n.Mul(n, r).Add(n, big.NewInt(int64(numeral)))
+	}
+	return n
+}
+
+// numeralString is STR^m_radix: the m numerals of n, most significant
+// first.
+func numeralString(n *big.Int, radix, m int) []int {
+	out := make([]int, m)
+	r := big.NewInt(int64(radix))
+	rest := new(big.Int).Set(n)
+	digit := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		rest.DivMod(rest, r, digit)
+		out[i] = int(digit.Int64())
+	}
+	return out
+}
+
+func reversedNumerals(x []int) []int {
+	out := make([]int, len(x))
+	for i, numeral := range x {
+		out[len(x)-1-i] = numeral
+	}
+	return out
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
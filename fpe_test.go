@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fpeNumerals(s, alphabet string) []int {
+	out := make([]int, len(s))
+	for i := range s {
+		out[i] = strings.IndexByte(alphabet, s[i])
+	}
+	return out
+}
+
+func fpeTestCipher(t *testing.T, algorithm, keyHex string) *fpeCipher {
+	t.Helper()
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newFPECipherKey(algorithm, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// The vectors are the NIST SP 800-38G samples.
+func TestFF1Vectors(t *testing.T) {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	tests := []struct {
+		key, tweak  string
+		radix       int
+		plain, want string
+	}{
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "", 10, "0123456789", "2433477484"},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "39383736353433323130", 10, "0123456789", "6124200773"},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "3737373770717273373737", 36, "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+	}
+	for _, tt := range tests {
+		c := fpeTestCipher(t, algorithmFF1, tt.key)
+		tweak, _ := hex.DecodeString(tt.tweak)
+		got := ff1(c.block, tt.radix, tweak, fpeNumerals(tt.plain, alphabet), false)
+		if want := fpeNumerals(tt.want, alphabet); !reflect.DeepEqual(got, want) {
+			t.Fatalf("FF1(%s) = %v, want %v", tt.plain, got, want)
+		}
+		if back := ff1(c.block, tt.radix, tweak, got, true); !reflect.DeepEqual(back, fpeNumerals(tt.plain, alphabet)) {
+			t.Fatalf("FF1 decryption of %s gave %v", tt.want, back)
+		}
+	}
+}
+
+func TestFF3Vectors(t *testing.T) {
+	// FF3 sample with a 64-bit tweak, then an FF3-1 sample with a 56-bit one.
+	c := fpeTestCipher(t, algorithmFF31, "EF4359D8D580AA4F7F036D6F04FC6A94")
+	tl, tr := [4]byte{0xD8, 0xE7, 0x92, 0x0A}, [4]byte{0xFA, 0x33, 0x0A, 0x73}
+	plain := fpeNumerals("890121234567890000", fpeDigits)
+	got := ff3(c.reversed, 10, tl, tr, plain, false)
+	if want := fpeNumerals("750918814058654607", fpeDigits); !reflect.DeepEqual(got, want) {
+		t.Fatalf("FF3 = %v, want %v", got, want)
+	}
+	if back := ff3(c.reversed, 10, tl, tr, got, true); !reflect.DeepEqual(back, plain) {
+		t.Fatalf("FF3 decryption gave %v", back)
+	}
+
+	c = fpeTestCipher(t, algorithmFF31, "2DE79D232DF5585D68CE47882AE256D6")
+	tl, tr = ff31Tweak([7]byte{0xCB, 0xD0, 0x92, 0x80, 0x97, 0x95, 0x64})
+	got = ff3(c.reversed, 10, tl, tr, fpeNumerals("3992520240", fpeDigits), false)
+	if want := fpeNumerals("8901801106", fpeDigits); !reflect.DeepEqual(got, want) {
+		t.Fatalf("FF3-1 = %v, want %v", got, want)
+	}
+}
+
+func TestFPERoundTripsEmailsAndPhones(t *testing.T) {
+	rule := MaskingRule{Target: "2,3,5,6,8,10", Value: "hash"}
+	for _, algorithm := range []string{algorithmFF1, algorithmFF31} {
+		c, err := newFPECipher(algorithm, []byte("0123456789abcdef"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, email := range []string{"ivan.petrov@yandex.ru", "ab@x.io", strings.Repeat("a1", 40) + "@example.com"} {
+			masked, ok := c.email(email, false)
+			if !ok || masked == email || len(masked) != len(email) {
+				t.Fatalf("%s %s: got %q, %v", algorithm, email, masked, ok)
+			}
+			if back, ok := c.email(masked, true); !ok || back != email {
+				t.Fatalf("%s %s: decrypted %q back to %q", algorithm, email, masked, back)
+			}
+		}
+		masked, _ := c.email("ivan.petrov@yandex.ru", false)
+		if masked[4] != '.' || !strings.HasSuffix(masked, "@yandex.ru") {
+			t.Fatalf("%s: expected separators and domain kept, got %q", algorithm, masked)
+		}
+		if short, _ := c.email("ab@x.io", false); short[2] != '@' || short[4] != '.' {
+			t.Fatalf("%s: expected a short local part encrypted with its domain, got %q", algorithm, short)
+		}
+
+		phone := "+7 (916) 555-12-34"
+		masked, ok := c.phone(phone, rule, false)
+		if !ok || masked == phone || stripDigits(masked) != stripDigits(phone) || masked[1] != '7' || masked[6] != '6' || masked[17] != '4' {
+			t.Fatalf("%s: expected only the target digits encrypted, got %q", algorithm, masked)
+		}
+		if back, ok := c.phone(masked, rule, true); !ok || back != phone {
+			t.Fatalf("%s: decrypted %q back to %q", algorithm, masked, back)
+		}
+		if _, ok := c.phone("12-34", rule, false); ok {
+			t.Fatalf("%s: expected a four-digit value refused", algorithm)
+		}
+	}
+
+	ff1, _ := newFPECipher(algorithmFF1, []byte("0123456789abcdef"))
+	other, _ := newFPECipher(algorithmFF1, []byte("fedcba9876543210"))
+	a, _ := ff1.email("ivan.petrov@yandex.ru", false)
+	b, _ := other.email("ivan.petrov@yandex.ru", false)
+	if a == b {
+		t.Fatalf("expected another key to give another mask, got %q twice", a)
+	}
+	if _, err := newFPECipher(algorithmFF1, nil); err == nil || !strings.Contains(err.Error(), "fpe_key_file") {
+		t.Fatalf("expected a missing key refused, got %v", err)
+	}
+}
+
+func TestRuntimeMasksWithFPE(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}, Phone: []string{"phone"}},
+		}
+		key := []byte("0123456789abcdef")
+		config := MaskConfig{emailAlgorithm: algorithmFF1, phoneAlgorithm: algorithmFF31}
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		if err := rt.useFPE(config, key); err != nil {
+			t.Fatal(err)
+		}
+
+		dump := "INSERT INTO `users` (`id`, `email`, `phone`) VALUES (1,'test@example.com','+7 916 555-12-34');\n"
+		out := processDump(t, NewDialectParser(DialectMySQL, rt), config, dump)
+		values := newSQLLexer(DialectMySQL).tupleValues(out[strings.Index(out, "VALUES")+len("VALUES"):])
+		if len(values) != 1 || len(values[0]) != 3 {
+			t.Fatalf("unexpected output %q", out)
+		}
+		email, phone := strings.Trim(values[0][1], "'"), strings.Trim(values[0][2], "'")
+		if email == "test@example.com" || !strings.HasSuffix(email, "@example.com") || phone == "+7 916 555-12-34" {
+			t.Fatalf("expected both values encrypted, got %q", out)
+		}
+
+		emailCipher, _ := newFPECipher(algorithmFF1, key)
+		phoneCipher, _ := newFPECipher(algorithmFF31, key)
+		if original, _ := emailCipher.email(email, true); original != "test@example.com" {
+			t.Fatalf("expected the email to decrypt, got %q", original)
+		}
+		if original, _ := phoneCipher.phone(phone, AppConfig.Masking.Phone, true); original != "+7 916 555-12-34" {
+			t.Fatalf("expected the phone to decrypt, got %q", original)
+		}
+		if stats := rt.Stats.Tables["users"]; stats.Masked[EmailTypeName] != 1 || stats.Masked[PhoneTypeName] != 1 || stats.CacheMisses != 0 {
+			t.Fatalf("expected encrypted values counted without the cache, got %+v", stats)
+		}
+
+		if err := newTestRuntime().useFPE(config, nil); err == nil || !strings.Contains(err.Error(), "--mask-email") {
+			t.Fatalf("expected ff1 without an fpe key refused, got %v", err)
+		}
+	})
+}
@@ -1,3 +1,11 @@
 module github.com/intaro/maskdump
 
 go 1.26.0
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.9
+	go.etcd.io/bbolt v1.4.3
+)
+
+require golang.org/x/sys v0.29.0 // indirect
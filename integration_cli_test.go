@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -9,6 +11,10 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	bolt "go.etcd.io/bbolt"
 )
 
 type integrationFixture struct {
@@ -70,6 +76,376 @@ func TestCLIIntegrationFixtures(t *testing.T) {
 	}
 }
 
+// cliRunner runs the maskdump binary with both masking algorithms, no cache
+// and the integration config extended by a masking_tables section.
+type cliRunner func(stdin []byte, args ...string) (stdout, stderr string, err error)
+
+func newCLIRunner(t *testing.T, maskingTables string) (cliRunner, string) {
+	t.Helper()
+
+	binaryPath := buildMaskdumpBinary(t)
+	runtimeDir := t.TempDir()
+	configPath := filepath.Join(runtimeDir, "integration.conf")
+	writeIntegrationConfig(t, configPath, runtimeDir)
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	content = bytes.Replace(content, []byte(`"logging"`), []byte(`"masking_tables": `+maskingTables+`,
+  "logging"`), 1)
+	if err := os.WriteFile(configPath, content, 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	return runCLI(binaryPath, configPath, runtimeDir), runtimeDir
+}
+
+// newCLIConfigRunner is newCLIRunner with config written as given, every
+// __RUNTIME_DIR__ replaced by the directory of the run.
+func newCLIConfigRunner(t *testing.T, config string) (cliRunner, string) {
+	t.Helper()
+
+	binaryPath := buildMaskdumpBinary(t)
+	runtimeDir := t.TempDir()
+	configPath := filepath.Join(runtimeDir, "integration.conf")
+	config = strings.ReplaceAll(config, "__RUNTIME_DIR__", filepath.ToSlash(runtimeDir))
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	return runCLI(binaryPath, configPath, runtimeDir), runtimeDir
+}
+
+func runCLI(binaryPath, configPath, runtimeDir string) cliRunner {
+	return func(stdin []byte, args ...string) (string, string, error) {
+		cmd := exec.Command(binaryPath, append([]string{"--config", configPath, "--mask-email=light-hash", "--mask-phone=light-mask", "--no-cache"}, args...)...)
+		cmd.Env = append(os.Environ(), "HOME="+runtimeDir, "XDG_STATE_HOME="+filepath.Join(runtimeDir, "state"))
+		cmd.Stdin = bytes.NewReader(stdin)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+}
+
+func readDumpFixture(t *testing.T, dialect, name string) []byte {
+	t.Helper()
+
+	input, err := os.ReadFile(filepath.Join(repoRoot(t), "testdata", "dump", dialect, name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return input
+}
+
+func TestCLIStrictModeWritesNoPartialDump(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"tst_users": {"email": ["email"]}}`)
+	input := readDumpFixture(t, "postgresql", "multi_dump.sql")
+
+	plain, _, err := run(input)
+	if err != nil {
+		t.Fatalf("maskdump failed: %v", err)
+	}
+	strict, stderr, err := run(input, "--strict")
+	if err != nil {
+		t.Fatalf("strict run of a fully parsable dump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if strict != plain {
+		t.Fatal("expected strict mode output identical to the normal run")
+	}
+
+	// A configured table whose COPY column list cannot be parsed, late in
+	// the dump: nothing may be written.
+	broken := append(append([]byte{}, input...), []byte("COPY public.tst_users (id, ) FROM stdin;\n9\tleak@example.com\n\\.\n")...)
+	outputPath := filepath.Join(runtimeDir, "masked.sql")
+	stdout, stderr, err := run(broken, "--strict", "--output", outputPath)
+	if err == nil {
+		t.Fatal("expected strict mode to fail")
+	}
+	if !strings.Contains(stderr, "strict mode: cannot parse COPY column list") {
+		t.Fatalf("expected a clear strict mode error, got: %s", stderr)
+	}
+	if stdout != "" {
+		t.Fatalf("expected no output on stdout, got: %s", stdout)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(runtimeDir, "*masked.sql*")); len(entries) != 0 {
+		t.Fatalf("expected no output file, got: %v", entries)
+	}
+
+	stdout, _, err = run(broken, "--strict")
+	if err == nil || stdout != "" {
+		t.Fatalf("expected strict mode to fail without output on stdout, got err=%v, stdout=%q", err, stdout)
+	}
+}
+
+func TestCLIFailOnUnmatchedConfig(t *testing.T) {
+	run, _ := newCLIRunner(t, `{"tst_users": {"email": ["email", "e_mail"]}, "tst_userz": {"phone": ["phone"]}}`)
+	input := readDumpFixture(t, "postgresql", "multi_dump.sql")
+
+	_, stderr, err := run(input)
+	if err != nil {
+		t.Fatalf("expected only warnings by default, got: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		`Warning: masking_tables.tst_userz: table never seen in the dump data`,
+		`Warning: masking_tables.tst_users: email column "e_mail" never resolved to a position`,
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Fatalf("expected %q in the summary, got: %s", want, stderr)
+		}
+	}
+
+	_, stderr, err = run(input, "--fail-on-unmatched")
+	if err == nil || !strings.Contains(stderr, "2 masking_tables entries did not match the dump") {
+		t.Fatalf("expected failure with --fail-on-unmatched, got err=%v, stderr=%s", err, stderr)
+	}
+}
+
+func TestCLIFingerprintsNeedHashKey(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"tst_users": {"email": ["email"]}}`)
+	input := readDumpFixture(t, "postgresql", "multi_dump.sql")
+
+	fingerprintPath := filepath.Join(runtimeDir, "originals.fp")
+	stdout, stderr, err := run(input, "--fingerprints", fingerprintPath)
+	if err == nil || stdout != "" || !strings.Contains(stderr, "--fingerprints: fingerprints need a hash key") {
+		t.Fatalf("expected --fingerprints without a hash key refused, got err=%v, stdout=%q, stderr=%s", err, stdout, stderr)
+	}
+	if _, err := os.Stat(fingerprintPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no fingerprint file, got: %v", err)
+	}
+}
+
+func TestCLICompressedInputAndOutput(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"tst_users": {"email": ["email"]}}`)
+	input := readDumpFixture(t, "mysql", "multi_dump.sql")
+
+	plain, _, err := run(input)
+	if err != nil {
+		t.Fatalf("maskdump failed: %v", err)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(input)
+	_ = zw.Close()
+
+	outputPath := filepath.Join(runtimeDir, "masked.sql.zst")
+	if _, stderr, err := run(gz.Bytes(), "--output", outputPath, "--output-compression=zstd", "--output-compression-level=19"); err != nil {
+		t.Fatalf("maskdump failed on gzip input: %v\nstderr:\n%s", err, stderr)
+	}
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		t.Fatalf("output is not zstd: %v", err)
+	}
+	defer zr.Close()
+	masked, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress output: %v", err)
+	}
+	if string(masked) != plain {
+		t.Fatal("expected compressed round trip to match the plain run")
+	}
+
+	if _, stderr, err := run(input, "--output-compression=lz4"); err == nil || !strings.Contains(stderr, "unsupported output compression") {
+		t.Fatalf("expected unknown compression rejected, got err=%v, stderr=%s", err, stderr)
+	}
+}
+
+func TestCLIWorkersMatchSerialOutput(t *testing.T) {
+	run, _ := newCLIRunner(t, `{"tst_users": {"email": ["email"], "phone": ["phone"]}}`)
+	input := bytes.Repeat(readDumpFixture(t, "postgresql", "multi_dump.sql"), 200)
+
+	serial, stderr, err := run(input, "--workers=1")
+	if err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	parallel, stderr, err := run(input, "--workers=8")
+	if err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if parallel != serial {
+		t.Fatal("expected parallel output identical to the serial run")
+	}
+
+	if _, stderr, err := run(input, "--workers=-1"); err == nil || !strings.Contains(stderr, "--workers must not be negative") {
+		t.Fatalf("expected a negative worker count rejected, got err=%v, stderr=%s", err, stderr)
+	}
+}
+
+// requireStrictFailure runs input with --strict on one and on several
+// workers and checks that both runs fail with want and write nothing.
+func requireStrictFailure(t *testing.T, run cliRunner, input, want string, args ...string) {
+	t.Helper()
+
+	for _, workers := range []string{"--workers=1", "--workers=4"} {
+		stdout, stderr, err := run([]byte(input), append([]string{"--db-format=mysql", "--strict", workers}, args...)...)
+		if err == nil || stdout != "" || !strings.Contains(stderr, want) {
+			t.Fatalf("expected %s --strict to fail with %q without output, got err=%v, stdout=%q, stderr=%s", workers, want, err, stdout, stderr)
+		}
+	}
+}
+
+func TestCLIWorkersReportUnparsableJSON(t *testing.T) {
+	run, _ := newCLIRunner(t, `{"u": {"email": ["email"], "profile": {"json": {"contact": "email"}}}}`)
+
+	// The JSON column is masked by a job on a worker, after the parsing
+	// loop has seen the whole input.
+	requireStrictFailure(t, run, "INSERT INTO u (id,email,profile) VALUES (1,'a@example.com',123);\n",
+		"JSON value of column profile is not a string literal")
+	requireStrictFailure(t, run, "INSERT INTO u (id,profile) VALUES (1,'{\"contact\": \"a@example.com\"'),(2,'{bad');\n",
+		"JSON value of column profile cannot be parsed")
+}
+
+func TestCLIWorkersReportUnparsablePHP(t *testing.T) {
+	run, _ := newCLIRunner(t, `{"u": {"options": {"php": ["email"]}}}`)
+	requireStrictFailure(t, run, "INSERT INTO u (id,options) VALUES (1,'s:13:\"a@example.com\";'),(2,'a:1:{s:5:\"email\"');\n",
+		"PHP serialize() value of column options cannot be parsed")
+}
+
+func TestCLIWorkersReportShortFPEValues(t *testing.T) {
+	// The phone regex accepts four digits, too few to encrypt even as a
+	// whole.
+	run, runtimeDir := newCLIConfigRunner(t, `{
+  "cache_path": "__RUNTIME_DIR__/cache/cache.json",
+  "phone_regex": "\\b\\d{2}-\\d{2}\\b",
+  "fpe_key_file": "__RUNTIME_DIR__/fpe.key",
+  "masking_tables": {"u": {"phone": ["phone"]}},
+  "logging": {"path": "__RUNTIME_DIR__/logs/maskdump.log", "level": "error"}
+}`)
+	if err := os.WriteFile(filepath.Join(runtimeDir, "fpe.key"), []byte("0123456789abcdef0123456789abcdef\n"), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	requireStrictFailure(t, run, "INSERT INTO u (id,phone) VALUES (1,'12-34');\n",
+		"phone value is too short for format-preserving encryption", "--mask-phone=ff1")
+}
+
+// collidingEmailsConfig masks every email of the same domain to the same
+// base mask.
+const collidingEmailsConfig = `{
+  "cache_path": "__RUNTIME_DIR__/cache/cache.json",
+  "masking": {"email": {"target": "username:1-", "value": "*"}},
+  "masking_tables": {"u": {"email": ["email"]}},
+  "logging": {"path": "__RUNTIME_DIR__/logs/maskdump.log", "level": "error"}
+}`
+
+func TestCLIWorkersFailOnCollision(t *testing.T) {
+	run, _ := newCLIConfigRunner(t, collidingEmailsConfig)
+
+	input := []byte("INSERT INTO u (id,email) VALUES (1,'alice@example.com'),(2,'bobby@example.com');\n")
+	for _, workers := range []string{"--workers=1", "--workers=4"} {
+		stdout, stderr, err := run(input, "--db-format=mysql", "--no-cache=false", "--fail-on-collision", workers)
+		if err == nil || stdout != "" || !strings.Contains(stderr, "--fail-on-collision: email masks collide") {
+			t.Fatalf("expected %s --fail-on-collision to fail without output, got err=%v, stdout=%q, stderr=%s", workers, err, stdout, stderr)
+		}
+	}
+
+	// Without the cache no collision could be found.
+	stdout, stderr, err := run(input, "--db-format=mysql", "--fail-on-collision")
+	if err == nil || stdout != "" || !strings.Contains(stderr, "--fail-on-collision cannot be used with --no-cache") {
+		t.Fatalf("expected --fail-on-collision refused with --no-cache, got err=%v, stdout=%q, stderr=%s", err, stdout, stderr)
+	}
+}
+
+func TestCLIWorkersResolveCollisionsAsSerial(t *testing.T) {
+	run, runtimeDir := newCLIConfigRunner(t, collidingEmailsConfig)
+
+	// Every email collides with the others, over many batches.
+	var input bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		input.WriteString("INSERT INTO u (id,email) VALUES (" + strconv.Itoa(i) + ",'user" + strconv.Itoa(i) + "@example.com');\n")
+	}
+
+	var want, wantStats string
+	for _, workers := range []string{"--workers=1", "--workers=2", "--workers=8"} {
+		cachePath := filepath.Join(runtimeDir, "cache", "cache.json")
+		if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+			t.Fatalf("failed to remove cache: %v", err)
+		}
+		statsPath := filepath.Join(runtimeDir, "stats"+workers[len("--workers="):]+".json")
+		stdout, stderr, err := run(input.Bytes(), "--db-format=mysql", "--no-cache=false", "--stats="+statsPath, workers)
+		if err != nil {
+			t.Fatalf("%s failed: %v\n%s", workers, err, stderr)
+		}
+		stats, err := os.ReadFile(statsPath)
+		if err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+		if want == "" {
+			want, wantStats = stdout, string(stats)
+			if !strings.Contains(want, "'*****@example.com'") || !strings.Contains(want, "'*****-") {
+				t.Fatalf("expected plain and tie-broken masks, got %.200q", want)
+			}
+			continue
+		}
+		if stdout != want {
+			t.Fatalf("expected %s output byte-identical to --workers=1", workers)
+		}
+		if string(stats) != wantStats {
+			t.Fatalf("expected %s stats identical to --workers=1, got\n%s\nwant\n%s", workers, stats, wantStats)
+		}
+	}
+}
+
+func TestCLIRefusesModifiedDiskCache(t *testing.T) {
+	run, runtimeDir := newCLIConfigRunner(t, `{
+  "cache_path": "__RUNTIME_DIR__/cache.db",
+  "cache_backend": "disk",
+  "cache_key_file": "__RUNTIME_DIR__/cache.key",
+  "masking_tables": {"u": {"email": ["email"]}},
+  "logging": {"path": "__RUNTIME_DIR__/logs/maskdump.log", "level": "error"}
+}`)
+	if err := os.WriteFile(filepath.Join(runtimeDir, "cache.key"), []byte("cache-secret-0123456789\n"), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	input := []byte("INSERT INTO u (id,email) VALUES (1,'alice@example.com');\n")
+	if _, stderr, err := run(input, "--db-format=mysql", "--no-cache=false"); err != nil {
+		t.Fatalf("maskdump failed: %v\n%s", err, stderr)
+	}
+
+	cachePath := filepath.Join(runtimeDir, "cache.db")
+	db, err := bolt.Open(cachePath, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(EmailTypeName))
+		return bucket.ForEach(func(k, v []byte) error {
+			v = append([]byte(nil), v...)
+			v[len(v)-1] ^= 1
+			return bucket.Put(k, v)
+		})
+	})
+	if err != nil {
+		t.Fatalf("failed to modify disk cache: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close disk cache: %v", err)
+	}
+
+	stdout, stderr, err := run(input, "--db-format=mysql", "--no-cache=false")
+	if err == nil || stdout != "" || !strings.Contains(stderr, "disk cache entry was modified") {
+		t.Fatalf("expected masking to fail on a modified cache entry, got err=%v, stdout=%q, stderr=%s", err, stdout, stderr)
+	}
+
+	// verify reads the originals from the same cache.
+	cmd := exec.Command(buildMaskdumpBinary(t), "verify", "--config", filepath.Join(runtimeDir, "integration.conf"), "--db-format=mysql")
+	cmd.Stdin = bytes.NewReader(input)
+	var verifyErr bytes.Buffer
+	cmd.Stderr = &verifyErr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 || !strings.Contains(verifyErr.String(), "disk cache entry was modified") {
+		t.Fatalf("expected verify to exit 2 on a modified cache entry, got err=%v, stderr=%s", err, verifyErr.String())
+	}
+}
+
 func buildMaskdumpBinary(t *testing.T) string {
 	t.Helper()
 
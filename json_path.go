@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// jsonPathStep is one step of a JSON path: an object key or an array index.
+// any matches every key or index ("*" and "[*]").
+type jsonPathStep struct {
+	key   string
+	index int
+	array bool
+	any   bool
+}
+
+// parseJSONPath parses a path such as "user.contacts[*].email" or
+// "$.items[0].phone". A leading "$." is optional.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if rest == "" {
+		return nil, errors.New("empty path")
+	}
+	var steps []jsonPathStep
+	for _, part := range strings.Split(rest, ".") {
+		key, indexes, hasIndex := strings.Cut(part, "[")
+		switch {
+		case key == "*":
+			steps = append(steps, jsonPathStep{any: true})
+		case key != "":
+			steps = append(steps, jsonPathStep{key: key})
+		case !hasIndex:
+			return nil, errors.New("empty key")
+		}
+		if !hasIndex {
+			continue
+		}
+		if !strings.HasSuffix(indexes, "]") {
+			return nil, fmt.Errorf("unclosed index in %q", part)
+		}
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			if index == "*" {
+				steps = append(steps, jsonPathStep{array: true, any: true})
+				continue
+			}
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid index [%s]", index)
+			}
+			steps = append(steps, jsonPathStep{array: true, index: n})
+		}
+	}
+	return steps, nil
+}
+
+// jsonPathRule masks the string values at or below a configured path with
+// the given data types.
+type jsonPathRule struct {
+	// name is the configured path reported to the coverage, "" for rules
+	// not tracked per path: the rule that masks every string and the rules
+	// of JSON columns, which count as covered with their column.
+	name  string
+	steps []jsonPathStep
+	types []*DataType
+	// seen is set once the path matched a value, for the coverage report.
+	seen atomic.Bool
+}
+
+// matches reports whether the rule covers the value at path: a rule for an
+// object or array covers every value inside it.
+func (r *jsonPathRule) matches(path []jsonPathStep) bool {
+	if len(r.steps) > len(path) {
+		return false
+	}
+	for i, step := range r.steps {
+		at := path[i]
+		if step.array != at.array {
+			return false
+		}
+		if step.any {
+			continue
+		}
+		if step.array && step.index != at.index || !step.array && step.key != at.key {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonPathRules builds the rules of a masking_tables entry whose columns
+// are JSON paths. Invalid paths are reported and ignored.
+func jsonPathRules(rt *Runtime, tableKey string, tableConfig TableConfig, config MaskConfig) []*jsonPathRule {
+	var rules []*jsonPathRule
+	byPath := make(map[string]*jsonPathRule)
+	for _, dt := range rt.activeTypes(config) {
+		for _, path := range tableConfig.columnsFor(dt.Name) {
+			rule := byPath[path]
+			if rule == nil {
+				steps, err := parseJSONPath(path)
+				if err != nil {
+					rt.reportUnmasked("masking_tables.%s: invalid JSON path %q (%v): it masks nothing", tableKey, path, err)
+					continue
+				}
+				rule = &jsonPathRule{name: path, steps: steps}
+				byPath[path] = rule
+				rules = append(rules, rule)
+			}
+			rule.types = append(rule.types, dt)
+		}
+	}
+	return rules
+}
+
+// jsonColumnRules builds the rules of a JSON column from its path to data
+// type map. Paths are validated with the config; types disabled for this
+// run are left out.
+func jsonColumnRules(paths map[string]string, active []*DataType) []*jsonPathRule {
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+	var rules []*jsonPathRule
+	for _, path := range names {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			continue
+		}
+		for _, dt := range active {
+			if dt.Name == paths[path] {
+				rules = append(rules, &jsonPathRule{steps: steps, types: []*DataType{dt}})
+			}
+		}
+	}
+	return rules
+}
+
+// newJSONColumn returns the masker of a JSON column, nil when none of its
+// paths has an active data type.
+func newJSONColumn(name string, paths map[string]string, active []*DataType) *documentColumn {
+	rules := jsonColumnRules(paths, active)
+	if len(rules) == 0 {
+		return nil
+	}
+	return &documentColumn{name: name, format: "JSON", rewrite: func(rt *Runtime, doc string, cache *Cache, stats *tableStats) (string, error) {
+		return maskJSON(rt, doc, "", rules, cache, stats)
+	}}
+}
+
+// maskJSON masks the string and number values of the JSON document doc that
+// the rules cover, a number by its text. Everything else, key order and
+// formatting included, keeps its exact text; masked strings are encoded
+// again, and a masked number stays a number unless its mask is no JSON
+// number, which then becomes a string.
+func maskJSON(rt *Runtime, doc string, tableKey string, rules []*jsonPathRule, cache *Cache, stats *tableStats) (string, error) {
+	return rewriteJSONValues(doc, func(path []jsonPathStep, raw string) string {
+		var value, masked string
+		number := raw[0] != '"'
+		decoded := false
+		for _, rule := range rules {
+			if !rule.matches(path) {
+				continue
+			}
+			if rule.name != "" && !rule.seen.Swap(true) {
+				rt.Coverage.markColumn(tableKey, rule.name)
+			}
+			if !decoded {
+				value = raw
+				if !number {
+					var ok bool
+					if value, ok = jsonStringValue(raw); !ok {
+						return raw
+					}
+				}
+				masked, decoded = value, true
+			}
+			for _, dt := range rule.types {
+				masked = rt.maskMatches(dt, masked, cache, stats)
+			}
+		}
+		if masked == value {
+			return raw
+		}
+		if number && isJSONNumber(masked) {
+			return masked
+		}
+		return encodeJSONString(masked)
+	})
+}
+
+// isJSONNumber reports whether s is the text of a JSON number.
+func isJSONNumber(s string) bool {
+	return s != "" && (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s))
+}
+
+// jsonStringValue decodes the raw, quoted text of a JSON string.
+func jsonStringValue(raw string) (string, bool) {
+	if !strings.Contains(raw, `\`) {
+		return raw[1 : len(raw)-1], true
+	}
+	var s string
+	return s, json.Unmarshal([]byte(raw), &s) == nil
+}
+
+// encodeJSONString encodes s as a JSON string without HTML escaping.
+func encodeJSONString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonRewriter copies a JSON document, passing each string and number value
+// (not object keys) through visit with its path.
+type jsonRewriter struct {
+	s     string
+	pos   int
+	out   strings.Builder
+	path  []jsonPathStep
+	visit func(path []jsonPathStep, raw string) string
+}
+
+// rewriteJSONValues returns doc with every string and number value replaced
+// by what visit returns for its raw text, quoted for strings.
+func rewriteJSONValues(doc string, visit func(path []jsonPathStep, raw string) string) (string, error) {
+	w := &jsonRewriter{s: doc, visit: visit}
+	w.out.Grow(len(doc))
+	w.space()
+	if err := w.value(); err != nil {
+		return "", err
+	}
+	w.space()
+	if w.pos < len(w.s) {
+		return "", fmt.Errorf("unexpected %q after the value at offset %d", w.s[w.pos], w.pos)
+	}
+	return w.out.String(), nil
+}
+
+func (w *jsonRewriter) space() {
+	start := w.pos
+	for w.pos < len(w.s) && strings.IndexByte(" \t\r\n", w.s[w.pos]) >= 0 {
+		w.pos++
+	}
+	w.out.WriteString(w.s[start:w.pos])
+}
+
+func (w *jsonRewriter) value() error {
+	if w.pos == len(w.s) {
+		return errors.New("unexpected end of input")
+	}
+	switch w.s[w.pos] {
+	case '{':
+		return w.object()
+	case '[':
+		return w.array()
+	case '"':
+		raw, err := w.str()
+		if err != nil {
+			return err
+		}
+		w.out.WriteString(w.visit(w.path, raw))
+		return nil
+	}
+	start := w.pos
+	for w.pos < len(w.s) && strings.IndexByte(",:]} \t\r\n{[\"", w.s[w.pos]) < 0 {
+		w.pos++
+	}
+	text := w.s[start:w.pos]
+	if !json.Valid([]byte(text)) {
+		return fmt.Errorf("invalid value at offset %d", start)
+	}
+	if isJSONNumber(text) {
+		text = w.visit(w.path, text)
+	}
+	w.out.WriteString(text)
+	return nil
+}
+
+func (w *jsonRewriter) object() error {
+	w.out.WriteByte('{')
+	w.pos++
+	w.space()
+	if w.pos < len(w.s) && w.s[w.pos] == '}' {
+		w.out.WriteByte('}')
+		w.pos++
+		return nil
+	}
+	for {
+		if w.pos == len(w.s) || w.s[w.pos] != '"' {
+			return fmt.Errorf("expected an object key at offset %d", w.pos)
+		}
+		raw, err := w.str()
+		if err != nil {
+			return err
+		}
+		key, ok := jsonStringValue(raw)
+		if !ok {
+			return fmt.Errorf("invalid object key at offset %d", w.pos-len(raw))
+		}
+		w.out.WriteString(raw)
+		w.space()
+		if err := w.expect(':'); err != nil {
+			return err
+		}
+		w.space()
+		w.path = append(w.path, jsonPathStep{key: key})
+		err = w.value()
+		w.path = w.path[:len(w.path)-1]
+		if err != nil {
+			return err
+		}
+		w.space()
+		if w.pos < len(w.s) && w.s[w.pos] == '}' {
+			w.out.WriteByte('}')
+			w.pos++
+			return nil
+		}
+		if err := w.expect(','); err != nil {
+			return err
+		}
+		w.space()
+	}
+}
+
+func (w *jsonRewriter) array() error {
+	w.out.WriteByte('[')
+	w.pos++
+	w.space()
+	if w.pos < len(w.s) && w.s[w.pos] == ']' {
+		w.out.WriteByte(']')
+		w.pos++
+		return nil
+	}
+	for i := 0; ; i++ {
+		w.path = append(w.path, jsonPathStep{array: true, index: i})
+		err := w.value()
+		w.path = w.path[:len(w.path)-1]
+		if err != nil {
+			return err
+		}
+		w.space()
+		if w.pos < len(w.s) && w.s[w.pos] == ']' {
+			w.out.WriteByte(']')
+			w.pos++
+			return nil
+		}
+		if err := w.expect(','); err != nil {
+			return err
+		}
+		w.space()
+	}
+}
+
+// str returns the raw text of the string starting at pos, quotes included.
+func (w *jsonRewriter) str() (string, error) {
+	start := w.pos
+	for i := w.pos + 1; i < len(w.s); i++ {
+		switch w.s[i] {
+		case '\\':
+			i++
+		case '"':
+			w.pos = i + 1
+			return w.s[start:w.pos], nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func (w *jsonRewriter) expect(c byte) error {
+	if w.pos == len(w.s) || w.s[w.pos] != c {
+		return fmt.Errorf("expected %q at offset %d", c, w.pos)
+	}
+	w.out.WriteByte(c)
+	w.pos++
+	return nil
+}
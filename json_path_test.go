@@ -0,0 +1,163 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	for path, want := range map[string][]jsonPathStep{
+		"email":                    {{key: "email"}},
+		"$.user.contacts[*].email": {{key: "user"}, {key: "contacts"}, {array: true, any: true}, {key: "email"}},
+		"items[2][*]":              {{key: "items"}, {array: true, index: 2}, {array: true, any: true}},
+		"$[0].*":                   {{array: true, index: 0}, {any: true}},
+	} {
+		steps, err := parseJSONPath(path)
+		if err != nil || !reflect.DeepEqual(steps, want) {
+			t.Fatalf("%q: got %+v, %v", path, steps, err)
+		}
+	}
+	for _, path := range []string{"", "$", "user..email", "items[x]", "items[1", "items[-1]"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Fatalf("%q: expected an error", path)
+		}
+	}
+}
+
+func TestRewriteJSONValuesKeepsLayout(t *testing.T) {
+	doc := `{ "b": 1, "a" : ["x", {"k\"ey": "y"}, null, true, -1.5e3], "e": {} ,"c":"z" }`
+	var paths []string
+	out, err := rewriteJSONValues(doc, func(path []jsonPathStep, raw string) string {
+		var parts []string
+		for _, step := range path {
+			if step.array {
+				parts = append(parts, "#")
+			} else {
+				parts = append(parts, step.key)
+			}
+		}
+		paths = append(paths, strings.Join(parts, "."))
+		return strings.ToUpper(raw)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{ "b": 1, "a" : ["X", {"k\"ey": "Y"}, null, true, -1.5E3], "e": {} ,"c":"Z" }`; out != want {
+		t.Fatalf("expected %s, got %s", want, out)
+	}
+	if !reflect.DeepEqual(paths, []string{"b", "a.#", `a.#.k"ey`, "a.#", "c"}) {
+		t.Fatalf("unexpected value paths %q", paths)
+	}
+
+	for _, bad := range []string{`{"a":}`, `{"a":1`, `["a" "b"]`, `{"a":1} x`, `{a:1}`, `"open`, `{"a":tru}`} {
+		if _, err := rewriteJSONValues(bad, func(_ []jsonPathStep, raw string) string { return raw }); err == nil {
+			t.Fatalf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestMaskJSONByPath(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		rt := newTestRuntime()
+		rules := jsonPathRules(rt, "events", TableConfig{Email: []string{"user.contacts[*].email", "missing"}}, bothAlgorithms())
+
+		doc := `{"id":1,"user":{"contacts":[{"email":"test@example.com","note":"test@example.com"},{"email":"<test@example.com>"}]},"email":"test@example.com"}`
+		out, err := maskJSON(rt, doc, "events", rules, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"id":1,"user":{"contacts":[{"email":"t098f6b@example.com","note":"test@example.com"},{"email":"<t098f6b@example.com>"}]},"email":"test@example.com"}`
+		if out != want {
+			t.Fatalf("expected %s, got %s", want, out)
+		}
+		rt.Coverage.markTable("events")
+		if problems := rt.Coverage.unmatched(map[string]TableConfig{"events": {Email: []string{"user.contacts[*].email", "missing"}}}); len(problems) != 1 ||
+			!strings.Contains(problems[0], `"missing"`) {
+			t.Fatalf("expected only the missing path unresolved, got %q", problems)
+		}
+	})
+}
+
+func TestMaskJSONColumns(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {JSON: map[string]map[string]string{
+				"profile": {"$.email": EmailTypeName, "$.phones[*]": PhoneTypeName},
+			}},
+		}
+
+		// The escaped, unicode-encoded address is invisible to a regex over
+		// the SQL text.
+		mysql := "INSERT INTO `users` (`id`, `profile`) VALUES " +
+			`(1,'{\"email\": \"test\\u0040example.com\", \"phones\": [\"+7 916 555-12-34\"], \"note\": \"test@example.com\"}'),(2,NULL);` + "\n"
+		out := processDump(t, NewDialectParser(DialectMySQL, newTestRuntime()), bothAlgorithms(), mysql)
+		if !strings.Contains(out, `(1,'{\"email\": \"t098f6b@example.com\", \"phones\": [\"+7 `) ||
+			strings.Contains(out, "916 555-12-34") || !strings.Contains(out, `\"note\": \"test@example.com\"}'),(2,NULL);`) {
+			t.Fatalf("unexpected MySQL JSON column masking: %s", out)
+		}
+
+		postgres := "INSERT INTO public.users (id, profile) VALUES (1, '{\"email\": \"test@example.com\", \"bio\": \"it''s\"}'::jsonb);\n" +
+			"COPY public.users (id, profile) FROM stdin;\n" +
+			`2	{"email": "test\\u0040example.com", "bio": "a\\tb"}` + "\n" +
+			`\.` + "\n"
+		want := "INSERT INTO public.users (id, profile) VALUES (1, '{\"email\": \"t098f6b@example.com\", \"bio\": \"it''s\"}'::jsonb);\n" +
+			"COPY public.users (id, profile) FROM stdin;\n" +
+			`2	{"email": "t098f6b@example.com", "bio": "a\\tb"}` + "\n" +
+			`\.` + "\n"
+		if out := processDump(t, NewDialectParser(DialectPostgreSQL, newTestRuntime()), bothAlgorithms(), postgres); out != want {
+			t.Fatalf("unexpected PostgreSQL JSON column masking:\n%s\nwant:\n%s", out, want)
+		}
+
+		rt := newTestRuntime()
+		rt.Strict = true
+		processDump(t, NewDialectParser(DialectMySQL, rt), bothAlgorithms(),
+			"INSERT INTO `users` (`id`, `profile`) VALUES (1,CAST('{}' AS JSON));\n")
+		if err := rt.StrictError(); err == nil || !strings.Contains(err.Error(), "JSON value of column profile is not a string literal") {
+			t.Fatalf("expected an expression in a JSON column to fail strict mode, got %v", err)
+		}
+
+		rt = newTestRuntime()
+		rt.Strict = true
+		line := "INSERT INTO public.users (id, profile) VALUES (1, E'{\"email\": \"test@example.com\\u12\"}');\n"
+		if out := processDump(t, NewDialectParser(DialectPostgreSQL, rt), bothAlgorithms(), line); out != line {
+			t.Fatalf("expected a literal with an undecodable escape kept as is, got: %s", out)
+		}
+		if err := rt.StrictError(); err == nil || !strings.Contains(err.Error(), "JSON value of column profile has an escape that cannot be decoded") {
+			t.Fatalf("expected an undecodable escape in a JSON column to fail strict mode, got %v", err)
+		}
+	})
+}
+
+func TestMaskJSONNumbers(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		rt := newTestRuntime()
+		rules := jsonPathRules(rt, "events", TableConfig{Phone: []string{"phone", "id"}}, bothAlgorithms())
+
+		// A phone stored as a number is masked by its digits and stays a
+		// number; a number that is no phone is kept.
+		doc := `{"id": 7, "phone": 79161234567, "other": 79161234567}`
+		out, err := maskJSON(rt, doc, "events", rules, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"id": 7, "phone": 71261034517, "other": 79161234567}`; out != want {
+			t.Fatalf("expected %s, got %s", want, out)
+		}
+
+		// A mask that is no number makes the value a string.
+		AppConfig.Masking.Phone = MaskingRule{Target: "2-", Value: "*"}
+		rt = newTestRuntime()
+		rules = jsonPathRules(rt, "events", TableConfig{Phone: []string{"phone"}}, bothAlgorithms())
+		out, err = maskJSON(rt, doc, "events", rules, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"id": 7, "phone": "7**********", "other": 79161234567}`; out != want {
+			t.Fatalf("expected %s, got %s", want, out)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"regexp"
+	"sync"
 )
 
 var (
@@ -21,8 +22,17 @@ var (
 	NoMaskTableList map[string]struct{}
 	// ProcessingTables defines which tables and fields are masked in selective mode.
 	ProcessingTables map[string]TableConfig
-	insertRegex      = regexp.MustCompile(`INSERT INTO ` + "`" + `(.+?)` + "`" + ` VALUES (.+)`)
-	tupleRegex       = regexp.MustCompile(`\((?:[^()'"\\]|'(?:\\.|[^'\\])*'|"(?:\\.|[^"\\])*"|\\.|\([^()]*\))*\)`)
+	// HashKey is the secret for keyed (HMAC-SHA256) hashing; nil keeps the
+	// unkeyed MD5/SHA-256 behavior.
+	HashKey []byte
+	// FPEKey is the secret of the reversible ff1 and ff3-1 algorithms; nil
+	// leaves them unavailable.
+	FPEKey []byte
+	// CacheKey is the secret for AES-GCM encryption of the cache file; nil
+	// keeps the plaintext JSON format.
+	CacheKey []byte
+	// CustomDataTypes holds the data types declared in the data_types config section.
+	CustomDataTypes map[string]*DataType
 )
 
 // Runtime groups masking dependencies explicitly to reduce package-level state usage.
@@ -35,13 +45,41 @@ type Runtime struct {
 	SkipTableList    map[string]struct{}
 	NoMaskTableList  map[string]struct{}
 	ProcessingTables map[string]TableConfig
-}
+	HashKey          []byte
+	// EmailFPE and PhoneFPE, when set, encrypt emails and phones reversibly
+	// instead of hashing them (--mask-email/--mask-phone=ff1|ff3-1).
+	EmailFPE *fpeCipher
+	PhoneFPE *fpeCipher
+	// DataTypes is the ordered type registry: built-in email and phone
+	// followed by custom types.
+	DataTypes []*DataType
+	// Fingerprints, when set, records every original value that was masked
+	// for later leak verification.
+	Fingerprints *fingerprintSet
+	// Stats, when set, collects the per-table run report (--stats).
+	Stats *runStats
+	// Coverage records which masking_tables entries matched the dump.
+	Coverage *configCoverage
+	// Strict turns every case where configured data would pass through
+	// unmasked into a fatal error (--strict).
+	Strict bool
+	// FailOnCollision aborts the run when two values get the same mask
+	// (--fail-on-collision) instead of making the mask unique.
+	FailOnCollision bool
+	// RowVisitor, when set, is called by the parsers with every data row
+	// they keep in the output while parsing it (scan, verify): SQL values
+	// as written, COPY values decoded with NULL as `\N`.
+	RowVisitor func(table string, columns, values []string)
 
-var defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
+	strictMu  sync.Mutex
+	strictErr error
+	// collided holds the data types whose first collision was logged.
+	collided map[string]bool
+}
 
 // NewRuntimeFromGlobals snapshots the current package-level runtime state.
 func NewRuntimeFromGlobals() *Runtime {
-	return &Runtime{
+	rt := &Runtime{
 		Config:           AppConfig,
 		EmailRegex:       EmailRegex,
 		PhoneRegex:       PhoneRegex,
@@ -50,7 +88,11 @@ func NewRuntimeFromGlobals() *Runtime {
 		SkipTableList:    SkipTableList,
 		NoMaskTableList:  NoMaskTableList,
 		ProcessingTables: ProcessingTables,
+		HashKey:          HashKey,
+		Coverage:         newConfigCoverage(),
 	}
+	rt.DataTypes = buildTypeRegistry(rt, CustomDataTypes)
+	return rt
 }
 
 // TypeMaskingInfo is a data type marker for masking algorithms.
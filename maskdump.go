@@ -2,10 +2,12 @@ package main
 
 import (
 	"bufio"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -25,13 +27,114 @@ const (
 	defaultMaxBufferSize = 1024 * 1024 * 10 // 10MB
 )
 
+var digitRegex = regexp.MustCompile(`\d`)
+
 // Cache stores masked values for deterministic replacements.
 type Cache struct {
 	Emails map[string]string `json:"emails"`
 	Phones map[string]string `json:"phones"`
+	// Types holds masked values of custom data types keyed by type name.
+	Types map[string]map[string]string `json:"types,omitempty"`
+	// KeyID fingerprints the hash key the masks were built with, so a cache
+	// from another key (or from unkeyed mode) is never reused.
+	KeyID string `json:"key_id,omitempty"`
+	// backend replaces the maps above when the disk cache backend is used.
+	backend CacheBackend
+	// owners maps the masks handed out per data type back to their original
+	// values, to detect collisions with the json backend (see claim). The
+	// disk backend keeps them itself.
+	owners map[string]map[string]string
+	// batch, when set, makes this Cache the view of one batch of masking
+	// jobs on the worker pool (see cacheBatch).
+	batch *cacheBatch
+	// err is the first integrity failure of a backend lookup (see Err).
+	err error
 	sync.RWMutex
 }
 
+// Err returns the first integrity failure met by a lookup: a tampered or
+// truncated entry of the disk cache. The run must abort on it instead of
+// overwriting the entry with a recomputed mask.
+func (c *Cache) Err() error {
+	if c == nil {
+		return nil
+	}
+	c.RLock()
+	defer c.RUnlock()
+	return c.err
+}
+
+// lookup returns the cached mask of a value. A nil cache never hits.
+func (c *Cache) lookup(typeName, value string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	if c.batch != nil {
+		return c.batch.lookup(typeName, value)
+	}
+	if c.backend != nil {
+		masked, ok, err := c.backend.Get(typeName, value)
+		if errors.Is(err, errCacheIntegrity) {
+			c.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.Unlock()
+		} else if err != nil && logger != nil {
+			logger.Warn("Cache lookup warning: %v", err)
+		}
+		return masked, ok
+	}
+	c.RLock()
+	defer c.RUnlock()
+
+	var masked string
+	var ok bool
+	switch typeName {
+	case EmailTypeName:
+		masked, ok = c.Emails[value]
+	case PhoneTypeName:
+		masked, ok = c.Phones[value]
+	default:
+		masked, ok = c.Types[typeName][value]
+	}
+	return masked, ok
+}
+
+// store remembers the mask of a value. A nil cache ignores the call.
+func (c *Cache) store(typeName, value, masked string) {
+	if c == nil {
+		return
+	}
+	if c.batch != nil {
+		c.batch.store(typeName, value, masked)
+		return
+	}
+	if c.backend != nil {
+		if err := c.backend.Put(typeName, value, masked); err != nil && logger != nil {
+			logger.Warn("Cache store warning: %v", err)
+		}
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	switch typeName {
+	case EmailTypeName:
+		c.Emails[value] = masked
+	case PhoneTypeName:
+		c.Phones[value] = masked
+	default:
+		if c.Types == nil {
+			c.Types = make(map[string]map[string]string)
+		}
+		if c.Types[typeName] == nil {
+			c.Types[typeName] = make(map[string]string)
+		}
+		c.Types[typeName][value] = masked
+	}
+}
+
 // MaskConfig holds CLI-level masking options.
 type MaskConfig struct {
 	emailAlgorithm string
@@ -40,6 +143,29 @@ type MaskConfig struct {
 	configFile     string
 	cpuProfilePath string
 	dbFormat       string
+	// fingerprintPath receives fingerprints of the masked originals.
+	fingerprintPath string
+	// strict aborts instead of passing configured data through unmasked.
+	strict     bool
+	outputPath string
+	// failOnUnmatched turns the unmatched masking_tables summary into a
+	// failure.
+	failOnUnmatched bool
+	// failOnCollision aborts when two values get the same mask.
+	failOnCollision bool
+	// statsPath receives the JSON run report; "-" means stderr.
+	statsPath string
+	// outputCompression and outputCompressionLevel select the compression
+	// of the masked dump.
+	outputCompression      string
+	outputCompressionLevel int
+	// workers is the number of masking goroutines; 0 means one per CPU.
+	workers int
+	// inputDir is a pg_dump directory-format, mydumper or mysqldump --tab
+	// dump to mask instead of stdin.
+	inputDir string
+	// table names the table of CSV, TSV or NDJSON input.
+	table string
 }
 
 // LogConfig configures file logging.
@@ -217,6 +343,15 @@ func freeMemory(cache *Cache) {
 		return
 	}
 
+	// The disk backend keeps every entry on disk: dropping the memory tier
+	// loses nothing and later lookups stay deterministic.
+	if cache.backend != nil {
+		cache.backend.Purge()
+		runtime.GC()
+		debug.FreeOSMemory()
+		return
+	}
+
 	// Flush cache to disk if possible
 	if AppConfig.CachePath != "" {
 		if err := saveCache(cache); err != nil {
@@ -228,10 +363,17 @@ func freeMemory(cache *Cache) {
 		}
 	}
 
-	// Clear internal caches
+	// Clear internal caches. The owners of the masks stay, seeded from the
+	// maps first, so a later value cannot take the mask of a purged one.
 	cache.Lock()
+	cache.ownersOf(EmailTypeName)
+	cache.ownersOf(PhoneTypeName)
+	for typeName := range cache.Types {
+		cache.ownersOf(typeName)
+	}
 	cache.Emails = make(map[string]string)
 	cache.Phones = make(map[string]string)
+	cache.Types = make(map[string]map[string]string)
 	cache.Unlock()
 
 	// Force garbage collection
@@ -239,80 +381,263 @@ func freeMemory(cache *Cache) {
 	debug.FreeOSMemory()
 }
 
-func loadCache() (*Cache, error) {
-	cache := &Cache{
+func newCache() *Cache {
+	return &Cache{
 		Emails: make(map[string]string),
 		Phones: make(map[string]string),
+		Types:  make(map[string]map[string]string),
+		KeyID:  keyID(HashKey, "hash"),
 	}
+}
+
+func loadCache() (*Cache, error) {
+	if AppConfig.CacheBackend == CacheBackendDisk {
+		return openDiskCache()
+	}
+
+	cache := newCache()
 
 	data, err := os.ReadFile(AppConfig.CachePath)
 	if err != nil {
 		return cache, nil
 	}
 
-	err = json.Unmarshal(data, cache)
-	return cache, err
+	switch {
+	case isEncryptedCache(data) && CacheKey == nil:
+		return cache, fmt.Errorf("%w: cache %s is encrypted but no cache key is configured", errCacheIntegrity, AppConfig.CachePath)
+	case isEncryptedCache(data):
+		if data, err = openCache(data, CacheKey); err != nil {
+			return cache, fmt.Errorf("cache %s: %w", AppConfig.CachePath, err)
+		}
+	case CacheKey != nil:
+		return cache, fmt.Errorf("%w: cache %s is not encrypted but a cache key is configured", errCacheIntegrity, AppConfig.CachePath)
+	}
+
+	if err := json.Unmarshal(data, cache); err != nil {
+		return cache, err
+	}
+	if want := keyID(HashKey, "hash"); cache.KeyID != want {
+		// Masks built with another hash key must not leak into this run.
+		return newCache(), fmt.Errorf("cache %s was built with a different hash key, starting with an empty cache", AppConfig.CachePath)
+	}
+	return cache, nil
 }
 
 func saveCache(cache *Cache) error {
+	if cache.backend != nil {
+		return cache.backend.Flush()
+	}
+
 	cache.RLock()
 	defer cache.RUnlock()
 
-	data, err := json.Marshal(cache)
+	data, err := json.Marshal(cache.withPurged())
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(AppConfig.CachePath, data, 0644)
+	if CacheKey != nil {
+		if data, err = sealCache(data, CacheKey); err != nil {
+			return err
+		}
+	}
+
+	// The cache maps original values to masks, so it is as sensitive as
+	// the dump itself: owner-only permissions, never a half-written file.
+	return writeFileAtomic(AppConfig.CachePath, data, 0600)
+}
+
+// withPurged returns the json cache with the entries that freeMemory
+// cleared from the maps restored from the owners of their masks, so the
+// file keeps every mask handed out. The caller holds the lock.
+func (c *Cache) withPurged() *Cache {
+	restore := func(entries map[string]string, owners map[string]string) map[string]string {
+		if len(owners) <= len(entries) {
+			return entries
+		}
+		merged := make(map[string]string, len(owners))
+		for original, mask := range entries {
+			merged[original] = mask
+		}
+		for mask, original := range owners {
+			if _, ok := merged[original]; !ok {
+				merged[original] = mask
+			}
+		}
+		return merged
+	}
+	out := &Cache{
+		Emails: restore(c.Emails, c.owners[EmailTypeName]),
+		Phones: restore(c.Phones, c.owners[PhoneTypeName]),
+		Types:  make(map[string]map[string]string, len(c.Types)),
+		KeyID:  c.KeyID,
+	}
+	for typeName, entries := range c.Types {
+		out.Types[typeName] = entries
+	}
+	for typeName, owners := range c.owners {
+		if typeName != EmailTypeName && typeName != PhoneTypeName {
+			out.Types[typeName] = restore(out.Types[typeName], owners)
+		}
+	}
+	return out
+}
+
+// closeCache releases the cache backend, if any, after the final save.
+func closeCache(cache *Cache) error {
+	if cache == nil || cache.backend == nil {
+		return nil
+	}
+	return cache.backend.Close()
 }
 
 func parseFlags() MaskConfig {
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError) // Сбрасываем флаги
 
-	emailAlg := flag.String("mask-email", "", "Email masking algorithm (light-hash)")
-	phoneAlg := flag.String("mask-phone", "", "Phone masking algorithm (light-mask)")
+	emailAlg := flag.String("mask-email", "", "Email masking algorithm: light-hash, or ff1|ff3-1 for reversible encryption")
+	phoneAlg := flag.String("mask-phone", "", "Phone masking algorithm: light-mask, or ff1|ff3-1 for reversible encryption")
 	noCache := flag.Bool("no-cache", false, "Disable caching")
 	configFile := flag.String("config", "", "Path to config file")
 	cpuProfile := flag.String("cpu-profile", "", "Write CPU profile to the specified file")
-	dbFormat := flag.String("db-format", "", "Dump dialect: auto|mysql|postgresql|oracle|mssql|sqlite|firebird (default: config db_format or auto)")
+	dbFormat := flag.String("db-format", "", "Dump dialect: auto|mysql|postgresql|oracle|mssql|sqlite|firebird|csv|tsv|ndjson (default: config db_format or auto)")
+	fingerprints := flag.String("fingerprints", "", "Write fingerprints of masked original values to the specified file (for maskdump verify); needs a hash key")
+	strict := flag.Bool("strict", false, "Abort with an error instead of passing configured data through unmasked")
+	failOnUnmatched := flag.Bool("fail-on-unmatched", false, "Fail when a masking_tables table is never seen or a configured column never resolves")
+	failOnCollision := flag.Bool("fail-on-collision", false, "Fail when two distinct values get the same mask instead of making the mask unique")
+	stats := flag.String("stats", "", "Write a JSON report with per-table statistics to the specified file (\"-\" for stderr)")
+	output := flag.String("output", "", "Write the masked dump to the specified file instead of stdout (replaced only on success)")
+	outputCompression := flag.String("output-compression", "", "Compress the masked dump: none|gzip|zstd")
+	outputCompressionLevel := flag.Int("output-compression-level", 0, "Compression level: gzip 1-9, zstd 1-22 (default: the format's default)")
+	workers := flag.Int("workers", 0, "Number of masking workers; 1 masks serially (default: one per CPU)")
+	table := flag.String("table", "", "Table whose masking_tables rules apply to CSV, TSV or NDJSON input (--db-format=csv|tsv|ndjson)")
+	inputDir := flag.String("input-dir", "", "Mask the dump directory of pg_dump -Fd, mydumper or mysqldump --tab, or the CSV/TSV/NDJSON files (--db-format=csv|tsv|ndjson), in the specified directory into the --output directory")
 
 	flag.Parse()
 
 	return MaskConfig{
-		emailAlgorithm: *emailAlg,
-		phoneAlgorithm: *phoneAlg,
-		cacheEnabled:   !*noCache,
-		configFile:     *configFile,
-		cpuProfilePath: *cpuProfile,
-		dbFormat:       *dbFormat,
+		emailAlgorithm:  *emailAlg,
+		phoneAlgorithm:  *phoneAlg,
+		cacheEnabled:    !*noCache,
+		configFile:      *configFile,
+		cpuProfilePath:  *cpuProfile,
+		dbFormat:        *dbFormat,
+		fingerprintPath: *fingerprints,
+		strict:          *strict,
+		outputPath:      *output,
+		failOnUnmatched: *failOnUnmatched,
+		failOnCollision: *failOnCollision,
+		statsPath:       *stats,
+
+		outputCompression:      *outputCompression,
+		outputCompressionLevel: *outputCompressionLevel,
+		workers:                *workers,
+		inputDir:               *inputDir,
+		table:                  *table,
+	}
+}
+
+// validateInputDir checks the flags that go with --input-dir.
+func validateInputDir(config MaskConfig) error {
+	if config.inputDir == "" {
+		return nil
 	}
+	if config.outputPath == "" {
+		return errors.New("--input-dir requires --output for the output directory")
+	}
+	if config.outputCompression != "" && config.outputCompression != "none" {
+		return errors.New("--output-compression cannot be used with --input-dir: data files keep their compression")
+	}
+	return nil
+}
+
+// validateFailOnCollision checks that --fail-on-collision has the cache:
+// masks are compared with the ones it holds, so without it no collision is
+// ever found.
+func validateFailOnCollision(config MaskConfig) error {
+	if config.failOnCollision && !config.cacheEnabled {
+		return errors.New("--fail-on-collision cannot be used with --no-cache: collisions are found through the cache")
+	}
+	return nil
+}
+
+// validateTable checks that --table names the table of CSV, TSV or NDJSON
+// input on stdin; in an --input-dir directory every file names its table.
+func validateTable(config MaskConfig, dialect DumpDialect) error {
+	switch {
+	case !isTableFileDialect(dialect):
+		if config.table != "" {
+			return errors.New("--table only applies to --db-format=csv, tsv or ndjson")
+		}
+	case config.inputDir != "":
+		if config.table != "" {
+			return errors.New("--table cannot be used with --input-dir: every file is the table of its name")
+		}
+	case config.table == "":
+		return fmt.Errorf("--db-format=%s reads the rows of one table: name it with --table", dialect)
+	}
+	return nil
 }
 
 func validateAlgorithms(config MaskConfig) error {
-	if config.emailAlgorithm != "" && config.emailAlgorithm != "light-hash" {
+	if config.emailAlgorithm != "" && config.emailAlgorithm != algorithmLightHash && !isFPEAlgorithm(config.emailAlgorithm) {
 		return fmt.Errorf("unsupported email algorithm: %s", config.emailAlgorithm)
 	}
-	if config.phoneAlgorithm != "" && config.phoneAlgorithm != "light-mask" {
+	if config.phoneAlgorithm != "" && config.phoneAlgorithm != algorithmLightMask && !isFPEAlgorithm(config.phoneAlgorithm) {
 		return fmt.Errorf("unsupported phone algorithm: %s", config.phoneAlgorithm)
 	}
 	return nil
 }
 
+// useFPE sets up the ciphers of the email and phone algorithms that are
+// ff1 or ff3-1. They need the fpe key.
+func (r *Runtime) useFPE(config MaskConfig, secret []byte) error {
+	var err error
+	if isFPEAlgorithm(config.emailAlgorithm) {
+		if r.EmailFPE, err = newFPECipher(config.emailAlgorithm, secret); err != nil {
+			return fmt.Errorf("--mask-email: %v", err)
+		}
+	}
+	if isFPEAlgorithm(config.phoneAlgorithm) {
+		if r.PhoneFPE, err = newFPECipher(config.phoneAlgorithm, secret); err != nil {
+			return fmt.Errorf("--mask-phone: %v", err)
+		}
+	}
+	return nil
+}
+
 // MaskEmailWithRules masks one email value using the runtime's explicit dependencies.
 func (r *Runtime) MaskEmailWithRules(email string, cache *Cache) string {
+	masked, _ := r.maskEmail(email, cache)
+	return masked
+}
+
+// maskEmail is MaskEmailWithRules that also reports how the value was
+// treated.
+func (r *Runtime) maskEmail(email string, cache *Cache) (string, maskOutcome) {
 	if _, ok := r.EmailWhiteList[email]; ok {
-		return email
+		return email, outcomeWhiteListed
+	}
+	if r.EmailFPE != nil {
+		// Encryption is a bijection: there is nothing to cache or collide.
+		masked, ok := r.EmailFPE.email(email, false)
+		return r.encrypted(EmailTypeName, email, masked, ok, cache)
 	}
 
-	if cache != nil {
-		cache.RLock()
-		if masked, exists := cache.Emails[email]; exists {
-			cache.RUnlock()
-			return masked
-		}
-		cache.RUnlock()
+	if masked, ok := cache.lookup(EmailTypeName, email); ok && cache.claim(EmailTypeName, email, masked) {
+		return masked, outcomeCacheHit
 	}
 
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return email, outcomeUnchanged
+	}
+
+	return r.remember(EmailTypeName, email, maskEmailValue(email, r.Config.Masking.Email, r.HashKey), cache)
+}
+
+// maskEmailValue applies an email masking rule. The "username:" and
+// "domain:" target modifiers restrict masking to one side of the "@".
+func maskEmailValue(email string, rule MaskingRule, key []byte) string {
 	parts := strings.Split(email, "@")
 	if len(parts) != 2 {
 		return email
@@ -320,65 +645,72 @@ func (r *Runtime) MaskEmailWithRules(email string, cache *Cache) string {
 
 	localPart := parts[0]
 	domainPart := parts[1]
-	target := r.Config.Masking.Email.Target
-	value := r.Config.Masking.Email.Value
+	target := rule.Target
+	value := rule.Value
 
 	var positions []int
 	if strings.Contains(target, "username:") {
 		positions = parseTargetPositions(strings.TrimPrefix(target, "username:"), len(localPart))
-		localPart = applyMasking(localPart, positions, value, Email)
+		localPart = applyKeyedMasking(localPart, positions, value, Email, key)
 	} else if strings.Contains(target, "domain:") {
 		positions = parseTargetPositions(strings.TrimPrefix(target, "domain:"), len(domainPart))
-		domainPart = applyMasking(domainPart, positions, value, Email)
+		domainPart = applyKeyedMasking(domainPart, positions, value, Email, key)
 	} else {
 		positions = parseTargetPositions(target, len(email))
-		masked := applyMasking(email, positions, value, Email)
-		if cache != nil {
-			cache.Lock()
-			cache.Emails[email] = masked
-			cache.Unlock()
-		}
-		return masked
-	}
-
-	masked := localPart + "@" + domainPart
-
-	if cache != nil {
-		cache.Lock()
-		cache.Emails[email] = masked
-		cache.Unlock()
+		return applyKeyedMasking(email, positions, value, Email, key)
 	}
 
-	return masked
+	return localPart + "@" + domainPart
 }
 
 // MaskPhoneWithRules masks one phone value using the runtime's explicit dependencies.
 func (r *Runtime) MaskPhoneWithRules(phone string, cache *Cache) string {
+	masked, _ := r.maskPhone(phone, cache)
+	return masked
+}
+
+// maskPhone is MaskPhoneWithRules that also reports how the value was
+// treated.
+func (r *Runtime) maskPhone(phone string, cache *Cache) (string, maskOutcome) {
 	if _, ok := r.PhoneWhiteList[phone]; ok {
-		return phone
+		return phone, outcomeWhiteListed
+	}
+	if r.PhoneFPE != nil {
+		masked, ok := r.PhoneFPE.phone(phone, r.Config.Masking.Phone, false)
+		return r.encrypted(PhoneTypeName, phone, masked, ok, cache)
 	}
 
-	if cache != nil {
-		cache.RLock()
-		if masked, exists := cache.Phones[phone]; exists {
-			cache.RUnlock()
-			return masked
-		}
-		cache.RUnlock()
+	if masked, ok := cache.lookup(PhoneTypeName, phone); ok && cache.claim(PhoneTypeName, phone, masked) {
+		return masked, outcomeCacheHit
 	}
 
-	target := r.Config.Masking.Phone.Target
-	value := r.Config.Masking.Phone.Value
+	return r.remember(PhoneTypeName, phone, maskDigits(phone, r.Config.Masking.Phone, Phone, r.HashKey), cache)
+}
+
+// encrypted reports the outcome of format-preserving encryption. A value
+// too short to encrypt safely passes through and is reported.
+func (r *Runtime) encrypted(typeName, value, masked string, ok bool, cache *Cache) (string, maskOutcome) {
+	if !ok {
+		cache.effect(func() {
+			r.reportUnmasked("%s value is too short for format-preserving encryption: it passes through unmasked", typeName)
+		})
+		return value, outcomeUnchanged
+	}
+	return masked, outcomeEncrypted
+}
 
-	digits := regexp.MustCompile(`\d`).FindAllString(phone, -1)
+// maskDigits masks the digits of a value by position and keeps every other
+// character in place, preserving the original formatting.
+func maskDigits(value string, rule MaskingRule, typeMaskingInfo TypeMaskingInfo, key []byte) string {
+	digits := digitRegex.FindAllString(value, -1)
 	digitStr := strings.Join(digits, "")
 
-	positions := parseTargetPositions(target, len(digitStr))
-	maskedDigits := applyMasking(digitStr, positions, value, Phone)
+	positions := parseTargetPositions(rule.Target, len(digitStr))
+	maskedDigits := applyKeyedMasking(digitStr, positions, rule.Value, typeMaskingInfo, key)
 
 	var result strings.Builder
 	digitIndex := 0
-	for _, c := range phone {
+	for _, c := range value {
 		if c >= '0' && c <= '9' {
 			if digitIndex < len(maskedDigits) {
 				result.WriteByte(maskedDigits[digitIndex])
@@ -389,15 +721,7 @@ func (r *Runtime) MaskPhoneWithRules(phone string, cache *Cache) string {
 		}
 	}
 
-	masked := result.String()
-
-	if cache != nil {
-		cache.Lock()
-		cache.Phones[phone] = masked
-		cache.Unlock()
-	}
-
-	return masked
+	return result.String()
 }
 
 func parseTargetPositions(target string, length int) []int {
@@ -468,6 +792,13 @@ func parseTargetPositions(target string, length int) []int {
 // maskValue - masking value (e.g. "*", "hash:6", "hash")
 // typeMaskingInfo - type of masking (Email or Phone)
 func applyMasking(value string, positions []int, maskValue string, typeMaskingInfo TypeMaskingInfo) string {
+	return applyKeyedMasking(value, positions, maskValue, typeMaskingInfo, nil)
+}
+
+// applyKeyedMasking is applyMasking with an optional secret key. With a key
+// every hash is an HMAC-SHA256 of the value, so masks cannot be rebuilt from
+// a dictionary of candidate values without the key.
+func applyKeyedMasking(value string, positions []int, maskValue string, typeMaskingInfo TypeMaskingInfo, key []byte) string {
 	runes := []rune(value)
 	maskRunes := []rune{}
 
@@ -485,21 +816,14 @@ func applyMasking(value string, positions []int, maskValue string, typeMaskingIn
 		}
 
 		if strings.HasPrefix(maskValue, "hash:") {
-			tmpHash := md5.Sum([]byte(value))
-			// Convert to hex string
-			hashStr := hex.EncodeToString(tmpHash[:])
-			// Take the first N characters
-			hash = hashStr[:hashLen]
+			// Take the first N characters of the hex digest
+			hash = truncateHash(hashHex(value, Email, key), hashLen)
 		} else {
 			if typeMaskingInfo == Email && len(runes) > 0 {
-				tmpHash := md5.Sum([]byte(value))
-				hash = hex.EncodeToString(tmpHash[:])[:len(runes)]
+				hash = truncateHash(hashHex(value, Email, key), len(runes))
 			} else if typeMaskingInfo == Phone {
-				tmpHash := sha256.Sum256([]byte(value))
-				tmpHash2 := hex.EncodeToString(tmpHash[:])
-
 				// We get only the digits for hashing
-				digits := regexp.MustCompile(`\d`).FindAllString(tmpHash2, -1)
+				digits := digitRegex.FindAllString(hashHex(value, Phone, key), -1)
 				hash = strings.Join(digits, "")
 			}
 		}
@@ -549,6 +873,32 @@ func isContinuousSequence(positions []int) bool {
 	return true
 }
 
+// hashHex returns the hex digest used as the source of mask characters:
+// HMAC-SHA256 when a key is set, otherwise MD5 for emails and SHA-256 for
+// phones.
+func hashHex(value string, typeMaskingInfo TypeMaskingInfo, key []byte) string {
+	if key != nil {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	if typeMaskingInfo == Phone {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncateHash returns the first n characters of a digest, or all of them
+// when the digest is shorter.
+func truncateHash(hash string, n int) string {
+	if n < len(hash) {
+		return hash[:n]
+	}
+	return hash
+}
+
 func replacePositions(value string, positions []int, hash string) string {
 	if len(positions) == 0 {
 		return value
@@ -601,7 +951,7 @@ func resolveDialect(config MaskConfig) (DumpDialect, error) {
 }
 
 // flushableParser is implemented by parsers that may hold buffered input at
-// end of stream (auto-detection).
+// end of stream (auto-detection, INSERT values open across lines).
 type flushableParser interface {
 	Flush(config MaskConfig, cache *Cache) string
 }
@@ -612,10 +962,120 @@ func processLine(line string, config MaskConfig, cache *Cache, parser DialectPar
 	return parser.ProcessLine(line, config, cache)
 }
 
+// streamMasker feeds dump input through the parser into a job writer,
+// checking strict mode, the cache and the memory limit on the way.
+type streamMasker struct {
+	parser  DialectParser
+	rt      *Runtime
+	config  MaskConfig
+	cache   *Cache
+	workers int
+
+	// lines counts the input lines read so far, pieces the parsed pieces.
+	lines  int
+	pieces int
+}
+
+// failure returns the error that must abort the run, if any: a cache
+// integrity failure or a strict mode violation.
+func (m *streamMasker) failure() error {
+	if err := m.cache.Err(); err != nil {
+		return err
+	}
+	return m.rt.StrictError()
+}
+
+// maskDump masks a plain-text dump from r to w.
+func (m *streamMasker) maskDump(r io.Reader, w io.StringWriter) error {
+	jobs := newJobWriter(w, m.workers)
+	defer func() { _ = jobs.close() }()
+
+	if err := m.mask(r, jobs); err != nil {
+		return err
+	}
+	// Parsers may still hold buffered lines at end of stream.
+	if err := m.flush(jobs); err != nil {
+		return err
+	}
+	if err := jobs.close(); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	// Jobs still running on workers may have reported a violation after
+	// the last check of the parsing loop.
+	return m.failure()
+}
+
+// mask feeds r to the parser piece by piece. Overlong INSERT lines arrive in
+// pieces, one per VALUES tuple.
+func (m *streamMasker) mask(r io.Reader, jobs jobWriter) error {
+	reader := newDumpReader(r, defaultMaxBufferSize, parserStreamLexer(m.parser))
+	for {
+		line, err := reader.next()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read input: %v", err)
+		}
+		atEOF := err == io.EOF
+		if atEOF && line == "" {
+			return nil
+		}
+
+		job, drop := lineJob(m.parser, line, m.config, jobs.cache(m.cache))
+		if err := m.failure(); err != nil {
+			return fmt.Errorf("%v (input line %d)", err, m.lines+1)
+		}
+		if !drop {
+			if err := jobs.write(job, len(line)); err != nil {
+				return fmt.Errorf("failed to write output: %v", err)
+			}
+		}
+
+		m.lines += strings.Count(line, "\n")
+		if atEOF && !strings.HasSuffix(line, "\n") {
+			m.lines++
+		}
+		m.pieces++
+		if AppConfig.CacheFlushCount > 0 && m.pieces%AppConfig.CacheFlushCount == 0 {
+			if checkMemoryLimit() {
+				freeMemory(m.cache)
+			}
+		}
+
+		if atEOF {
+			return nil
+		}
+	}
+}
+
+// flush writes the input the parser still holds.
+func (m *streamMasker) flush(jobs jobWriter) error {
+	tail := flushJob(m.parser, m.config, jobs.cache(m.cache))
+	if err := m.failure(); err != nil {
+		return err
+	}
+	if err := jobs.write(tail, 0); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	return nil
+}
+
+// subcommands maps the first CLI argument to an alternative entry point. Any
+// other invocation masks stdin to stdout.
+var subcommands = map[string]func(args []string) int{
+	"scan":   runScan,
+	"verify": runVerify,
+	"unmask": runUnmask,
+}
+
 // The function prepares the required values of the setting variables.
 // Keeps track of memory and cache. Reads the input buffer, starts processing of incoming strings.
 // Outputs to the output buffer the result after masking and ignoring the specified tables.
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	config := parseFlags()
 
 	if config.cpuProfilePath != "" {
@@ -676,11 +1136,30 @@ func main() {
 		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if err := validateFailOnCollision(config); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	compression, err := parseOutputCompression(config.outputCompression, config.outputCompressionLevel)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	workers, err := resolveWorkers(config.workers)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	var cache *Cache
 	if config.cacheEnabled {
 		var err error
 		cache, err = loadCache()
+		if cache == nil || errors.Is(err, errCacheIntegrity) {
+			logger.Error("Cache load error: %v", err)
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		if err != nil {
 			logger.Warn("Cache load warning: %v", err)
 		}
@@ -690,6 +1169,21 @@ func main() {
 	memoryLimit = int64(AppConfig.MemoryLimitMB) * 1024 * 1024
 	go trackMemoryUsage()
 	runtimeState := NewRuntimeFromGlobals()
+	runtimeState.Strict = config.strict
+	runtimeState.FailOnCollision = config.failOnCollision
+	if err := runtimeState.useFPE(config, FPEKey); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config.statsPath != "" {
+		runtimeState.Stats = newRunStats()
+	}
+	if config.fingerprintPath != "" {
+		if runtimeState.Fingerprints, err = newFingerprintSet(HashKey); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: --fingerprints: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	dialect, err := resolveDialect(config)
 	if err != nil {
@@ -697,65 +1191,146 @@ func main() {
 		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	parser := NewDialectParser(dialect, runtimeState)
-	logger.Info("Using dump dialect: %s", dialect)
-
-	reader := bufio.NewReaderSize(os.Stdin, defaultMaxBufferSize)
-	writer := bufio.NewWriterSize(os.Stdout, defaultMaxBufferSize)
-	defer func() {
-		if err := writer.Flush(); err != nil {
-			logger.Error("Error flushing output: %v", err)
+	if err := validateInputDir(config); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateTable(config, dialect); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// A dump directory is masked into an output directory, anything
+	// else from stdin into a single output. In strict mode and with
+	// --fail-on-collision nothing reaches stdout before the whole input was
+	// masked: a violation late in the dump must not leave a partial dump.
+	var (
+		output interface {
+			Commit() error
+			Abort()
 		}
-	}()
+		writer *dumpOutput
+		outDir *dumpDirectory
+	)
+	if config.inputDir != "" {
+		outDir, err = openDumpDirectory(config.outputPath)
+		output = outDir
+	} else {
+		writer, err = openDumpOutput(config.outputPath, (config.strict || config.failOnCollision) && config.outputPath == "", compression)
+		output = writer
+	}
+	if err != nil {
+		logger.Error("Output error: %v", err)
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fail := func(format string, v ...interface{}) {
+		output.Abort()
+		msg := fmt.Sprintf(format, v...)
+		logger.Error("%s", msg)
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", msg)
+		os.Exit(1)
+	}
 
-	lineCount := 0
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			logger.Error("Error reading input: %v", err)
-			os.Exit(1)
+	var in *bufio.Reader
+	archive, archiveDialect := "", DialectPostgreSQL
+	switch {
+	case outDir != nil && isTableFileDialect(dialect):
+		// A directory of CSV, TSV or NDJSON files, one table per file.
+	case outDir != nil:
+		archive = "pg_dump directory-format dump"
+		if _, err := os.Stat(filepath.Join(config.inputDir, pgDirectoryTOC)); err != nil {
+			archive, archiveDialect = "mydumper or mysqldump --tab directory", DialectMySQL
 		}
-		atEOF := err == io.EOF
-		if atEOF && line == "" {
-			break
+	default:
+		// Compressed input is recognized by its magic bytes.
+		input, inputFormat, err := openDumpInput(os.Stdin)
+		if err != nil {
+			fail("%v", err)
 		}
-
-		maskedLine, drop := processLine(line, config, cache, parser)
-		if !drop {
-			_, err = writer.WriteString(maskedLine)
-			if err != nil {
-				logger.Error("Error writing output: %v", err)
-				os.Exit(1)
-			}
+		defer func() { _ = input.Close() }()
+		if inputFormat != "" {
+			logger.Info("Reading %s-compressed input", inputFormat)
 		}
-
-		lineCount++
-		if lineCount%AppConfig.CacheFlushCount == 0 {
-			if checkMemoryLimit() {
-				freeMemory(cache)
-			}
+		// pg_dump custom-format archives (-Fc) carry PostgreSQL COPY data.
+		in = bufio.NewReaderSize(input, defaultMaxBufferSize)
+		if isPgArchive(in) {
+			archive = "pg_dump custom-format archive"
 		}
-
-		if atEOF {
-			break
+	}
+	if archive != "" {
+		if dialect != DialectAuto && dialect != archiveDialect {
+			fail("input is a %s, which --db-format=%s cannot read", archive, dialect)
 		}
+		dialect = archiveDialect
+		logger.Info("Reading %s", archive)
 	}
 
-	// Auto-detection may still hold buffered lines at end of stream.
-	if fp, ok := parser.(flushableParser); ok {
-		if tail := fp.Flush(config, cache); tail != "" {
-			if _, err := writer.WriteString(tail); err != nil {
-				logger.Error("Error writing output: %v", err)
-				os.Exit(1)
-			}
-		}
+	parser := NewDialectParser(dialect, runtimeState)
+	if isTableFileDialect(dialect) {
+		parser = newTableFileParser(runtimeState, dialect, config.table)
+	}
+	logger.Info("Using dump dialect: %s", dialect)
+
+	// Parsing stays on this goroutine; masking runs on the workers and the
+	// output keeps input order.
+	logger.Info("Masking with %d workers", workers)
+	masker := &streamMasker{parser: parser, rt: runtimeState, config: config, cache: cache, workers: workers}
+	switch {
+	case outDir != nil && isTableFileDialect(dialect):
+		err = masker.maskTableFileDirectory(config.inputDir, outDir.tmp)
+	case outDir != nil && dialect == DialectMySQL:
+		err = masker.maskMySQLDirectory(config.inputDir, outDir.tmp)
+	case outDir != nil:
+		err = masker.maskPgDirectory(config.inputDir, outDir.tmp)
+	case archive != "":
+		err = masker.maskPgArchive(in, writer)
+	default:
+		err = masker.maskDump(in, writer)
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+
+	// Typos in masking_tables silently leave columns unmasked: list every
+	// entry that never matched the dump.
+	unmatched := runtimeState.Coverage.unmatched(runtimeState.ProcessingTables)
+	for _, problem := range unmatched {
+		logger.Warn("%s", problem)
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", problem)
+	}
+	if len(unmatched) > 0 && config.failOnUnmatched {
+		fail("%d masking_tables entries did not match the dump", len(unmatched))
+	}
+
+	if err := output.Commit(); err != nil {
+		fail("Error writing output: %v", err)
 	}
 
 	if config.cacheEnabled && cache != nil {
 		if err := saveCache(cache); err != nil {
 			logger.Warn("Cache save warning: %v", err)
 		}
+		if err := closeCache(cache); err != nil {
+			logger.Warn("Cache close warning: %v", err)
+		}
+	}
+
+	if runtimeState.Stats != nil {
+		runtimeState.Stats.Dialect = parser.Dialect()
+		runtimeState.Stats.Lines = int64(masker.lines)
+		if err := runtimeState.Stats.write(config.statsPath); err != nil {
+			logger.Warn("Stats report warning: %v", err)
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if runtimeState.Fingerprints != nil {
+		if err := runtimeState.Fingerprints.save(config.fingerprintPath); err != nil {
+			logger.Error("Failed to write fingerprints: %v", err)
+			_, _ = fmt.Fprintf(os.Stderr, "Error: failed to write fingerprints: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	logger.Info("Processing completed, processed %d lines", lineCount)
+	logger.Info("Processing completed, processed %d lines", masker.lines)
 }
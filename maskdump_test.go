@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -161,6 +163,10 @@ func TestValidateAlgorithms(t *testing.T) {
 		t.Errorf("validateAlgorithms failed for valid config: %v", err1)
 	}
 
+	if err := validateAlgorithms(MaskConfig{emailAlgorithm: "ff1", phoneAlgorithm: "ff3-1"}); err != nil {
+		t.Errorf("validateAlgorithms failed for format-preserving encryption: %v", err)
+	}
+
 	config2 := MaskConfig{
 		emailAlgorithm: "invalid",
 		phoneAlgorithm: "light-mask",
@@ -211,3 +217,127 @@ func TestLoadSaveCache(t *testing.T) {
 		t.Errorf("Cache data mismatch. Expected: %v, Got: %v", cache, loadedCache)
 	}
 }
+
+func TestKeyedHashMasking(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+
+		plainEmail := maskEmailWithRules("test@example.com", nil)
+		plainPhone := maskPhoneWithRules("+7 (900) 111-22-33", nil)
+
+		HashKey = []byte("0123456789abcdef-secret")
+		keyedEmail := maskEmailWithRules("test@example.com", nil)
+		keyedPhone := maskPhoneWithRules("+7 (900) 111-22-33", nil)
+
+		if keyedEmail == plainEmail || keyedPhone == plainPhone {
+			t.Fatalf("expected keyed masks to differ from unkeyed ones: %s/%s vs %s/%s", keyedEmail, keyedPhone, plainEmail, plainPhone)
+		}
+		if again := maskEmailWithRules("test@example.com", nil); again != keyedEmail {
+			t.Fatalf("expected keyed email masking to be deterministic, got %s vs %s", again, keyedEmail)
+		}
+		if !strings.HasPrefix(keyedEmail, "t") || !strings.HasSuffix(keyedEmail, "@example.com") || len(keyedEmail) != len(plainEmail) {
+			t.Fatalf("expected masking rule shape preserved, got %s", keyedEmail)
+		}
+		if stripDigits(keyedPhone) != stripDigits("+7 (900) 111-22-33") {
+			t.Fatalf("expected phone formatting preserved, got %s", keyedPhone)
+		}
+
+		HashKey = []byte("another-secret-key-0123")
+		if other := maskEmailWithRules("test@example.com", nil); other == keyedEmail {
+			t.Fatalf("expected a different key to produce a different mask, got %s", other)
+		}
+	})
+}
+
+func TestLoadCacheDiscardsOtherHashKey(t *testing.T) {
+	withTestGlobals(t, func() {
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.json")
+
+		HashKey = []byte("0123456789abcdef-secret")
+		cache := newCache()
+		cache.Emails["test@example.com"] = "keyed@example.com"
+		if err := saveCache(cache); err != nil {
+			t.Fatalf("Error saving cache: %v", err)
+		}
+		data, err := os.ReadFile(AppConfig.CachePath)
+		if err != nil {
+			t.Fatalf("failed to read cache: %v", err)
+		}
+		if strings.Contains(string(data), string(HashKey)) {
+			t.Fatalf("expected the hash key never stored in the cache, got: %s", data)
+		}
+
+		if loaded, err := loadCache(); err != nil || loaded.Emails["test@example.com"] != "keyed@example.com" {
+			t.Fatalf("expected cache reused with the same key, got: %v, %v", loaded.Emails, err)
+		}
+
+		HashKey = nil
+		loaded, err := loadCache()
+		if err == nil || len(loaded.Emails) != 0 {
+			t.Fatalf("expected cache of another key discarded, got: %v, %v", loaded.Emails, err)
+		}
+	})
+}
+
+func TestEncryptedCacheRoundTrip(t *testing.T) {
+	withTestGlobals(t, func() {
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.json")
+		CacheKey = []byte("cache-secret-0123456789")
+
+		cache := newCache()
+		cache.Emails["test@example.com"] = "t098f6b@example.com"
+		if err := saveCache(cache); err != nil {
+			t.Fatalf("Error saving cache: %v", err)
+		}
+
+		info, err := os.Stat(AppConfig.CachePath)
+		if err != nil {
+			t.Fatalf("expected cache file written: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected owner-only permissions, got %v", info.Mode().Perm())
+		}
+		data, _ := os.ReadFile(AppConfig.CachePath)
+		if strings.Contains(string(data), "test@example.com") || !isEncryptedCache(data) {
+			t.Fatalf("expected encrypted cache without plaintext PII, got: %q", data)
+		}
+
+		loaded, err := loadCache()
+		if err != nil || loaded.Emails["test@example.com"] != "t098f6b@example.com" {
+			t.Fatalf("expected encrypted cache loaded, got: %v, %v", loaded.Emails, err)
+		}
+	})
+}
+
+func TestEncryptedCacheRefusesTamperingAndWrongKey(t *testing.T) {
+	withTestGlobals(t, func() {
+		AppConfig.CachePath = filepath.Join(t.TempDir(), "cache.json")
+		CacheKey = []byte("cache-secret-0123456789")
+		if err := saveCache(newCache()); err != nil {
+			t.Fatalf("Error saving cache: %v", err)
+		}
+		original, _ := os.ReadFile(AppConfig.CachePath)
+
+		tampered := append([]byte(nil), original...)
+		tampered[len(tampered)-1] ^= 0xff
+		if err := os.WriteFile(AppConfig.CachePath, tampered, 0600); err != nil {
+			t.Fatalf("failed to write fixture: %v", err)
+		}
+		if _, err := loadCache(); !errors.Is(err, errCacheIntegrity) {
+			t.Fatalf("expected tampered cache refused, got: %v", err)
+		}
+
+		if err := os.WriteFile(AppConfig.CachePath, original, 0600); err != nil {
+			t.Fatalf("failed to write fixture: %v", err)
+		}
+		CacheKey = []byte("another-secret-0123456789")
+		if _, err := loadCache(); !errors.Is(err, errCacheIntegrity) {
+			t.Fatalf("expected wrong-key cache refused, got: %v", err)
+		}
+
+		CacheKey = nil
+		if _, err := loadCache(); !errors.Is(err, errCacheIntegrity) {
+			t.Fatalf("expected encrypted cache refused without a key, got: %v", err)
+		}
+	})
+}
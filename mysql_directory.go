@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// mydumperChunkRegex matches the chunk number mydumper appends to the data
+// files of large tables: db.table.00001.sql.
+var mydumperChunkRegex = regexp.MustCompile(`\.\d+$`)
+
+// maskMySQLDirectory masks the mydumper or mysqldump --tab dump in inDir
+// into outDir, mirroring its directory structure:
+//
+//   - mydumper data files (db.table.sql, db.table.00001.sql) run through a
+//     MySQL parser of their own after the table's db.table-schema.sql;
+//   - mysqldump --tab data files (table.txt) are read in the LOAD DATA text
+//     format with the columns of the CREATE TABLE in table.sql.
+//
+// Data files keep their gzip or zstd compression and are masked one after
+// another, each on the worker pool (see maskDumpFiles). Schema files and
+// every other file are copied unchanged.
+func (m *streamMasker) maskMySQLDirectory(inDir, outDir string) error {
+	tables := 0
+	files, err := mirrorDumpDirectory(inDir, outDir, func(path, rel, outPath string) (dumpFile, bool, error) {
+		dir := filepath.Dir(path)
+		name := trimDumpCompression(filepath.Base(path))
+		switch ext := filepath.Ext(name); {
+		case strings.HasSuffix(name, "-schema.sql"):
+			tables++
+		case ext == ".txt":
+			table := strings.TrimSuffix(name, ext)
+			schema, ok := findDumpFile(dir, table+".sql")
+			if !ok {
+				// The columns of the rows are unknown.
+				m.rt.reportUnmasked("%s: mysqldump --tab data file without %s.sql is not masked: the file is copied unchanged", rel, table)
+				return dumpFile{}, false, m.rt.StrictError()
+			}
+			tables++
+			return dumpFile{
+				name: rel,
+				what: "data of " + table,
+				mask: func() (int, error) {
+					return m.maskTabDataFile(table, filepath.Join(dir, schema), path, outPath)
+				},
+			}, true, nil
+		case ext == ".sql" || ext == ".dat":
+			base := strings.TrimSuffix(name, ext)
+			if strings.Contains(base, "-schema") {
+				// Database, view, trigger and post-data schema files.
+				break
+			}
+			if _, ok := findDumpFile(dir, base+".txt"); ok && ext == ".sql" {
+				// The CREATE TABLE of a mysqldump --tab data file.
+				break
+			}
+			table := mydumperChunkRegex.ReplaceAllString(base, "")
+			schema, ok := findDumpFile(dir, table+"-schema.sql")
+			if ok {
+				schema = filepath.Join(dir, schema)
+			} else {
+				// mydumper --no-schemas: INSERT statements are masked by
+				// their column lists, as in a plain dump.
+				schema = ""
+				tables++
+			}
+			if ext == ".dat" {
+				// mydumper --load-data writes data in a format its
+				// .sql file describes; it is not read here.
+				m.rt.reportUnmasked("%s: mydumper LOAD DATA files are not masked: the file is copied unchanged", rel)
+				return dumpFile{}, false, m.rt.StrictError()
+			}
+			return dumpFile{
+				name: rel,
+				what: "data of " + table,
+				mask: func() (int, error) {
+					return m.maskMydumperFile(schema, path, outPath)
+				},
+			}, true, nil
+		}
+		return dumpFile{}, false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if tables == 0 {
+		return fmt.Errorf("%s holds no pg_dump %s, mydumper schema files or mysqldump --tab data files", inDir, pgDirectoryTOC)
+	}
+	return m.maskDumpFiles(files)
+}
+
+// trimDumpCompression strips the suffix of a gzip or zstd compressed file.
+func trimDumpCompression(name string) string {
+	for _, suffix := range []string{".gz", ".zst"} {
+		if trimmed, ok := strings.CutSuffix(name, suffix); ok {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// findDumpFile returns the name on disk of a file in dir, which may carry
+// the suffix of its compression.
+func findDumpFile(dir, name string) (string, bool) {
+	for _, suffix := range []string{"", ".gz", ".zst"} {
+		if info, err := os.Stat(filepath.Join(dir, name+suffix)); err == nil && info.Mode().IsRegular() {
+			return name + suffix, true
+		}
+	}
+	return "", false
+}
+
+// readDumpText returns the decompressed content of a schema file.
+func readDumpText(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	r, _, err := openDumpInput(file)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = r.Close() }()
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+// maskMydumperFile masks one mydumper data file with a MySQL parser of its
+// own, after the table's schema file unless schemaPath is "", and returns
+// the number of lines read.
+func (m *streamMasker) maskMydumperFile(schemaPath, inPath, outPath string) (int, error) {
+	var schema string
+	if schemaPath != "" {
+		text, err := readDumpText(schemaPath)
+		if err != nil {
+			return 0, err
+		}
+		schema = text
+	}
+	masker := m.fileMasker(NewDialectParser(DialectMySQL, m.rt))
+	err := rewriteDumpFile(inPath, outPath, 0, func(r io.Reader, w *bufio.Writer) error {
+		// The CREATE TABLE gives INSERT statements without column lists
+		// their column positions.
+		if err := masker.discard(schema); err != nil {
+			return err
+		}
+		return masker.maskDump(r, w)
+	})
+	return masker.lines, err
+}
+
+// maskTabDataFile masks one mysqldump --tab data file and returns the
+// number of lines read.
+func (m *streamMasker) maskTabDataFile(table, schemaPath, inPath, outPath string) (int, error) {
+	schema, err := readDumpText(schemaPath)
+	if err != nil {
+		return 0, err
+	}
+	masker := m.fileMasker(newTabDataParser(m.rt, table, schema, m.config))
+	err = rewriteDumpFile(inPath, outPath, 0, func(r io.Reader, w *bufio.Writer) error {
+		return masker.maskDump(r, w)
+	})
+	return masker.lines, err
+}
+
+// tabDataParser reads the rows of one table in the text format of LOAD
+// DATA INFILE, as mysqldump --tab writes them: tab-separated values with
+// backslash escapes and \N for NULL, one row per line.
+type tabDataParser struct {
+	rt     *Runtime
+	drop   bool
+	noMask bool
+	masks  columnMasks
+	stats  *tableStats
+	rows   copyRowCollector
+}
+
+// newTabDataParser decides how the rows of table are treated, with the
+// column order of the CREATE TABLE statement in schema.
+func newTabDataParser(rt *Runtime, table, schema string, config MaskConfig) *tabDataParser {
+	p := &tabDataParser{
+		rt:    rt,
+		stats: rt.Stats.table(table),
+		rows:  copyRowCollector{format: loadDataFormat},
+	}
+	switch {
+	case isSkippedTable(rt, table, false):
+		p.drop = true
+	case isNoMaskTable(rt, table, false):
+		p.noMask = true
+	default:
+		tableKey, tableConfig, ok := lookupProcessingTable(rt, table, false)
+		if !ok {
+			break
+		}
+		proc := newSQLStatementProcessor(rt, DialectMySQL)
+		for _, line := range strings.Split(schema, "\n") {
+			proc.processCreateTableLine(line)
+		}
+		columns, _ := proc.columnsFor(table)
+		if len(columns) == 0 {
+			// Safety rule: no confident column positions, no masking.
+			rt.reportUnmasked("cannot parse CREATE TABLE for table %s: rows pass through unmasked", table)
+			break
+		}
+		p.masks = fieldPositions(rt, tableKey, tableConfig, columns, config, false)
+	}
+	return p
+}
+
+// Dialect implements DialectParser.
+func (p *tabDataParser) Dialect() DumpDialect { return DialectMySQL }
+
+// ProcessLine implements DialectParser.
+func (p *tabDataParser) ProcessLine(line string, config MaskConfig, cache *Cache) (string, bool) {
+	job, drop := p.prepareLine(line, config, cache)
+	return job.run(), drop
+}
+
+// prepareLine implements jobParser.
+func (p *tabDataParser) prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool) {
+	row, ok := p.rows.collect(p.rt, line)
+	if !ok {
+		return maskJob{}, true // held until the escaped line break ends
+	}
+	body, newline := splitTrailingNewline(row)
+	p.stats.addRows(1, p.drop, p.noMask)
+	switch {
+	case p.drop:
+		return maskJob{}, true
+	case p.noMask:
+		return maskJob{text: row}, false
+	case len(p.masks) > 0:
+		rt, masks, stats := p.rt, p.masks, p.stats
+		return maskJob{mask: func() string {
+			return maskCopyRow(rt, body, loadDataFormat, masks, cache, stats) + newline
+		}}, false
+	case len(p.rt.ProcessingTables) > 0:
+		// Selective mode masks only configured fields.
+		return maskJob{text: row}, false
+	}
+	return fullLineJob(p.rt, maskJob{text: body}, config, cache, p.stats).withSuffix(newline), false
+}
+
+// prepareFlush implements jobParser: a row whose escaped line break ends
+// the input passes through.
+func (p *tabDataParser) prepareFlush(MaskConfig, *Cache) maskJob {
+	return maskJob{text: p.rows.takePending(p.rt)}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDumpFiles writes files under dir, compressing the .gz and .zst ones.
+func writeDumpFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		var buf bytes.Buffer
+		format := map[string]string{".gz": "gzip", ".zst": "zstd"}[filepath.Ext(name)]
+		w, err := outputCompression{format: format}.writer(&buf)
+		if err != nil {
+			t.Fatalf("failed to create compressor: %v", err)
+		}
+		if w == nil {
+			buf.WriteString(data)
+		} else {
+			_, _ = io.WriteString(w, data)
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+		}
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+// maskTestMySQLDirectory masks inDir into a new directory and returns its
+// path and the masker.
+func maskTestMySQLDirectory(t *testing.T, inDir string) (string, *streamMasker) {
+	t.Helper()
+
+	outPath := filepath.Join(t.TempDir(), "masked")
+	out, err := openDumpDirectory(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := newTestRuntime()
+	masker := &streamMasker{parser: NewDialectParser(DialectMySQL, rt), rt: rt, config: bothAlgorithms(), workers: 2}
+	if err := masker.maskMySQLDirectory(inDir, out.tmp); err != nil {
+		t.Fatalf("masking failed: %v", err)
+	}
+	if err := out.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	return outPath, masker
+}
+
+const testMySQLUsersSchema = "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `email` varchar(255) DEFAULT NULL,\n  `note` text,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB;\n"
+
+func TestMaskMydumperDirectory(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{"users": {Email: []string{"email"}}}
+		SkipTableList = map[string]struct{}{"secrets": {}}
+
+		files := map[string]string{
+			"metadata":                          "Started dump at: 2026-10-17 03:00:00\n",
+			"app/app-schema-create.sql":         "CREATE DATABASE `app`;\n",
+			"app/app.users-schema.sql.gz":       testMySQLUsersSchema,
+			"app/app.users.00000.sql.gz":        "INSERT INTO `users` VALUES(1,'test@example.com','keep alice@example.com');\n",
+			"app/app.users.00001.sql.zst":       "INSERT INTO `users` VALUES\n(2,'test@example.com',NULL),\n(3,NULL,'x');\n",
+			"app/app.users-schema-triggers.sql": "CREATE TRIGGER `t` BEFORE INSERT ON `users` FOR EACH ROW SET NEW.note = 'bob@example.com';\n",
+			"app/app.secrets-schema.sql":        "CREATE TABLE `secrets` (`id` int, `token` text);\n",
+			"app/app.secrets.sql":               "INSERT INTO `secrets` VALUES (1,'s3cr3t');\n",
+		}
+		inDir := t.TempDir()
+		writeDumpFiles(t, inDir, files)
+		outPath, masker := maskTestMySQLDirectory(t, inDir)
+
+		want := map[string]string{
+			"app/app.users.00000.sql.gz":  "INSERT INTO `users` VALUES(1,'t098f6b@example.com','keep alice@example.com');\n",
+			"app/app.users.00001.sql.zst": "INSERT INTO `users` VALUES\n(2,'t098f6b@example.com',NULL),\n(3,NULL,'x');\n",
+			"app/app.secrets.sql":         "",
+		}
+		for name, data := range files {
+			got, format := readDumpFile(t, filepath.Join(outPath, name))
+			_, wantFormat := readDumpFile(t, filepath.Join(inDir, name))
+			if masked, ok := want[name]; ok {
+				data = masked
+			}
+			if got != data || format != wantFormat {
+				t.Fatalf("%s: expected %s %q, got %s %q", name, wantFormat, data, format, got)
+			}
+		}
+		if masker.lines != 5 {
+			t.Fatalf("expected 5 data lines counted, got %d", masker.lines)
+		}
+	})
+}
+
+func TestMaskTabDirectory(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{"users": {Email: []string{"email"}}}
+
+		users := "1\ttest@example.com\tkeep alice@example.com\n" +
+			"2\t\\N\t\\N\n" +
+			"3\tte\\\\st@example.com\tline\\\nbreak\\\tand tab\n" +
+			"4\ttest@example.com\t\n"
+		files := map[string]string{
+			"users.sql":  testMySQLUsersSchema,
+			"users.txt":  users,
+			"orders.sql": "CREATE TABLE `orders` (`id` int, `email` text);\n",
+			"orders.txt": "1\tbob@example.com\n",
+		}
+		inDir := t.TempDir()
+		writeDumpFiles(t, inDir, files)
+		outPath, _ := maskTestMySQLDirectory(t, inDir)
+
+		got, _ := readDumpFile(t, filepath.Join(outPath, "users.txt"))
+		lines := strings.SplitAfter(got, "\n")
+		if len(lines) != 6 || lines[0] != "1\tt098f6b@example.com\tkeep alice@example.com\n" ||
+			lines[1] != "2\t\\N\t\\N\n" || lines[3] != "break\\\tand tab\n" || lines[4] != "4\tt098f6b@example.com\t\n" {
+			t.Fatalf("unexpected masked rows %q", got)
+		}
+		// The escaped email is masked; the escaped line break keeps the
+		// row's other value intact.
+		if lines[2] == "3\tte\\\\st@example.com\tline\\\n" || !strings.HasSuffix(lines[2], "@example.com\tline\\\n") {
+			t.Fatalf("expected the escaped email masked and the row kept, got %q", lines[2])
+		}
+		for _, name := range []string{"users.sql", "orders.sql", "orders.txt"} {
+			if got, _ := readDumpFile(t, filepath.Join(outPath, name)); got != files[name] {
+				t.Fatalf("%s: expected %q copied, got %q", name, files[name], got)
+			}
+		}
+	})
+}
+
+func TestMaskMySQLDirectoryWithoutSchemas(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{"users": {Email: []string{"email"}}}
+
+		// mydumper --no-schemas --complete-insert: the column lists place
+		// the values.
+		inDir := t.TempDir()
+		writeDumpFiles(t, inDir, map[string]string{
+			"metadata":             "Started dump at: 2026-10-17 03:00:00\n",
+			"app/app.users.sql.gz": "INSERT INTO `users` (`id`,`email`) VALUES(1,'test@example.com');\n",
+		})
+		outPath, _ := maskTestMySQLDirectory(t, inDir)
+		if got, _ := readDumpFile(t, filepath.Join(outPath, "app/app.users.sql.gz")); got != "INSERT INTO `users` (`id`,`email`) VALUES(1,'t098f6b@example.com');\n" {
+			t.Fatalf("expected the data file masked by its column list, got %q", got)
+		}
+
+		for name, tt := range map[string]struct {
+			files map[string]string
+			want  string
+		}{
+			"mydumper without column lists": {
+				files: map[string]string{"app/app.users.sql": "INSERT INTO `users` VALUES(1,'test@example.com');\n"},
+				want:  "no column information for table `users`",
+			},
+			"mysqldump --tab without table.sql": {
+				files: map[string]string{"orders.sql": "CREATE TABLE `orders` (`id` int);\n", "orders.txt": "1\n", "users.txt": "1\ttest@example.com\n"},
+				want:  "users.txt: mysqldump --tab data file without users.sql is not masked",
+			},
+		} {
+			inDir := t.TempDir()
+			writeDumpFiles(t, inDir, tt.files)
+			rt := newTestRuntime()
+			rt.Strict = true
+			masker := &streamMasker{parser: NewDialectParser(DialectMySQL, rt), rt: rt, config: bothAlgorithms(), workers: 2}
+			if err := masker.maskMySQLDirectory(inDir, t.TempDir()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("%s: expected strict mode to fail with %q, got %v", name, tt.want, err)
+			}
+		}
+	})
+}
+
+func TestMaskMySQLDirectoryRejectsOtherContent(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		inDir := t.TempDir()
+		writeDumpFiles(t, inDir, map[string]string{"notes.txt": "hello\n"})
+
+		rt := newTestRuntime()
+		masker := &streamMasker{parser: NewDialectParser(DialectMySQL, rt), rt: rt, config: bothAlgorithms(), workers: 1}
+		if err := masker.maskMySQLDirectory(inDir, t.TempDir()); err == nil || !strings.Contains(err.Error(), "mydumper schema files") {
+			t.Fatalf("expected a directory without a dump rejected, got %v", err)
+		}
+	})
+}
+
+func TestCLIMasksMySQLDirectory(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"users": {"email": ["email"]}}`)
+	inDir := filepath.Join(runtimeDir, "tab")
+	writeDumpFiles(t, inDir, map[string]string{
+		"users.sql": testMySQLUsersSchema,
+		"users.txt": "1\ttest@example.com\t\\N\n",
+	})
+
+	outDir := filepath.Join(runtimeDir, "masked")
+	if _, stderr, err := run(nil, "--input-dir", inDir, "--output", outDir); err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	if users, _ := readDumpFile(t, filepath.Join(outDir, "users.txt")); users != "1\tt098f6b@example.com\t\\N\n" {
+		t.Fatalf("expected the email masked, got %q", users)
+	}
+
+	_, stderr, err := run(nil, "--input-dir", inDir, "--output", filepath.Join(runtimeDir, "pg"), "--db-format=postgresql")
+	if err == nil || !strings.Contains(stderr, "mysqldump --tab directory") {
+		t.Fatalf("expected --db-format=postgresql rejected, got err=%v, stderr=%s", err, stderr)
+	}
+}
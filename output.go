@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// dumpOutput is the destination of the masked dump. Without a path and
+// without spooling it writes straight to stdout. With a path the dump goes to
+// a temporary file next to it that is renamed into place on Commit. With
+// spool (strict mode on stdout) it is held in a temporary file and copied to
+// stdout only on Commit. In the last two cases Abort leaves no partially
+// masked dump behind. With compression the dump is compressed on the way to
+// its destination.
+type dumpOutput struct {
+	*bufio.Writer
+	compressor io.WriteCloser
+	file       *os.File
+	path       string
+}
+
+// openDumpOutput prepares the output for path ("" means stdout).
+func openDumpOutput(path string, spool bool, compression outputCompression) (*dumpOutput, error) {
+	var dest io.Writer = os.Stdout
+	o := &dumpOutput{path: path}
+	if path != "" || spool {
+		dir, pattern := os.TempDir(), "maskdump-spool-*"
+		if path != "" {
+			dir, pattern = filepath.Dir(path), "."+filepath.Base(path)+".tmp-*"
+		}
+		file, err := os.CreateTemp(dir, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %v", err)
+		}
+		o.file = file
+		dest = file
+	}
+
+	compressor, err := compression.writer(dest)
+	if err != nil {
+		o.Abort()
+		return nil, fmt.Errorf("failed to start %s compression: %v", compression.format, err)
+	}
+	if compressor != nil {
+		o.compressor = compressor
+		dest = compressor
+	}
+	o.Writer = bufio.NewWriterSize(dest, defaultMaxBufferSize)
+	return o, nil
+}
+
+// Commit flushes the dump and publishes it.
+func (o *dumpOutput) Commit() error {
+	if err := o.Flush(); err != nil {
+		o.Abort()
+		return err
+	}
+	if o.compressor != nil {
+		if err := o.compressor.Close(); err != nil {
+			o.Abort()
+			return err
+		}
+	}
+	if o.file == nil {
+		return nil
+	}
+
+	if o.path != "" {
+		// Match what a shell redirection would create.
+		if err := o.file.Chmod(0644); err != nil {
+			o.Abort()
+			return err
+		}
+		if err := o.file.Close(); err != nil {
+			o.Abort()
+			return err
+		}
+		if err := os.Rename(o.file.Name(), o.path); err != nil {
+			o.Abort()
+			return err
+		}
+		return nil
+	}
+
+	defer o.Abort()
+	if _, err := o.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	stdout := bufio.NewWriterSize(os.Stdout, defaultMaxBufferSize)
+	if _, err := io.Copy(stdout, o.file); err != nil {
+		return err
+	}
+	return stdout.Flush()
+}
+
+// Abort discards the temporary file, if any.
+func (o *dumpOutput) Abort() {
+	if o.file == nil {
+		return
+	}
+	_ = o.file.Close()
+	_ = os.Remove(o.file.Name())
+}
+
+// writeAt overwrites already written bytes of the dump at off. It needs a
+// file destination without compression.
+func (o *dumpOutput) writeAt(p []byte, off int64) error {
+	if o.file == nil || o.compressor != nil {
+		return errors.New("output is not seekable")
+	}
+	if err := o.Flush(); err != nil {
+		return err
+	}
+	_, err := o.file.WriteAt(p, off)
+	return err
+}
+
+// dumpDirectory is the destination of a masked directory-format dump: a
+// temporary directory next to path that is renamed into place on Commit.
+// Like pg_dump, it refuses to write into a directory that has content.
+type dumpDirectory struct {
+	path string
+	tmp  string
+}
+
+// openDumpDirectory prepares the output directory path.
+func openDumpDirectory(path string) (*dumpDirectory, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("invalid output directory: %v", err)
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("output directory %s is not empty", path)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	return &dumpDirectory{path: path, tmp: tmp}, nil
+}
+
+// Commit publishes the dump, replacing an empty directory at its path.
+func (d *dumpDirectory) Commit() error {
+	if err := os.Remove(d.path); err != nil && !os.IsNotExist(err) {
+		d.Abort()
+		return err
+	}
+	if err := os.Rename(d.tmp, d.path); err != nil {
+		d.Abort()
+		return err
+	}
+	return nil
+}
+
+// Abort discards the temporary directory.
+func (d *dumpDirectory) Abort() {
+	_ = os.RemoveAll(d.tmp)
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// pg_dump custom-format archives (pg_dump -Fc) consist of a header, the
+// table of contents (TOC) and one data block per TOC entry with data, in the
+// layout of PostgreSQL's pg_backup_archiver.c and pg_backup_custom.c. Table
+// data blocks hold the COPY rows (or INSERT statements) of one table as a
+// compressed stream cut into length-prefixed chunks. Directory-format dumps
+// (pg_dump -Fd) store the same header and TOC in toc.dat, with a data file
+// name in place of each data offset.
+
+const pgArchiveMagic = "PGDMP"
+
+// Archive layout constants of pg_backup_archiver.h.
+const (
+	pgArchiveFormatCustom    = 1
+	pgArchiveFormatDirectory = 3
+
+	pgBlockData  = 1
+	pgBlockBlobs = 3
+
+	pgOffsetNotSet = 1
+	pgOffsetSet    = 2
+	pgOffsetNoData = 3
+
+	pgCompressionNone = 0
+	pgCompressionGzip = 1
+	pgCompressionLZ4  = 2
+	pgCompressionZstd = 3
+)
+
+// pgArchiveVersion builds an archive version number like
+// MAKE_ARCHIVE_VERSION.
+func pgArchiveVersion(major, minor, rev byte) int {
+	return int(major)<<16 | int(minor)<<8 | int(rev)
+}
+
+var (
+	// pgArchiveMinVersion is the oldest supported archive version
+	// (pg_dump 9.0).
+	pgArchiveMinVersion = pgArchiveVersion(1, 12, 0)
+	// pgArchiveTableAMVersion added the table access method to the TOC.
+	pgArchiveTableAMVersion = pgArchiveVersion(1, 14, 0)
+	// pgArchiveCompressionVersion replaced the compression level in the
+	// header by the compression algorithm.
+	pgArchiveCompressionVersion = pgArchiveVersion(1, 15, 0)
+	// pgArchiveRelkindVersion added the relation kind to the TOC.
+	pgArchiveRelkindVersion = pgArchiveVersion(1, 16, 0)
+	// pgArchiveMaxVersion is the newest supported archive version.
+	pgArchiveMaxVersion = pgArchiveVersion(1, 16, 0)
+)
+
+// pgChunkSize is the size of the data chunks written to an archive.
+const pgChunkSize = 64 << 10
+
+// isPgArchive reports whether the input starts like a pg_dump archive.
+func isPgArchive(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(pgArchiveMagic))
+	return string(magic) == pgArchiveMagic
+}
+
+// pgTocEntry is the part of a TOC entry maskdump needs.
+type pgTocEntry struct {
+	dumpID    int
+	tag       string
+	desc      string
+	defn      string
+	copyStmt  string
+	namespace string
+	// offsetAt is the position of the data offset field in the archive
+	// head, dataState the flag stored in it.
+	offsetAt  int
+	dataState byte
+	// file is the data file of a directory-format entry, "" for none.
+	file string
+}
+
+// name returns the schema-qualified name of the entry's object.
+func (e *pgTocEntry) name() string {
+	if e.namespace == "" {
+		return e.tag
+	}
+	return e.namespace + "." + e.tag
+}
+
+// pgArchive is the header and TOC of a custom- or directory-format archive.
+type pgArchive struct {
+	version int
+	format  byte
+	intSize int
+	offSize int
+	// compression is the algorithm of the data blocks, level its level
+	// for archives older than pgArchiveCompressionVersion.
+	compression byte
+	level       int
+	// head holds the header and TOC bytes as read.
+	head    []byte
+	entries []*pgTocEntry
+	byID    map[int]*pgTocEntry
+}
+
+// pgArchiveReader reads archive primitives. The first error sticks: later
+// reads return zero values and err reports it. While head is set every byte
+// read is also appended to it.
+type pgArchiveReader struct {
+	r       *bufio.Reader
+	head    *bytes.Buffer
+	intSize int
+	offSize int
+	err     error
+}
+
+func (a *pgArchiveReader) read(n int) []byte {
+	if a.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(a.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		a.err = err
+		return nil
+	}
+	if a.head != nil {
+		a.head.Write(buf)
+	}
+	return buf
+}
+
+func (a *pgArchiveReader) readByte() byte {
+	if b := a.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// readInt reads a sign byte and an intSize-byte little-endian magnitude.
+func (a *pgArchiveReader) readInt() int {
+	b := a.read(1 + a.intSize)
+	if b == nil {
+		return 0
+	}
+	v := 0
+	for i := a.intSize; i >= 1; i-- {
+		v = v<<8 | int(b[i])
+	}
+	if b[0] != 0 {
+		v = -v
+	}
+	return v
+}
+
+// readStr reads a length-prefixed string; ok is false for NULL.
+func (a *pgArchiveReader) readStr() (s string, ok bool) {
+	n := a.readInt()
+	if a.err != nil || n < 0 {
+		return "", false
+	}
+	if n > 1<<30 {
+		a.err = fmt.Errorf("string of %d bytes", n)
+		return "", false
+	}
+	return string(a.read(n)), true
+}
+
+// readPgArchiveHead reads the header and TOC of a custom-format archive or
+// of a directory-format toc.dat.
+func readPgArchiveHead(r *bufio.Reader) (*pgArchive, error) {
+	a := &pgArchiveReader{r: r, head: &bytes.Buffer{}}
+	if magic := a.read(len(pgArchiveMagic)); a.err == nil && string(magic) != pgArchiveMagic {
+		return nil, errors.New("missing PGDMP signature")
+	}
+	fields := a.read(6)
+	if a.err != nil {
+		return nil, a.err
+	}
+	arch := &pgArchive{
+		version: pgArchiveVersion(fields[0], fields[1], fields[2]),
+		intSize: int(fields[3]),
+		offSize: int(fields[4]),
+		format:  fields[5],
+		byID:    make(map[int]*pgTocEntry),
+	}
+	if arch.version < pgArchiveMinVersion || arch.version > pgArchiveMaxVersion {
+		return nil, fmt.Errorf("unsupported archive version %d.%d (supported: 1.12 to 1.16)", fields[0], fields[1])
+	}
+	if arch.intSize < 1 || arch.intSize > 8 || arch.offSize < 1 || arch.offSize > 8 {
+		return nil, fmt.Errorf("unsupported integer sizes %d/%d", arch.intSize, arch.offSize)
+	}
+	if arch.format != pgArchiveFormatCustom && arch.format != pgArchiveFormatDirectory {
+		return nil, fmt.Errorf("unsupported archive format %d", arch.format)
+	}
+	a.intSize, a.offSize = arch.intSize, arch.offSize
+
+	if arch.version >= pgArchiveCompressionVersion {
+		arch.compression = a.readByte()
+	} else if arch.level = a.readInt(); arch.level != 0 {
+		arch.compression = pgCompressionGzip
+	}
+	// Creation time (seven ints), database name, server and pg_dump
+	// versions.
+	for i := 0; i < 7; i++ {
+		a.readInt()
+	}
+	for i := 0; i < 3; i++ {
+		a.readStr()
+	}
+
+	count := a.readInt()
+	for i := 0; i < count && a.err == nil; i++ {
+		entry := arch.readTocEntry(a)
+		arch.entries = append(arch.entries, entry)
+		arch.byID[entry.dumpID] = entry
+	}
+	if a.err != nil {
+		return nil, fmt.Errorf("truncated header or TOC: %v", a.err)
+	}
+	arch.head = a.head.Bytes()
+	return arch, nil
+}
+
+// readTocEntry reads one TOC entry including the custom format's data
+// offset or the directory format's data file name.
+func (arch *pgArchive) readTocEntry(a *pgArchiveReader) *pgTocEntry {
+	e := &pgTocEntry{}
+	e.dumpID = a.readInt()
+	a.readInt() // has data dumper
+	a.readStr() // table OID
+	a.readStr() // OID
+	e.tag, _ = a.readStr()
+	e.desc, _ = a.readStr()
+	a.readInt() // section
+	e.defn, _ = a.readStr()
+	a.readStr() // drop statement
+	e.copyStmt, _ = a.readStr()
+	e.namespace, _ = a.readStr()
+	a.readStr() // tablespace
+	if arch.version >= pgArchiveTableAMVersion {
+		a.readStr() // table access method
+	}
+	if arch.version >= pgArchiveRelkindVersion {
+		a.readInt() // relation kind
+	}
+	a.readStr() // owner
+	a.readStr() // with OIDs
+	for {
+		if _, ok := a.readStr(); !ok {
+			break // end of the dependency list
+		}
+	}
+
+	if arch.format == pgArchiveFormatDirectory {
+		e.file, _ = a.readStr()
+		return e
+	}
+	e.offsetAt = a.head.Len()
+	e.dataState = a.readByte()
+	a.read(arch.offSize)
+	if a.err == nil && (e.dataState < pgOffsetNotSet || e.dataState > pgOffsetNoData) {
+		a.err = fmt.Errorf("unexpected data offset flag %d", e.dataState)
+	}
+	return e
+}
+
+// headWithOffsets returns the header and TOC with the data offsets of the
+// entries in positions set and the others marked as unknown; entries
+// without data keep their flag.
+func (arch *pgArchive) headWithOffsets(positions map[int]int64) []byte {
+	head := append([]byte(nil), arch.head...)
+	for _, e := range arch.entries {
+		if e.dataState == pgOffsetNoData {
+			continue
+		}
+		field := head[e.offsetAt : e.offsetAt+1+arch.offSize]
+		pos, ok := positions[e.dumpID]
+		field[0] = pgOffsetNotSet
+		if ok {
+			field[0] = pgOffsetSet
+		}
+		for i := 1; i < len(field); i++ {
+			field[i] = byte(pos)
+			pos >>= 8
+		}
+	}
+	return head
+}
+
+// pgInt encodes an archive integer.
+func (arch *pgArchive) pgInt(v int) []byte {
+	b := make([]byte, 1+arch.intSize)
+	if v < 0 {
+		b[0] = 1
+		v = -v
+	}
+	for i := 1; i < len(b); i++ {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// checkCompression rejects compression algorithms maskdump cannot rewrite.
+func (arch *pgArchive) checkCompression() error {
+	switch arch.compression {
+	case pgCompressionNone, pgCompressionGzip, pgCompressionZstd:
+		return nil
+	case pgCompressionLZ4:
+		return errors.New("LZ4-compressed pg_dump archives are not supported: dump with --compress=gzip or zstd")
+	}
+	return fmt.Errorf("unsupported pg_dump archive compression %d", arch.compression)
+}
+
+// decompressor returns the reader of a data block's payload. A payload
+// without any chunk is empty.
+func (arch *pgArchive) decompressor(chunks io.Reader) (io.Reader, error) {
+	payload := bufio.NewReader(chunks)
+	if _, err := payload.Peek(1); err == io.EOF {
+		return payload, nil
+	}
+	switch arch.compression {
+	case pgCompressionNone:
+		return payload, nil
+	case pgCompressionGzip:
+		return zlib.NewReader(payload)
+	case pgCompressionZstd:
+		zr, err := zstd.NewReader(payload)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported archive compression %d", arch.compression)
+}
+
+// compressor returns the writer compressing a data block's payload with
+// the archive's algorithm, or nil for uncompressed archives.
+func (arch *pgArchive) compressor(w io.Writer) (io.WriteCloser, error) {
+	switch arch.compression {
+	case pgCompressionNone:
+		return nil, nil
+	case pgCompressionGzip:
+		level := arch.level
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		return zlib.NewWriterLevel(w, level)
+	case pgCompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported archive compression %d", arch.compression)
+}
+
+// pgChunkReader reads the payload of a data block: length-prefixed chunks
+// up to a zero length.
+type pgChunkReader struct {
+	a    *pgArchiveReader
+	left int
+	done bool
+}
+
+func (c *pgChunkReader) Read(p []byte) (int, error) {
+	for c.left == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		n := c.a.readInt()
+		if c.a.err != nil {
+			return 0, c.a.err
+		}
+		if n < 0 {
+			return 0, fmt.Errorf("invalid chunk length %d", n)
+		}
+		c.left = n
+		c.done = n == 0
+	}
+	if len(p) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.a.r.Read(p)
+	c.left -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// pgChunkWriter writes a data block payload as length-prefixed chunks. The
+// terminating zero length is written by the caller.
+type pgChunkWriter struct {
+	w    io.Writer
+	arch *pgArchive
+}
+
+func (c *pgChunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := c.w.Write(c.arch.pgInt(len(p))); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// copyPgChunks copies a chunked payload unchanged, including its
+// terminator.
+func copyPgChunks(a *pgArchiveReader, w io.Writer, arch *pgArchive) error {
+	if _, err := io.Copy(&pgChunkWriter{w: w, arch: arch}, &pgChunkReader{a: a}); err != nil {
+		return err
+	}
+	_, err := w.Write(arch.pgInt(0))
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archiveOutput receives a rewritten archive. writeAt patches bytes already
+// written; it fails when the destination cannot seek.
+type archiveOutput interface {
+	io.Writer
+	writeAt(p []byte, off int64) error
+}
+
+// maskPgArchive rewrites a custom-format archive from r to out. The rows of
+// table data entries run through the parser like the COPY blocks (or INSERT
+// statements) of a plain dump and are recompressed with the archive's
+// compression; the header, the TOC and every other block are copied
+// unchanged, except for the data offsets in the TOC.
+func (m *streamMasker) maskPgArchive(r *bufio.Reader, out archiveOutput) error {
+	arch, err := readPgArchiveHead(r)
+	if err != nil {
+		return fmt.Errorf("invalid pg_dump archive: %v", err)
+	}
+	if arch.format != pgArchiveFormatCustom {
+		return errors.New("input is the toc.dat of a directory-format dump: mask the directory with --input-dir")
+	}
+	if err := arch.checkCompression(); err != nil {
+		return err
+	}
+
+	// Table definitions give INSERT-style data without column lists its
+	// column positions.
+	for _, e := range arch.entries {
+		if e.desc == "TABLE" {
+			if err := m.discard(e.defn); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The data offsets are not known before the blocks are written: the TOC
+	// goes out without them and is patched at the end when possible.
+	w := &countingWriter{w: out}
+	if _, err := w.Write(arch.headWithOffsets(nil)); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	a := &pgArchiveReader{r: r, intSize: arch.intSize, offSize: arch.offSize}
+	positions := make(map[int]int64)
+	for {
+		blockType, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %v", err)
+		}
+		id := a.readInt()
+		entry := arch.byID[id]
+		if a.err == nil && entry == nil {
+			return fmt.Errorf("invalid pg_dump archive: data block of unknown TOC entry %d", id)
+		}
+		if a.err != nil {
+			return fmt.Errorf("invalid pg_dump archive: %v", a.err)
+		}
+
+		positions[id] = w.n
+		if _, err := w.Write(append([]byte{blockType}, arch.pgInt(id)...)); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+		switch {
+		case blockType == pgBlockData && entry.desc == "TABLE DATA":
+			err = m.maskPgTableData(arch, entry, a, w)
+		case blockType == pgBlockData:
+			err = copyPgChunks(a, w, arch)
+		case blockType == pgBlockBlobs:
+			err = copyPgBlobs(a, w, arch)
+		default:
+			return fmt.Errorf("invalid pg_dump archive: unknown block type %d", blockType)
+		}
+		if err != nil {
+			return fmt.Errorf("data of %s: %v", entry.name(), err)
+		}
+	}
+
+	// Offsets let pg_restore seek to the data, which parallel restores
+	// need; without them it reads the archive sequentially.
+	if err := out.writeAt(arch.headWithOffsets(positions), 0); err != nil && logger != nil {
+		logger.Info("Archive written without data offsets: %v", err)
+	}
+	return nil
+}
+
+// maskPgTableData masks the payload of one table data block.
+func (m *streamMasker) maskPgTableData(arch *pgArchive, entry *pgTocEntry, a *pgArchiveReader, w io.Writer) error {
+	chunks := &pgChunkReader{a: a}
+	data, err := arch.decompressor(chunks)
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %v", err)
+	}
+
+	chunked := bufio.NewWriterSize(&pgChunkWriter{w: w, arch: arch}, pgChunkSize)
+	var payload io.Writer = chunked
+	compressor, err := arch.compressor(chunked)
+	if err != nil {
+		return err
+	}
+	if compressor != nil {
+		payload = compressor
+	}
+	sink := bufio.NewWriterSize(payload, pgChunkSize)
+
+	if err := m.maskTableData(entry, data, sink); err != nil {
+		return err
+	}
+	// The compressed stream may end before its last chunk does.
+	if _, err := io.Copy(io.Discard, chunks); err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+
+	if err := sink.Flush(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if err := chunked.Flush(); err != nil {
+		return err
+	}
+	_, err = w.Write(arch.pgInt(0))
+	return err
+}
+
+// maskTableData masks the rows of a table data entry from r to w. The parser
+// sees them between the entry's COPY statement and the end-of-data marker, as
+// in a plain dump, but only the rows are written.
+func (m *streamMasker) maskTableData(entry *pgTocEntry, r io.Reader, w io.StringWriter) error {
+	jobs := newJobWriter(w, m.workers)
+	defer func() { _ = jobs.close() }()
+	if err := m.discard(entry.copyStmt); err != nil {
+		return err
+	}
+	if err := m.mask(r, jobs); err != nil {
+		return err
+	}
+	if entry.copyStmt != "" {
+		if err := m.discard(pgCopyTerminator + "\n"); err != nil {
+			return err
+		}
+	}
+	if err := m.flush(jobs); err != nil {
+		return err
+	}
+	if err := jobs.close(); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	// Violations reported by jobs on workers surface once they are done.
+	return m.failure()
+}
+
+// copyPgBlobs copies a large object block unchanged: per object its OID
+// and chunked data, up to a zero OID.
+func copyPgBlobs(a *pgArchiveReader, w io.Writer, arch *pgArchive) error {
+	for {
+		oid := a.readInt()
+		if a.err != nil {
+			return a.err
+		}
+		if _, err := w.Write(arch.pgInt(oid)); err != nil {
+			return err
+		}
+		if oid == 0 {
+			return nil
+		}
+		if err := copyPgChunks(a, w, arch); err != nil {
+			return err
+		}
+	}
+}
+
+// discard runs statement text through the parser for its state only, as the
+// COPY statement of a table data entry or a table definition.
+func (m *streamMasker) discard(text string) error {
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		lineJob(m.parser, line, m.config, m.cache)
+		if err := m.failure(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPgEntry is a TOC entry of a test archive. blobs, when set, makes the
+// entry's data a large object block.
+type testPgEntry struct {
+	id       int
+	tag      string
+	desc     string
+	defn     string
+	copyStmt string
+	data     *string
+	blobs    map[int]string
+}
+
+// newTestPgArchive returns the header fields pg_dump writes for the given
+// archive format, version and compression.
+func newTestPgArchive(format, vmin, compression byte) *pgArchive {
+	arch := &pgArchive{version: pgArchiveVersion(1, vmin, 0), format: format, intSize: 4, offSize: 8, compression: compression}
+	if vmin < 15 && compression == pgCompressionGzip {
+		arch.level = 6
+	}
+	return arch
+}
+
+// writeTestPgHead writes the header and TOC of arch; extra writes the
+// format-specific end of each TOC entry.
+func writeTestPgHead(arch *pgArchive, entries []testPgEntry, extra func(head *bytes.Buffer, e testPgEntry)) *bytes.Buffer {
+	str := func(b *bytes.Buffer, s string, null bool) {
+		if null {
+			b.Write(arch.pgInt(-1))
+			return
+		}
+		b.Write(arch.pgInt(len(s)))
+		b.WriteString(s)
+	}
+
+	var head bytes.Buffer
+	head.WriteString(pgArchiveMagic)
+	head.Write([]byte{byte(arch.version >> 16), byte(arch.version >> 8), 0, byte(arch.intSize), byte(arch.offSize), arch.format})
+	if arch.version >= pgArchiveCompressionVersion {
+		head.WriteByte(arch.compression)
+	} else {
+		head.Write(arch.pgInt(arch.level))
+	}
+	for _, v := range []int{12, 30, 8, 17, 9, 126, 0} {
+		head.Write(arch.pgInt(v))
+	}
+	str(&head, "app", false)
+	str(&head, "16.4", false)
+	str(&head, "16.4", false)
+
+	head.Write(arch.pgInt(len(entries)))
+	for _, e := range entries {
+		head.Write(arch.pgInt(e.id))
+		head.Write(arch.pgInt(1))
+		str(&head, "1259", false)
+		str(&head, "16384", false)
+		str(&head, e.tag, false)
+		str(&head, e.desc, false)
+		head.Write(arch.pgInt(2))
+		str(&head, e.defn, false)
+		str(&head, "", false)
+		str(&head, e.copyStmt, false)
+		str(&head, "public", false)
+		str(&head, "", false)
+		if arch.version >= pgArchiveTableAMVersion {
+			str(&head, "heap", false)
+		}
+		if arch.version >= pgArchiveRelkindVersion {
+			head.Write(arch.pgInt('r'))
+		}
+		str(&head, "app", false)
+		str(&head, "false", false)
+		str(&head, "1", false)
+		str(&head, "", true)
+		extra(&head, e)
+	}
+	return &head
+}
+
+// buildPgArchive writes a custom-format archive the way pg_dump does for the
+// given archive version and compression, with data offsets set.
+func buildPgArchive(t *testing.T, vmin byte, compression byte, entries []testPgEntry) []byte {
+	t.Helper()
+
+	arch := newTestPgArchive(pgArchiveFormatCustom, vmin, compression)
+	offsetAt := make(map[int]int)
+	head := writeTestPgHead(arch, entries, func(head *bytes.Buffer, e testPgEntry) {
+		offsetAt[e.id] = head.Len()
+		head.WriteByte(pgOffsetNoData)
+		head.Write(make([]byte, arch.offSize))
+	})
+
+	// Payloads go out in small chunks to cross chunk boundaries.
+	payload := func(b *bytes.Buffer, data string) {
+		var compressed bytes.Buffer
+		w, err := arch.compressor(&compressed)
+		if err != nil {
+			t.Fatalf("failed to create compressor: %v", err)
+		}
+		if w == nil {
+			compressed.WriteString(data)
+		} else {
+			_, _ = io.WriteString(w, data)
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+		}
+		for raw := compressed.Bytes(); len(raw) > 0; {
+			n := min(len(raw), 16)
+			b.Write(arch.pgInt(n))
+			b.Write(raw[:n])
+			raw = raw[n:]
+		}
+		b.Write(arch.pgInt(0))
+	}
+
+	out := bytes.NewBuffer(head.Bytes())
+	for _, e := range entries {
+		if e.data == nil && e.blobs == nil {
+			continue
+		}
+		field := out.Bytes()[offsetAt[e.id]:]
+		field[0] = pgOffsetSet
+		for i, pos := 1, out.Len(); i <= arch.offSize; i, pos = i+1, pos>>8 {
+			field[i] = byte(pos)
+		}
+		if e.blobs != nil {
+			out.WriteByte(pgBlockBlobs)
+			out.Write(arch.pgInt(e.id))
+			for oid, data := range e.blobs {
+				out.Write(arch.pgInt(oid))
+				payload(out, data)
+			}
+			out.Write(arch.pgInt(0))
+			continue
+		}
+		out.WriteByte(pgBlockData)
+		out.Write(arch.pgInt(e.id))
+		if *e.data == "" {
+			out.Write(arch.pgInt(0)) // pg_dump writes no chunk for an empty table
+			continue
+		}
+		payload(out, *e.data)
+	}
+	return out.Bytes()
+}
+
+// readPgArchiveData returns the header of an archive and the decompressed
+// data of its entries, large objects concatenated.
+func readPgArchiveData(t *testing.T, archive []byte) (*pgArchive, map[int]string, map[int]int64) {
+	t.Helper()
+
+	src := bytes.NewReader(archive)
+	r := bufio.NewReader(src)
+	arch, err := readPgArchiveHead(r)
+	if err != nil {
+		t.Fatalf("failed to read archive head: %v", err)
+	}
+	a := &pgArchiveReader{r: r, intSize: arch.intSize, offSize: arch.offSize}
+	payload := func() string {
+		chunks := &pgChunkReader{a: a}
+		data, err := arch.decompressor(chunks)
+		if err != nil {
+			t.Fatalf("failed to decompress: %v", err)
+		}
+		text, err := io.ReadAll(data)
+		if err != nil {
+			t.Fatalf("failed to decompress: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, chunks)
+		return string(text)
+	}
+
+	data := make(map[int]string)
+	positions := make(map[int]int64)
+	for {
+		pos := int64(len(archive) - src.Len() - r.Buffered())
+		blockType, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		id := a.readInt()
+		positions[id] = pos
+		if blockType == pgBlockBlobs {
+			for oid := a.readInt(); oid != 0 && a.err == nil; oid = a.readInt() {
+				data[id] += payload()
+			}
+		} else {
+			data[id] = payload()
+		}
+		if a.err != nil {
+			t.Fatalf("failed to read data block %d: %v", id, a.err)
+		}
+	}
+	return arch, data, positions
+}
+
+// memArchive is an in-memory archiveOutput.
+type memArchive struct {
+	bytes.Buffer
+	seekable bool
+}
+
+func (m *memArchive) writeAt(p []byte, off int64) error {
+	if !m.seekable {
+		return errors.New("output is not seekable")
+	}
+	copy(m.Bytes()[off:], p)
+	return nil
+}
+
+func testPgArchiveEntries() []testPgEntry {
+	rows := "1\talice@example.com\t+7 912 345-67-89\n" +
+		"2\t\\N\t\\N\n" +
+		"3\tbob@example.com\tcall me\\tlater\n"
+	inserts := "INSERT INTO public.logs VALUES (1, 'carol@example.com');\n"
+	empty := ""
+	sequence := ""
+	return []testPgEntry{
+		{id: 1, tag: "users", desc: "TABLE", defn: "CREATE TABLE public.users (\n    id integer,\n    email text,\n    phone text\n);\n"},
+		{id: 2, tag: "logs", desc: "TABLE", defn: "CREATE TABLE public.logs (\n    id integer,\n    email text\n);\n"},
+		{id: 3, tag: "users", desc: "TABLE DATA", copyStmt: "COPY public.users (id, email, phone) FROM stdin;\n", data: &rows},
+		{id: 4, tag: "logs", desc: "TABLE DATA", data: &inserts},
+		{id: 5, tag: "empty", desc: "TABLE DATA", copyStmt: "COPY public.empty (id) FROM stdin;\n", data: &empty},
+		{id: 6, tag: "BLOBS", desc: "BLOBS", blobs: map[int]string{16401: "alice@example.com stays in large objects"}},
+		{id: 7, tag: "users_id_seq", desc: "SEQUENCE SET", defn: "SELECT pg_catalog.setval('public.users_id_seq', 3, true);\n"},
+		{id: 8, tag: "notes", desc: "COMMENT", data: &sequence},
+	}
+}
+
+// maskedPgTableData returns the data of a table data entry as masking the
+// equivalent plain dump produces it.
+func maskedPgTableData(t *testing.T, entries []testPgEntry, e testPgEntry) string {
+	t.Helper()
+
+	var schema strings.Builder
+	for _, table := range entries {
+		if table.desc == "TABLE" {
+			schema.WriteString(table.defn)
+		}
+	}
+	plain := schema.String() + e.copyStmt + *e.data
+	if e.copyStmt != "" {
+		plain += "\\.\n"
+	}
+	masked := processDump(t, NewDialectParser(DialectPostgreSQL, newTestRuntime()), bothAlgorithms(), plain)
+	masked = strings.TrimPrefix(masked, schema.String()+e.copyStmt)
+	return strings.TrimSuffix(masked, "\\.\n")
+}
+
+func TestMaskPgArchive(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		vmin        byte
+		compression byte
+	}{
+		{"1.14-gzip", 14, pgCompressionGzip},
+		{"1.15-zstd", 15, pgCompressionZstd},
+		{"1.16-none", 16, pgCompressionNone},
+		{"1.12-none", 12, pgCompressionNone},
+	} {
+		withTestGlobals(t, func() {
+			setupMaskingDefaults(t)
+			ProcessingTables = map[string]TableConfig{
+				"public.users": {Email: []string{"email"}, Phone: []string{"phone"}},
+				"public.logs":  {Email: []string{"email"}},
+			}
+			entries := testPgArchiveEntries()
+			input := buildPgArchive(t, tt.vmin, tt.compression, entries)
+
+			rt := newTestRuntime()
+			masker := &streamMasker{parser: NewDialectParser(DialectPostgreSQL, rt), rt: rt, config: bothAlgorithms(), workers: 2}
+			out := &memArchive{seekable: true}
+			if err := masker.maskPgArchive(bufio.NewReader(bytes.NewReader(input)), out); err != nil {
+				t.Fatalf("%s: masking failed: %v", tt.name, err)
+			}
+
+			inArch, inData, _ := readPgArchiveData(t, input)
+			outArch, outData, positions := readPgArchiveData(t, out.Bytes())
+			if !bytes.Equal(inArch.headWithOffsets(nil), outArch.headWithOffsets(nil)) {
+				t.Fatalf("%s: expected header and TOC unchanged apart from data offsets", tt.name)
+			}
+			if !bytes.Equal(outArch.headWithOffsets(positions), outArch.head) {
+				t.Fatalf("%s: expected the data offsets to point at the data blocks", tt.name)
+			}
+
+			// Table data is masked exactly like the COPY blocks and INSERT
+			// statements of a plain dump.
+			for _, e := range entries {
+				if e.desc != "TABLE DATA" {
+					if outData[e.id] != inData[e.id] {
+						t.Fatalf("%s: expected %s data copied unchanged, got %q", tt.name, e.desc, outData[e.id])
+					}
+					continue
+				}
+				if want := maskedPgTableData(t, entries, e); outData[e.id] != want {
+					t.Fatalf("%s: table data %s: expected %q, got %q", tt.name, e.tag, want, outData[e.id])
+				}
+			}
+			if strings.Contains(outData[3], "alice@example.com") || strings.Contains(outData[4], "carol@example.com") {
+				t.Fatalf("%s: expected emails masked, got %q and %q", tt.name, outData[3], outData[4])
+			}
+			if !strings.Contains(outData[3], "call me\\tlater") {
+				t.Fatalf("%s: expected COPY escapes preserved, got %q", tt.name, outData[3])
+			}
+		})
+	}
+}
+
+// pgDumpFixtures are the custom-format archives of testdata/pgdump/app.sql
+// under testdata/pgdump. The committed ones were encoded field by field as
+// pg_dump 16 writes them (archive version 1.15), independently of the writer
+// above, because no pg_dump was at hand: ENCODING, STDSTRINGS and SEARCHPATH
+// entries, NULL and empty TOC strings, dependencies, an empty table, a zlib
+// stream split into 4096-byte chunks and, uncompressed, one chunk per COPY
+// row. `make pgdump-fixtures` replaces them with real pg_dump output.
+var pgDumpFixtures = []struct {
+	file        string
+	compression byte
+}{
+	{"app.dump", pgCompressionGzip},
+	{"app_z0.dump", pgCompressionNone},
+}
+
+// maskPgFixture masks an archive of app.sql's users table.
+func maskPgFixture(t *testing.T, input []byte) []byte {
+	t.Helper()
+
+	rt := newTestRuntime()
+	masker := &streamMasker{parser: NewDialectParser(DialectPostgreSQL, rt), rt: rt, config: bothAlgorithms(), workers: 2}
+	out := &memArchive{seekable: true}
+	if err := masker.maskPgArchive(bufio.NewReader(bytes.NewReader(input)), out); err != nil {
+		t.Fatalf("masking failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+// pgTableDataEntry returns the TABLE DATA entry of a table.
+func pgTableDataEntry(t *testing.T, arch *pgArchive, tag string) *pgTocEntry {
+	t.Helper()
+
+	for _, e := range arch.entries {
+		if e.desc == "TABLE DATA" && e.tag == tag {
+			return e
+		}
+	}
+	t.Fatalf("no table data of %s in the archive", tag)
+	return nil
+}
+
+// countPgChunks counts the chunks of the data block at pos.
+func countPgChunks(t *testing.T, arch *pgArchive, archive []byte, pos int64) int {
+	t.Helper()
+
+	a := &pgArchiveReader{r: bufio.NewReader(bytes.NewReader(archive[pos:])), intSize: arch.intSize, offSize: arch.offSize}
+	a.readByte()
+	a.readInt()
+	chunks := 0
+	for n := a.readInt(); n != 0 && a.err == nil; n = a.readInt() {
+		a.read(n)
+		chunks++
+	}
+	if a.err != nil {
+		t.Fatalf("failed to read data block at %d: %v", pos, a.err)
+	}
+	return chunks
+}
+
+func TestMaskPgDumpFixtures(t *testing.T) {
+	for _, fixture := range pgDumpFixtures {
+		t.Run(fixture.file, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join(repoRoot(t), "testdata", "pgdump", fixture.file))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+
+			withTestGlobals(t, func() {
+				setupMaskingDefaults(t)
+				ProcessingTables = map[string]TableConfig{
+					"public.users": {Email: []string{"email"}, Phone: []string{"phone"}},
+				}
+				inArch, inData, inPositions := readPgArchiveData(t, input)
+				if inArch.version < pgArchiveCompressionVersion || inArch.compression != fixture.compression {
+					t.Fatalf("expected a pg_dump 16+ archive with compression %d, got version %x, compression %d", fixture.compression, inArch.version, inArch.compression)
+				}
+				if !bytes.Equal(inArch.headWithOffsets(inPositions), inArch.head) {
+					t.Fatal("expected the fixture's data offsets set")
+				}
+				users, audit := pgTableDataEntry(t, inArch, "users"), pgTableDataEntry(t, inArch, "audit")
+				if chunks := countPgChunks(t, inArch, input, inPositions[users.dumpID]); chunks < 2 {
+					t.Fatalf("expected the users data to span several chunks, got %d", chunks)
+				}
+
+				masked := maskPgFixture(t, input)
+				outArch, outData, positions := readPgArchiveData(t, masked)
+				if !bytes.Equal(inArch.headWithOffsets(nil), outArch.headWithOffsets(nil)) {
+					t.Fatal("expected header and TOC unchanged apart from data offsets")
+				}
+				if !bytes.Equal(outArch.headWithOffsets(positions), outArch.head) {
+					t.Fatal("expected the data offsets to point at the data blocks")
+				}
+
+				// The rows are masked as in the plain dump pg_restore prints.
+				var schema strings.Builder
+				for _, e := range inArch.entries {
+					if e.desc == "TABLE" {
+						schema.WriteString(e.defn)
+					}
+				}
+				for _, e := range []*pgTocEntry{users, audit} {
+					plain := processDump(t, NewDialectParser(DialectPostgreSQL, newTestRuntime()), bothAlgorithms(),
+						schema.String()+e.copyStmt+inData[e.dumpID]+"\\.\n")
+					want := strings.TrimSuffix(strings.TrimPrefix(plain, schema.String()+e.copyStmt), "\\.\n")
+					if outData[e.dumpID] != want {
+						t.Fatalf("table data %s: expected %q, got %q", e.tag, want, outData[e.dumpID])
+					}
+				}
+				if outData[audit.dumpID] != "" {
+					t.Fatalf("expected the empty table to stay empty, got %q", outData[audit.dumpID])
+				}
+				inRows, outRows := strings.Split(inData[users.dumpID], "\n"), strings.Split(outData[users.dumpID], "\n")
+				if len(outRows) != len(inRows) || len(inRows) != 121 {
+					t.Fatalf("expected 120 rows, got %d and %d", len(inRows)-1, len(outRows)-1)
+				}
+				for i, row := range inRows[:len(inRows)-1] {
+					in, out := strings.Split(row, "\t"), strings.Split(outRows[i], "\t")
+					if in[1] != "\\N" && in[1] == out[1] || in[2] != "\\N" && in[2] == out[2] || in[3] != out[3] || in[4] != out[4] {
+						t.Fatalf("expected only email and phone masked, got %q for %q", outRows[i], row)
+					}
+				}
+
+				// The masked archive is a valid input again.
+				again, _, _ := readPgArchiveData(t, maskPgFixture(t, masked))
+				if !bytes.Equal(again.headWithOffsets(nil), outArch.headWithOffsets(nil)) {
+					t.Fatal("expected masking the masked archive to keep its TOC")
+				}
+			})
+		})
+	}
+}
+
+// TestPgRestoreReadsMaskedFixtures checks the masked fixtures with
+// pg_restore: it lists the same TOC as for the input and restores to a
+// script whose rows are those of the input's script masked as a plain dump.
+func TestPgRestoreReadsMaskedFixtures(t *testing.T) {
+	pgRestore, err := exec.LookPath("pg_restore")
+	if err != nil {
+		t.Skip("pg_restore not found")
+	}
+	restore := func(t *testing.T, archive []byte, args ...string) string {
+		t.Helper()
+
+		path := filepath.Join(t.TempDir(), "archive.dump")
+		if err := os.WriteFile(path, archive, 0600); err != nil {
+			t.Fatalf("failed to write archive: %v", err)
+		}
+		output, err := exec.Command(pgRestore, append(args, path)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("pg_restore %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+
+	for _, fixture := range pgDumpFixtures {
+		t.Run(fixture.file, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join(repoRoot(t), "testdata", "pgdump", fixture.file))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+
+			withTestGlobals(t, func() {
+				setupMaskingDefaults(t)
+				ProcessingTables = map[string]TableConfig{
+					"public.users": {Email: []string{"email"}, Phone: []string{"phone"}},
+				}
+				masked := maskPgFixture(t, input)
+
+				if got, want := restore(t, masked, "--list"), restore(t, input, "--list"); got != want {
+					t.Fatalf("expected the TOC listed unchanged, got\n%s\nwant\n%s", got, want)
+				}
+				script := restore(t, masked, "--file=-")
+				want := processDump(t, NewDialectParser(DialectPostgreSQL, newTestRuntime()), bothAlgorithms(), restore(t, input, "--file=-"))
+				if script != want {
+					t.Fatalf("expected the restored script masked as a plain dump, got\n%s\nwant\n%s", script, want)
+				}
+				if !strings.Contains(script, "COPY public.users") {
+					t.Fatalf("expected the users rows restored, got\n%s", script)
+				}
+			})
+		})
+	}
+}
+
+func TestMaskPgArchiveWithoutSeeking(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{"public.users": {Email: []string{"email"}}}
+		input := buildPgArchive(t, 16, pgCompressionGzip, testPgArchiveEntries())
+
+		rt := newTestRuntime()
+		masker := &streamMasker{parser: NewDialectParser(DialectPostgreSQL, rt), rt: rt, config: bothAlgorithms(), workers: 1}
+		out := &memArchive{}
+		if err := masker.maskPgArchive(bufio.NewReader(bytes.NewReader(input)), out); err != nil {
+			t.Fatalf("masking failed: %v", err)
+		}
+
+		arch, data, _ := readPgArchiveData(t, out.Bytes())
+		for _, e := range arch.entries {
+			if state := arch.head[e.offsetAt]; state == pgOffsetSet {
+				t.Fatalf("expected no data offsets on unseekable output, entry %d has one", e.dumpID)
+			}
+		}
+		if strings.Contains(data[3], "alice@example.com") {
+			t.Fatalf("expected emails masked, got %q", data[3])
+		}
+	})
+}
+
+func TestMaskPgArchiveRejectsUnsupportedInput(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		lz4 := buildPgArchive(t, 16, pgCompressionNone, testPgArchiveEntries())
+		lz4[len(pgArchiveMagic)+6] = pgCompressionLZ4
+		future := buildPgArchive(t, 16, pgCompressionNone, testPgArchiveEntries())
+		future[len(pgArchiveMagic)+1] = 17
+		truncated := buildPgArchive(t, 16, pgCompressionNone, testPgArchiveEntries())[:100]
+
+		for name, input := range map[string][]byte{"lz4": lz4, "future": future, "truncated": truncated} {
+			rt := newTestRuntime()
+			masker := &streamMasker{parser: NewDialectParser(DialectPostgreSQL, rt), rt: rt, config: bothAlgorithms(), workers: 1}
+			if err := masker.maskPgArchive(bufio.NewReader(bytes.NewReader(input)), &memArchive{}); err == nil {
+				t.Fatalf("%s: expected an error", name)
+			}
+		}
+	})
+}
+
+func TestCLIMasksPgArchive(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"public.users": {"email": ["email"], "phone": ["phone"]}}`)
+	input := buildPgArchive(t, 16, pgCompressionZstd, testPgArchiveEntries())
+
+	outputPath := filepath.Join(runtimeDir, "masked.dump")
+	if _, stderr, err := run(input, "--output", outputPath); err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	masked, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	arch, data, positions := readPgArchiveData(t, masked)
+	if !bytes.Equal(arch.headWithOffsets(positions), arch.head) {
+		t.Fatal("expected the data offsets to point at the data blocks")
+	}
+	if strings.Contains(data[3], "alice@example.com") || !strings.Contains(data[3], "@example.com") {
+		t.Fatalf("expected emails masked, got %q", data[3])
+	}
+
+	if _, stderr, err := run(input, "--db-format=mysql"); err == nil || !strings.Contains(stderr, "custom-format archive") {
+		t.Fatalf("expected a MySQL dialect rejected, got err=%v, stderr=%s", err, stderr)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// pgDirectoryTOC is the TOC file of a directory-format dump.
+const pgDirectoryTOC = "toc.dat"
+
+// pgDataFile is a table data file of a directory-format dump.
+type pgDataFile struct {
+	entry *pgTocEntry
+	// table is the entry's TABLE entry, if the TOC has one.
+	table *pgTocEntry
+	// name is the file name on disk, with the compression suffix.
+	name string
+}
+
+// maskPgDirectory masks the directory-format dump in inDir into outDir. Each
+// table data file runs through its own PostgreSQL parser like the COPY block
+// (or INSERT statements) of a plain dump and keeps its compression; files
+// are masked one after another, each on the worker pool (see
+// maskDumpFiles). toc.dat, large objects and every other file are copied
+// unchanged.
+func (m *streamMasker) maskPgDirectory(inDir, outDir string) error {
+	toc, err := os.Open(filepath.Join(inDir, pgDirectoryTOC))
+	if err != nil {
+		return err
+	}
+	arch, err := readPgArchiveHead(bufio.NewReader(toc))
+	_ = toc.Close()
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", pgDirectoryTOC, err)
+	}
+	if arch.format != pgArchiveFormatDirectory {
+		return fmt.Errorf("%s does not belong to a directory-format dump", pgDirectoryTOC)
+	}
+	if err := arch.checkCompression(); err != nil {
+		return err
+	}
+
+	tables := make(map[string]*pgTocEntry)
+	for _, e := range arch.entries {
+		if e.desc == "TABLE" {
+			tables[e.name()] = e
+		}
+	}
+	var files []pgDataFile
+	masked := make(map[string]bool)
+	for _, e := range arch.entries {
+		if e.desc != "TABLE DATA" || e.file == "" {
+			continue
+		}
+		name, err := findPgDataFile(inDir, e.file)
+		if err != nil {
+			return fmt.Errorf("data of %s: %v", e.name(), err)
+		}
+		files = append(files, pgDataFile{entry: e, table: tables[e.name()], name: name})
+		masked[name] = true
+	}
+
+	dirEntries, err := os.ReadDir(inDir)
+	if err != nil {
+		return err
+	}
+	for _, de := range dirEntries {
+		if masked[de.Name()] {
+			continue
+		}
+		if !de.Type().IsRegular() {
+			return fmt.Errorf("unexpected %s in dump directory", de.Name())
+		}
+		if err := copyDumpFile(filepath.Join(inDir, de.Name()), filepath.Join(outDir, de.Name())); err != nil {
+			return err
+		}
+	}
+
+	masks := make([]dumpFile, 0, len(files))
+	for _, file := range files {
+		masks = append(masks, dumpFile{
+			name: file.name,
+			what: "data of " + file.entry.name(),
+			mask: func() (int, error) {
+				return m.maskPgDataFile(arch, file, filepath.Join(inDir, file.name), filepath.Join(outDir, file.name))
+			},
+		})
+	}
+	return m.maskDumpFiles(masks)
+}
+
+// findPgDataFile returns the name on disk of a data file listed in the TOC:
+// pg_dump appends the suffix of the compression to it.
+func findPgDataFile(dir, name string) (string, error) {
+	for _, suffix := range []string{"", ".gz", ".zst"} {
+		if _, err := os.Stat(filepath.Join(dir, name+suffix)); err == nil {
+			return name + suffix, nil
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".lz4")); err == nil {
+		return "", errors.New("LZ4-compressed data files are not supported: dump with --compress=gzip or zstd")
+	}
+	return "", fmt.Errorf("data file %s not found", name)
+}
+
+// maskPgDataFile masks one table data file with a parser of its own and
+// returns the number of lines read.
+func (m *streamMasker) maskPgDataFile(arch *pgArchive, file pgDataFile, inPath, outPath string) (int, error) {
+	masker := m.fileMasker(NewDialectParser(DialectPostgreSQL, m.rt))
+	err := rewriteDumpFile(inPath, outPath, arch.level, func(r io.Reader, w *bufio.Writer) error {
+		// The table definition gives INSERT-style data without column
+		// lists its column positions.
+		if file.table != nil {
+			if err := masker.discard(file.table.defn); err != nil {
+				return err
+			}
+		}
+		return masker.maskTableData(file.entry, r, w)
+	})
+	return masker.lines, err
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildPgDirectory writes a directory-format dump into dir the way pg_dump
+// does for the given archive version and compression.
+func buildPgDirectory(t *testing.T, dir string, vmin byte, compression byte, entries []testPgEntry) {
+	t.Helper()
+
+	arch := newTestPgArchive(pgArchiveFormatDirectory, vmin, compression)
+	suffix := map[byte]string{pgCompressionGzip: ".gz", pgCompressionZstd: ".zst"}[compression]
+	format := map[byte]string{pgCompressionGzip: "gzip", pgCompressionZstd: "zstd"}[compression]
+	writeFile := func(name, data string) {
+		var buf bytes.Buffer
+		w, err := outputCompression{format: format}.writer(&buf)
+		if err != nil {
+			t.Fatalf("failed to create compressor: %v", err)
+		}
+		if w == nil {
+			buf.WriteString(data)
+		} else {
+			_, _ = io.WriteString(w, data)
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+suffix), buf.Bytes(), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	head := writeTestPgHead(arch, entries, func(head *bytes.Buffer, e testPgEntry) {
+		file := ""
+		switch {
+		case e.blobs != nil:
+			file = "blobs.toc"
+		case e.data != nil:
+			file = fmt.Sprintf("%d.dat", e.id)
+		}
+		head.Write(arch.pgInt(len(file)))
+		head.WriteString(file)
+	})
+	if err := os.WriteFile(filepath.Join(dir, pgDirectoryTOC), head.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write toc.dat: %v", err)
+	}
+	for _, e := range entries {
+		switch {
+		case e.blobs != nil:
+			var toc strings.Builder
+			for oid, data := range e.blobs {
+				fmt.Fprintf(&toc, "%d blob_%d.dat\n", oid, oid)
+				writeFile(fmt.Sprintf("blob_%d.dat", oid), data)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "blobs.toc"), []byte(toc.String()), 0600); err != nil {
+				t.Fatalf("failed to write blobs.toc: %v", err)
+			}
+		case e.data != nil:
+			writeFile(fmt.Sprintf("%d.dat", e.id), *e.data)
+		}
+	}
+}
+
+// readDumpFile returns the decompressed content of a file and its
+// compression.
+func readDumpFile(t *testing.T, path string) (string, string) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer func() { _ = file.Close() }()
+	r, format, err := openDumpInput(file)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data), format
+}
+
+func TestMaskPgDirectory(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		vmin        byte
+		compression byte
+	}{
+		{"1.14-gzip", 14, pgCompressionGzip},
+		{"1.15-zstd", 15, pgCompressionZstd},
+		{"1.16-none", 16, pgCompressionNone},
+	} {
+		withTestGlobals(t, func() {
+			setupMaskingDefaults(t)
+			ProcessingTables = map[string]TableConfig{
+				"public.users": {Email: []string{"email"}, Phone: []string{"phone"}},
+				"public.logs":  {Email: []string{"email"}},
+			}
+			entries := testPgArchiveEntries()
+			inDir := t.TempDir()
+			buildPgDirectory(t, inDir, tt.vmin, tt.compression, entries)
+
+			outPath := filepath.Join(t.TempDir(), "masked")
+			out, err := openDumpDirectory(outPath)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			rt := newTestRuntime()
+			masker := &streamMasker{parser: NewDialectParser(DialectPostgreSQL, rt), rt: rt, config: bothAlgorithms(), workers: 2}
+			if err := masker.maskPgDirectory(inDir, out.tmp); err != nil {
+				t.Fatalf("%s: masking failed: %v", tt.name, err)
+			}
+			if err := out.Commit(); err != nil {
+				t.Fatalf("%s: commit failed: %v", tt.name, err)
+			}
+
+			inFiles, _ := os.ReadDir(inDir)
+			outFiles, _ := os.ReadDir(outPath)
+			if len(outFiles) != len(inFiles) {
+				t.Fatalf("%s: expected %d files, got %d", tt.name, len(inFiles), len(outFiles))
+			}
+			masked := make(map[string]testPgEntry)
+			for _, e := range entries {
+				if e.desc == "TABLE DATA" {
+					masked[fmt.Sprintf("%d.dat", e.id)] = e
+				}
+			}
+			for _, file := range inFiles {
+				want, wantFormat := readDumpFile(t, filepath.Join(inDir, file.Name()))
+				got, format := readDumpFile(t, filepath.Join(outPath, file.Name()))
+				if format != wantFormat {
+					t.Fatalf("%s: %s: expected %q compression kept, got %q", tt.name, file.Name(), wantFormat, format)
+				}
+				if e, ok := masked[strings.TrimSuffix(strings.TrimSuffix(file.Name(), ".gz"), ".zst")]; ok {
+					want = maskedPgTableData(t, entries, e)
+				}
+				if got != want {
+					t.Fatalf("%s: %s: expected %q, got %q", tt.name, file.Name(), want, got)
+				}
+			}
+			if users, _ := readDumpFile(t, filepath.Join(outPath, "3.dat"+map[byte]string{pgCompressionGzip: ".gz", pgCompressionZstd: ".zst"}[tt.compression])); strings.Contains(users, "alice@example.com") {
+				t.Fatalf("%s: expected emails masked, got %q", tt.name, users)
+			}
+			if masker.lines != 4 {
+				t.Fatalf("%s: expected 4 data lines counted, got %d", tt.name, masker.lines)
+			}
+		})
+	}
+}
+
+func TestMaskPgDirectoryReportsMissingDataFiles(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		inDir := t.TempDir()
+		buildPgDirectory(t, inDir, 16, pgCompressionGzip, testPgArchiveEntries())
+		if err := os.Remove(filepath.Join(inDir, "3.dat.gz")); err != nil {
+			t.Fatal(err)
+		}
+
+		rt := newTestRuntime()
+		masker := &streamMasker{parser: NewDialectParser(DialectPostgreSQL, rt), rt: rt, config: bothAlgorithms(), workers: 1}
+		err := masker.maskPgDirectory(inDir, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "3.dat not found") {
+			t.Fatalf("expected the missing data file reported, got %v", err)
+		}
+	})
+}
+
+func TestOpenDumpDirectoryRefusesContent(t *testing.T) {
+	path := t.TempDir()
+	if err := os.WriteFile(filepath.Join(path, "toc.dat"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openDumpDirectory(path); err == nil {
+		t.Fatal("expected a non-empty output directory rejected")
+	}
+}
+
+func TestCLIMasksPgDirectory(t *testing.T) {
+	run, runtimeDir := newCLIRunner(t, `{"public.users": {"email": ["email"], "phone": ["phone"]}}`)
+	inDir := filepath.Join(runtimeDir, "app.dir")
+	if err := os.Mkdir(inDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	buildPgDirectory(t, inDir, 16, pgCompressionGzip, testPgArchiveEntries())
+
+	outDir := filepath.Join(runtimeDir, "masked.dir")
+	if _, stderr, err := run(nil, "--input-dir", inDir, "--output", outDir); err != nil {
+		t.Fatalf("maskdump failed: %v\nstderr:\n%s", err, stderr)
+	}
+	users, format := readDumpFile(t, filepath.Join(outDir, "3.dat.gz"))
+	if format != "gzip" || strings.Contains(users, "alice@example.com") || !strings.Contains(users, "@example.com") {
+		t.Fatalf("expected gzip data with masked emails, got %s %q", format, users)
+	}
+
+	if _, stderr, err := run(nil, "--input-dir", inDir); err == nil || !strings.Contains(stderr, "requires --output") {
+		t.Fatalf("expected --output required, got err=%v, stderr=%s", err, stderr)
+	}
+}
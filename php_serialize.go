@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// newPHPColumn returns the masker of a column of PHP serialize() data, nil
+// when none of its data types is active. Strings are masked by content and
+// their s:N: byte lengths rewritten, so PHP can still unserialize them.
+func newPHPColumn(name string, typeNames []string, active []*DataType) *documentColumn {
+	var types []*DataType
+	for _, dt := range active {
+		for _, typeName := range typeNames {
+			if dt.Name == typeName {
+				types = append(types, dt)
+				break
+			}
+		}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	return &documentColumn{name: name, format: "PHP serialize()", rewrite: func(rt *Runtime, doc string, cache *Cache, stats *tableStats) (string, error) {
+		return rewritePHPStrings(doc, func(value string) string {
+			for _, dt := range types {
+				value = rt.maskMatches(dt, value, cache, stats)
+			}
+			return value
+		})
+	}}
+}
+
+// phpRewriter copies PHP serialize() output, passing the content of every
+// string value (not array keys or property names) through visit.
+type phpRewriter struct {
+	s     string
+	pos   int
+	out   strings.Builder
+	visit func(value string) string
+}
+
+// rewritePHPStrings returns doc with the content of every string value
+// replaced by what visit returns for it and its s:N: length fixed up.
+// Everything else, objects with custom serialization (C:) included, keeps
+// its exact text.
+func rewritePHPStrings(doc string, visit func(value string) string) (string, error) {
+	w := &phpRewriter{s: doc, visit: visit}
+	w.out.Grow(len(doc))
+	if err := w.value(); err != nil {
+		return "", err
+	}
+	if w.pos < len(w.s) {
+		return "", fmt.Errorf("unexpected %q after the value at offset %d", w.s[w.pos], w.pos)
+	}
+	return w.out.String(), nil
+}
+
+func (w *phpRewriter) value() error {
+	if w.pos == len(w.s) {
+		return errors.New("unexpected end of input")
+	}
+	start := w.pos
+	switch w.s[w.pos] {
+	case 'N':
+		if !strings.HasPrefix(w.s[w.pos:], "N;") {
+			return fmt.Errorf("invalid null at offset %d", start)
+		}
+		w.pos += 2
+	case 'b', 'i', 'd', 'r', 'R':
+		if err := w.scalar(); err != nil {
+			return err
+		}
+	case 's':
+		return w.str(true)
+	case 'a':
+		n, err := w.length()
+		if err != nil {
+			return err
+		}
+		if err := w.expect('{'); err != nil {
+			return err
+		}
+		w.out.WriteString(w.s[start:w.pos])
+		return w.members(n)
+	case 'O':
+		if _, err := w.name(); err != nil {
+			return err
+		}
+		if err := w.expect(':'); err != nil {
+			return err
+		}
+		n, err := w.count(':')
+		if err != nil {
+			return err
+		}
+		if err := w.expect('{'); err != nil {
+			return err
+		}
+		w.out.WriteString(w.s[start:w.pos])
+		return w.members(n)
+	case 'C':
+		// Custom serialization: the payload is opaque to maskdump.
+		if _, err := w.name(); err != nil {
+			return err
+		}
+		if err := w.expect(':'); err != nil {
+			return err
+		}
+		n, err := w.count(':')
+		if err != nil {
+			return err
+		}
+		if err := w.expect('{'); err != nil {
+			return err
+		}
+		if n > len(w.s)-w.pos {
+			return fmt.Errorf("payload at offset %d is shorter than %d bytes", w.pos, n)
+		}
+		w.pos += n
+		if err := w.expect('}'); err != nil {
+			return err
+		}
+	case 'E':
+		if _, err := w.name(); err != nil {
+			return err
+		}
+		if err := w.expect(';'); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown value type %q at offset %d", w.s[w.pos], start)
+	}
+	w.out.WriteString(w.s[start:w.pos])
+	return nil
+}
+
+// members copies the n key/value pairs and the closing brace of an array
+// or object whose header was written.
+func (w *phpRewriter) members(n int) error {
+	for i := 0; i < n; i++ {
+		start := w.pos
+		switch {
+		case w.pos == len(w.s):
+			return errors.New("unexpected end of input")
+		case w.s[w.pos] == 'i':
+			if err := w.scalar(); err != nil {
+				return err
+			}
+			w.out.WriteString(w.s[start:w.pos])
+		case w.s[w.pos] == 's':
+			if err := w.str(false); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid key at offset %d", start)
+		}
+		if err := w.value(); err != nil {
+			return err
+		}
+	}
+	if w.pos == len(w.s) || w.s[w.pos] != '}' {
+		return fmt.Errorf("expected '}' at offset %d", w.pos)
+	}
+	w.out.WriteByte('}')
+	w.pos++
+	return nil
+}
+
+// scalar skips a b:, i:, d:, r: or R: value up to its semicolon.
+func (w *phpRewriter) scalar() error {
+	start := w.pos
+	end := strings.IndexByte(w.s[w.pos:], ';')
+	if w.pos+1 >= len(w.s) || w.s[w.pos+1] != ':' || end < 3 {
+		return fmt.Errorf("invalid %q value at offset %d", w.s[start], start)
+	}
+	w.pos += end + 1
+	return nil
+}
+
+// str copies the string at pos; a visited string value is written with its
+// new content and length. A value that is serialize() output of its own is
+// rewritten string by string.
+func (w *phpRewriter) str(visit bool) error {
+	start := w.pos
+	content, err := w.name()
+	if err != nil {
+		return err
+	}
+	if err := w.expect(';'); err != nil {
+		return err
+	}
+	if !visit {
+		w.out.WriteString(w.s[start:w.pos])
+		return nil
+	}
+	masked, err := w.nested(content)
+	if err != nil {
+		masked = w.visit(content)
+	}
+	if masked == content {
+		w.out.WriteString(w.s[start:w.pos])
+		return nil
+	}
+	w.out.WriteString("s:" + strconv.Itoa(len(masked)) + ":\"" + masked + "\";")
+	return nil
+}
+
+// nested rewrites a string value that is itself serialize() output holding
+// strings, such as a session field saved with serialize($data). Masking its
+// text as a whole would leave the inner s:N: lengths wrong.
+func (w *phpRewriter) nested(content string) (string, error) {
+	if len(content) < 2 || content[1] != ':' || !strings.ContainsRune("aOs", rune(content[0])) {
+		return "", errors.New("not a serialized value")
+	}
+	return rewritePHPStrings(content, w.visit)
+}
+
+// name reads a length-prefixed quoted string such as s:5:"hello" or the
+// class name of O:8:"stdClass" and returns its content.
+func (w *phpRewriter) name() (string, error) {
+	n, err := w.length()
+	if err != nil {
+		return "", err
+	}
+	if err := w.expect('"'); err != nil {
+		return "", err
+	}
+	if n > len(w.s)-w.pos {
+		return "", fmt.Errorf("string at offset %d is shorter than %d bytes", w.pos, n)
+	}
+	content := w.s[w.pos : w.pos+n]
+	w.pos += n
+	if err := w.expect('"'); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+// length reads the type letter and the ":N:" that follows it.
+func (w *phpRewriter) length() (int, error) {
+	w.pos++
+	if err := w.expect(':'); err != nil {
+		return 0, err
+	}
+	return w.count(':')
+}
+
+// count reads a decimal number terminated by end.
+func (w *phpRewriter) count(end byte) (int, error) {
+	start := w.pos
+	for w.pos < len(w.s) && w.s[w.pos] >= '0' && w.s[w.pos] <= '9' {
+		w.pos++
+	}
+	n, err := strconv.Atoi(w.s[start:w.pos])
+	if err != nil {
+		return 0, fmt.Errorf("invalid length at offset %d", start)
+	}
+	if err := w.expect(end); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (w *phpRewriter) expect(c byte) error {
+	if w.pos == len(w.s) || w.s[w.pos] != c {
+		return fmt.Errorf("expected %q at offset %d", c, w.pos)
+	}
+	w.pos++
+	return nil
+}
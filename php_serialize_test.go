@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewritePHPStrings(t *testing.T) {
+	doc := `a:4:{s:5:"email";s:16:"test@example.com";i:7;a:1:{i:0;s:5:"Zoë!";}s:3:"obj";O:8:"stdClass":2:{s:4:"name";s:2:"ab";s:4:"n\0x";N;}s:5:"other";C:11:"ArrayObject":12:{x:i:0;a:0:{}}}`
+	var values []string
+	out, err := rewritePHPStrings(doc, func(value string) string {
+		values = append(values, value)
+		return strings.ToUpper(value) + "+"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `a:4:{s:5:"email";s:17:"TEST@EXAMPLE.COM+";i:7;a:1:{i:0;s:6:"ZOË!+";}s:3:"obj";O:8:"stdClass":2:{s:4:"name";s:3:"AB+";s:4:"n\0x";N;}s:5:"other";C:11:"ArrayObject":12:{x:i:0;a:0:{}}}`
+	if out != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, out)
+	}
+	if strings.Join(values, "|") != "test@example.com|Zoë!|ab" {
+		t.Fatalf("expected only string values visited, got %q", values)
+	}
+
+	// A string holding serialize() output of its own is rewritten string by
+	// string, with the inner and the outer lengths fixed up.
+	nested := `a:2:{s:4:"data";s:42:"a:1:{s:5:"email";s:16:"test@example.com";}";s:4:"note";s:3:"a:b";}`
+	out, err = rewritePHPStrings(nested, func(value string) string { return strings.ToUpper(value) + "+" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `a:2:{s:4:"data";s:43:"a:1:{s:5:"email";s:17:"TEST@EXAMPLE.COM+";}";s:4:"note";s:4:"A:B+";}`
+	if out != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, out)
+	}
+
+	for _, scalar := range []string{"N;", "b:1;", "i:-3;", "d:0.5;", `E:11:"Suit:Hearts";`} {
+		if out, err := rewritePHPStrings(scalar, strings.ToUpper); err != nil || out != scalar {
+			t.Fatalf("%s: got %q, %v", scalar, out, err)
+		}
+	}
+	for _, bad := range []string{"", `s:5:"abc";`, `s:3:"abc"`, `a:2:{i:0;N;}`, `a:1:{N;N;}`, "i:1;x", `{"a":1}`, `O:3:"Foo":1:{}`} {
+		if _, err := rewritePHPStrings(bad, strings.ToUpper); err == nil {
+			t.Fatalf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestMaskPHPColumns(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"b_user": {PHP: map[string][]string{"options": {EmailTypeName}}},
+		}
+
+		mysql := "INSERT INTO `b_user` (`ID`, `options`) VALUES " +
+			`(1,'a:2:{s:5:\"email\";s:16:\"test@example.com\";s:4:\"note\";s:4:\"it\'s\";}'),(2,'not serialized');` + "\n"
+		want := "INSERT INTO `b_user` (`ID`, `options`) VALUES " +
+			`(1,'a:2:{s:5:\"email\";s:19:\"t098f6b@example.com\";s:4:\"note\";s:4:\"it\'s\";}'),(2,'not serialized');` + "\n"
+		rt := newTestRuntime()
+		rt.Strict = true
+		if out := processDump(t, NewDialectParser(DialectMySQL, rt), bothAlgorithms(), mysql); out != want {
+			t.Fatalf("unexpected MySQL masking:\n%s\nwant:\n%s", out, want)
+		}
+		if err := rt.StrictError(); err == nil || !strings.Contains(err.Error(), "PHP serialize() value of column options cannot be parsed") {
+			t.Fatalf("expected a broken value to fail strict mode, got %v", err)
+		}
+
+		postgres := "COPY public.b_user (id, options) FROM stdin;\n" +
+			`1	s:16:"test@example.com";` + "\n" +
+			`2	s:24:"s:16:"test@example.com";";` + "\n" +
+			`\.` + "\n"
+		out := processDump(t, NewDialectParser(DialectPostgreSQL, newTestRuntime()), bothAlgorithms(), postgres)
+		if !strings.Contains(out, "1\ts:19:\"t098f6b@example.com\";\n") || !strings.Contains(out, "2\ts:27:\"s:19:\"t098f6b@example.com\";\";\n") {
+			t.Fatalf("unexpected COPY masking: %s", out)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// maskJob is the output of one parsed input piece. Parsing has to run in
+// input order because parsers track statement and table state, but the value
+// masking they decide on depends on nothing else: mask, when set, computes
+// the output and may run on another goroutine. Otherwise text is the output.
+type maskJob struct {
+	text string
+	mask func() string
+}
+
+// run returns the output of the job.
+func (j maskJob) run() string {
+	if j.mask == nil {
+		return j.text
+	}
+	return j.mask()
+}
+
+// then returns a job whose output is f applied to the output of j.
+func (j maskJob) then(f func(string) string) maskJob {
+	return maskJob{mask: func() string { return f(j.run()) }}
+}
+
+// withSuffix returns a job whose output is the output of j followed by s.
+func (j maskJob) withSuffix(s string) maskJob {
+	if s == "" {
+		return j
+	}
+	if j.mask == nil {
+		return maskJob{text: j.text + s}
+	}
+	return j.then(func(out string) string { return out + s })
+}
+
+// joinJobs returns a job whose output is the concatenated output of jobs.
+func joinJobs(jobs ...maskJob) maskJob {
+	switch len(jobs) {
+	case 0:
+		return maskJob{}
+	case 1:
+		return jobs[0]
+	}
+	return maskJob{mask: func() string {
+		var out strings.Builder
+		for _, job := range jobs {
+			out.WriteString(job.run())
+		}
+		return out.String()
+	}}
+}
+
+// jobParser is implemented by parsers that split line processing into the
+// in-order parse and a maskJob. Their ProcessLine and Flush run the job at
+// once.
+type jobParser interface {
+	prepareLine(line string, config MaskConfig, cache *Cache) (maskJob, bool)
+	prepareFlush(config MaskConfig, cache *Cache) maskJob
+}
+
+// lineJob parses one input piece, deferring the masking when the parser
+// supports it. The drop flag has the meaning of ProcessLine's.
+func lineJob(parser DialectParser, line string, config MaskConfig, cache *Cache) (maskJob, bool) {
+	if jp, ok := parser.(jobParser); ok {
+		return jp.prepareLine(line, config, cache)
+	}
+	out, drop := parser.ProcessLine(line, config, cache)
+	return maskJob{text: out}, drop
+}
+
+// flushJob returns the output of input the parser still holds at end of
+// stream.
+func flushJob(parser DialectParser, config MaskConfig, cache *Cache) maskJob {
+	if jp, ok := parser.(jobParser); ok {
+		return jp.prepareFlush(config, cache)
+	}
+	if fp, ok := parser.(flushableParser); ok {
+		return maskJob{text: fp.Flush(config, cache)}
+	}
+	return maskJob{}
+}
+
+// A batch of consecutive jobs is handed to a worker once it holds this many
+// jobs or input bytes.
+const (
+	pipelineBatchJobs  = 1024
+	pipelineBatchBytes = 1 << 20
+)
+
+// jobWriter writes the output of masking jobs in submission order.
+type jobWriter interface {
+	// write queues a job; size is the length of the input piece it was
+	// parsed from. It returns the first write error seen so far.
+	write(job maskJob, size int) error
+	// close writes everything still queued and returns the first write
+	// error. Later calls do nothing.
+	close() error
+	// cache returns the cache the next job must mask with, a view of
+	// shared when jobs run ahead of the ones before them. A nil shared
+	// cache stays nil.
+	cache(shared *Cache) *Cache
+}
+
+// newJobWriter returns a writer masking on the given number of workers.
+// With one worker every job runs on the calling goroutine.
+func newJobWriter(w io.StringWriter, workers int) jobWriter {
+	if workers <= 1 {
+		return &serialJobWriter{w: w}
+	}
+	return newPipelineWriter(w, workers)
+}
+
+// resolveWorkers validates --workers: 0 picks one worker per CPU.
+func resolveWorkers(workers int) (int, error) {
+	if workers < 0 {
+		return 0, fmt.Errorf("--workers must not be negative, got %d", workers)
+	}
+	if workers == 0 {
+		return runtime.GOMAXPROCS(0), nil
+	}
+	return workers, nil
+}
+
+// serialJobWriter runs every job as it is written.
+type serialJobWriter struct {
+	w io.StringWriter
+}
+
+func (s *serialJobWriter) write(job maskJob, _ int) error {
+	_, err := s.w.WriteString(job.run())
+	return err
+}
+
+func (s *serialJobWriter) close() error { return nil }
+
+func (s *serialJobWriter) cache(shared *Cache) *Cache { return shared }
+
+// jobBatch is a run of consecutive jobs masked by one worker. Its jobs mask
+// with view, so the batch can run before the batches ahead of it are done.
+type jobBatch struct {
+	jobs []maskJob
+	size int
+	view *Cache
+	out  strings.Builder
+	done chan struct{}
+}
+
+func (b *jobBatch) run() {
+	for _, job := range b.jobs {
+		b.out.WriteString(job.run())
+	}
+	close(b.done)
+}
+
+// commit makes the cache operations of a masked batch final. When a batch
+// before it changed what its jobs read from the cache, the jobs are masked
+// again against the shared cache, so masks come out as in a serial run.
+func (b *jobBatch) commit() {
+	if b.view != nil && !b.view.batch.commit() {
+		b.out.Reset()
+		for _, job := range b.jobs {
+			b.out.WriteString(job.run())
+		}
+	}
+	b.jobs = nil
+}
+
+// pipelineWriter masks batches of jobs on a pool of workers while the caller
+// keeps parsing, and writes their output in submission order. Batches commit
+// their cache operations in the same order, so the output is the same as
+// with serialJobWriter. At most twice as many batches as
+// workers are in flight, which bounds memory: write blocks until the oldest
+// batch was written.
+type pipelineWriter struct {
+	w       io.StringWriter
+	batch   *jobBatch
+	work    chan *jobBatch
+	ordered chan *jobBatch
+	workers sync.WaitGroup
+	written chan struct{}
+	closed  bool
+
+	mu  sync.Mutex
+	err error
+}
+
+func newPipelineWriter(w io.StringWriter, workers int) *pipelineWriter {
+	p := &pipelineWriter{
+		w:       w,
+		work:    make(chan *jobBatch, workers),
+		ordered: make(chan *jobBatch, 2*workers),
+		written: make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for b := range p.work {
+				b.run()
+			}
+		}()
+	}
+	go p.writeOrdered()
+	return p
+}
+
+func (p *pipelineWriter) write(job maskJob, size int) error {
+	p.current().jobs = append(p.batch.jobs, job)
+	p.batch.size += size
+	if len(p.batch.jobs) >= pipelineBatchJobs || p.batch.size >= pipelineBatchBytes {
+		p.dispatch()
+	}
+	return p.error()
+}
+
+// cache implements jobWriter: jobs mask with the view of their batch.
+func (p *pipelineWriter) cache(shared *Cache) *Cache {
+	if shared == nil {
+		return nil
+	}
+	b := p.current()
+	if b.view == nil {
+		b.view = newCacheView(shared)
+	}
+	return b.view
+}
+
+// current returns the batch the next job joins.
+func (p *pipelineWriter) current() *jobBatch {
+	if p.batch == nil {
+		p.batch = &jobBatch{done: make(chan struct{})}
+	}
+	return p.batch
+}
+
+// dispatch queues the current batch for writing, then for masking. Queuing
+// for writing first keeps every batch the writer waits for already on its
+// way to a worker.
+func (p *pipelineWriter) dispatch() {
+	b := p.batch
+	p.batch = nil
+	p.ordered <- b
+	p.work <- b
+}
+
+// writeOrdered commits and writes batches in submission order. After a
+// write error the remaining batches are only drained.
+func (p *pipelineWriter) writeOrdered() {
+	defer close(p.written)
+	for b := range p.ordered {
+		<-b.done
+		if p.error() != nil {
+			continue
+		}
+		b.commit()
+		if _, err := p.w.WriteString(b.out.String()); err != nil {
+			p.mu.Lock()
+			p.err = err
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *pipelineWriter) close() error {
+	if p.closed {
+		return p.error()
+	}
+	p.closed = true
+	if p.batch != nil {
+		p.dispatch()
+	}
+	close(p.ordered)
+	close(p.work)
+	p.workers.Wait()
+	<-p.written
+	return p.error()
+}
+
+func (p *pipelineWriter) error() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
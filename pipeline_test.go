@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// processPipeline runs input through a parser the way main does, masking on
+// the given number of workers.
+func processPipeline(t *testing.T, parser DialectParser, config MaskConfig, cache *Cache, input string, workers int) string {
+	t.Helper()
+
+	var out strings.Builder
+	masker := &streamMasker{parser: parser, rt: newTestRuntime(), config: config, cache: cache, workers: workers}
+	if err := masker.maskDump(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("masking failed: %v", err)
+	}
+	return out.String()
+}
+
+func TestPipelineOutputMatchesSerial(t *testing.T) {
+	var mysql, postgres strings.Builder
+	mysql.WriteString("-- MySQL dump 10.13 admin@example.com\n")
+	mysql.WriteString("CREATE TABLE `users` (\n  `id` int,\n  `email` varchar(255),\n  `phone` varchar(32)\n);\n")
+	postgres.WriteString("-- PostgreSQL database dump\n")
+	postgres.WriteString("COPY public.users (id, email, phone) FROM stdin;\n")
+	for i := 0; i < 3000; i++ {
+		email := fmt.Sprintf("user%d@example.com", i%700)
+		phone := fmt.Sprintf("+7 912 %03d-%02d-%02d", i%1000, i%100, i%37)
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&mysql, "INSERT INTO `users` VALUES (%d,'%s','%s'),(%d,'it\\'s\nmulti-line %s','');\n", i, email, phone, i, email)
+		case 1:
+			fmt.Fprintf(&mysql, "INSERT INTO `logs` VALUES (%d,'%s');\n", i, email)
+		case 2:
+			fmt.Fprintf(&mysql, "INSERT INTO `users` VALUES\n(%d,'%s','%s'),\n(%d,'%s',NULL);\n", i, email, phone, i+1, email)
+		default:
+			fmt.Fprintf(&mysql, "-- note %d for %s\n", i, email)
+		}
+		fmt.Fprintf(&postgres, "%d\t%s\t%s\n", i, email, phone)
+	}
+	postgres.WriteString("\\.\n")
+	postgres.WriteString("INSERT INTO public.logs VALUES (1, 'copy@example.com');\n")
+
+	dumps := map[DumpDialect]string{
+		DialectMySQL:      mysql.String(),
+		DialectPostgreSQL: postgres.String(),
+	}
+	configs := map[string]func(){
+		"full-line": func() {},
+		"selective": func() {
+			ProcessingTables = map[string]TableConfig{
+				"users": {Email: []string{"email"}, Phone: []string{"phone"}},
+			}
+		},
+		"tables": func() {
+			SkipTableList = map[string]struct{}{"logs": {}}
+			EmailWhiteList = map[string]struct{}{"user7@example.com": {}}
+		},
+	}
+
+	for name, configure := range configs {
+		for dialect, dump := range dumps {
+			withTestGlobals(t, func() {
+				setupMaskingDefaults(t)
+				configure()
+
+				for _, parserDialect := range []DumpDialect{dialect, DialectAuto} {
+					serialRT := newTestRuntime()
+					serialRT.Stats = newRunStats()
+					want := processPipeline(t, NewDialectParser(parserDialect, serialRT), bothAlgorithms(), newCache(), dump, 1)
+
+					parallelRT := newTestRuntime()
+					parallelRT.Stats = newRunStats()
+					got := processPipeline(t, NewDialectParser(parserDialect, parallelRT), bothAlgorithms(), newCache(), dump, 4)
+					if got != want {
+						t.Fatalf("%s/%s/%s: parallel output differs from serial output", name, dialect, parserDialect)
+					}
+					if want == dump {
+						t.Fatalf("%s/%s/%s: expected masked output", name, dialect, parserDialect)
+					}
+
+					// Batches commit their cache operations in order, so
+					// even cache hits are counted as in the serial run.
+					tables := map[string]*tableStats{"": serialRT.Stats.Other}
+					for table, stats := range serialRT.Stats.Tables {
+						tables[table] = stats
+					}
+					for table, stats := range tables {
+						parallel := parallelRT.Stats.Other
+						if table != "" {
+							parallel = parallelRT.Stats.Tables[table]
+						}
+						if !reflect.DeepEqual(parallel, stats) {
+							t.Fatalf("%s/%s/%s: stats of %q differ: %+v vs %+v", name, dialect, parserDialect, table, parallel, stats)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCacheBatchCommitsInOrder(t *testing.T) {
+	shared := newCache()
+	first, second := newCacheView(shared), newCacheView(shared)
+
+	// Both batches run before either commits and claim the same mask.
+	if !first.claim(EmailTypeName, "a@example.com", "*@example.com") || !second.claim(EmailTypeName, "b@example.com", "*@example.com") {
+		t.Fatal("expected each view to claim the mask against the shared cache")
+	}
+	first.store(EmailTypeName, "a@example.com", "*@example.com")
+	second.store(EmailTypeName, "b@example.com", "*@example.com")
+	var effects []string
+	first.effect(func() { effects = append(effects, "first") })
+	second.effect(func() { effects = append(effects, "second") })
+	if len(effects) != 0 {
+		t.Fatalf("expected effects held until commit, got %v", effects)
+	}
+
+	if !first.batch.commit() {
+		t.Fatal("expected the first batch to commit")
+	}
+	if masked, ok := shared.lookup(EmailTypeName, "a@example.com"); !ok || masked != "*@example.com" {
+		t.Fatalf("expected the first batch applied, got %q, %v", masked, ok)
+	}
+	// The first batch took the mask, so the claim of the second is stale.
+	if second.batch.commit() {
+		t.Fatal("expected the second batch to be masked again")
+	}
+	if _, ok := shared.lookup(EmailTypeName, "b@example.com"); ok {
+		t.Fatal("expected nothing of the stale batch applied")
+	}
+	if !reflect.DeepEqual(effects, []string{"first"}) {
+		t.Fatalf("expected only the effects of the committed batch, got %v", effects)
+	}
+	// Masked again, the batch works on the shared cache directly.
+	if second.claim(EmailTypeName, "b@example.com", "*@example.com") {
+		t.Fatal("expected the mask owned by the first value")
+	}
+	second.effect(func() { effects = append(effects, "again") })
+	if len(effects) != 2 {
+		t.Fatalf("expected effects to run at once after commit, got %v", effects)
+	}
+}
+
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) WriteString(s string) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestPipelineReportsWriteErrors(t *testing.T) {
+	w := &failingWriter{}
+	jobs := newJobWriter(w, 2)
+	for i := 0; i < 3*pipelineBatchJobs; i++ {
+		_ = jobs.write(maskJob{text: "line\n"}, 5)
+	}
+	if err := jobs.close(); err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if w.writes != 1 {
+		t.Fatalf("expected writing to stop after the error, got %d writes", w.writes)
+	}
+	if err := jobs.close(); err == nil {
+		t.Fatal("expected a second close to report the error again")
+	}
+}
+
+func TestResolveWorkers(t *testing.T) {
+	if n, err := resolveWorkers(0); err != nil || n < 1 {
+		t.Fatalf("expected one worker per CPU, got %d, %v", n, err)
+	}
+	if n, err := resolveWorkers(3); err != nil || n != 3 {
+		t.Fatalf("expected 3 workers, got %d, %v", n, err)
+	}
+	if _, err := resolveWorkers(-1); err == nil {
+		t.Fatal("expected an error for a negative worker count")
+	}
+}
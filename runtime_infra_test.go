@@ -257,34 +257,6 @@ func TestTypeMaskingInfo(t *testing.T) {
 	}
 }
 
-func TestLegacyPackageLevelTableAPI(t *testing.T) {
-	withTestGlobals(t, func() {
-		setupMaskingDefaults(t)
-		ProcessingTables = map[string]TableConfig{
-			"users": {Email: []string{"email"}},
-		}
-		defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
-
-		ParseTableStructure("CREATE TABLE `users` (")
-		ParseTableStructure("  `id` int,")
-		ParseTableStructure("  `email` varchar(255)")
-		ParseTableStructure(");")
-
-		info, ok := GetTableInfo("users")
-		if !ok || len(info.Fields) != 2 {
-			t.Fatalf("expected users table with 2 fields, got: %+v (ok=%v)", info, ok)
-		}
-		if all := GetAllTables(); len(all) != 1 {
-			t.Fatalf("expected 1 table, got: %v", all)
-		}
-
-		out := ProcessDumpLine("INSERT INTO `users` VALUES (1,'test@example.com')", bothAlgorithms(), nil)
-		if !strings.Contains(out, "t098f6b@example.com") {
-			t.Fatalf("expected email masked via legacy API, got: %q", out)
-		}
-	})
-}
-
 func TestMaskPhoneWhiteListAndCache(t *testing.T) {
 	withTestGlobals(t, func() {
 		setupMaskingDefaults(t)
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const defaultScanMinHitRate = 0.5
+
+// dumpRow is one data row found in a dump: a VALUES tuple or a COPY line.
+type dumpRow struct {
+	// Table is the normalized, possibly schema-qualified table name.
+	Table string
+	// Columns holds the column names by position; nil when unknown.
+	Columns []string
+	Values  []string
+	// Line is the 1-based input line number the row was read from.
+	Line int
+}
+
+// rowWalker extracts data rows from dump lines without changing them. The
+// lines go through the masking parsers with a row visitor, so statements,
+// COPY blocks, skipped tables and values held across lines are handled as
+// when masking; the masking jobs are never run. With DialectAuto the lines
+// are held until a decisive marker line picks the dialect, as in masking.
+type rowWalker struct {
+	rt      *Runtime
+	dialect DumpDialect
+	parser  DialectParser
+	emit    func(dumpRow)
+	// text, when set, gets the lines that yielded no data row, joined
+	// when the parser held them for a statement.
+	text func(line int, text string)
+
+	// lines counts the input lines, line is the number of the line being
+	// parsed and rows the rows emitted so far.
+	lines int
+	line  int
+	rows  int
+	// undetected holds the lines read before the dialect is known, held
+	// the lines the parser consumed since the last walked one.
+	undetected []string
+	held       strings.Builder
+}
+
+func newRowWalker(rt *Runtime, dialect DumpDialect, emit func(dumpRow), text func(line int, text string)) *rowWalker {
+	w := &rowWalker{rt: rt, dialect: dialect, emit: emit, text: text}
+	rt.RowVisitor = func(table string, columns, values []string) {
+		w.rows++
+		w.emit(dumpRow{Table: table, Columns: columns, Values: values, Line: w.line})
+	}
+	if dialect != DialectAuto {
+		w.parser = NewDialectParser(dialect, rt)
+	}
+	return w
+}
+
+// walkLine consumes one input line.
+func (w *rowWalker) walkLine(line string) {
+	w.lines++
+	if w.parser != nil {
+		w.parse(line, w.lines)
+		return
+	}
+	w.undetected = append(w.undetected, line)
+	if dialect, ok := detectDialectLine(line); ok {
+		w.start(dialect)
+	} else if len(w.undetected) >= detectMaxBufferedLines {
+		w.start(DialectGeneric)
+	}
+}
+
+// finish walks the input still held at end of input.
+func (w *rowWalker) finish() {
+	if w.parser == nil {
+		w.start(DialectGeneric)
+	}
+	before := w.rows
+	flushJob(w.parser, MaskConfig{}, nil)
+	w.walked(before)
+}
+
+// start picks the parser of a dialect and walks the lines read before.
+func (w *rowWalker) start(dialect DumpDialect) {
+	w.dialect = dialect
+	w.parser = NewDialectParser(dialect, w.rt)
+	first := w.lines - len(w.undetected) + 1
+	for i, line := range w.undetected {
+		w.parse(line, first+i)
+	}
+	w.undetected = nil
+}
+
+// parse runs one line through the parser, which reports its rows.
+func (w *rowWalker) parse(line string, number int) {
+	w.line = number
+	w.held.WriteString(line)
+	before := w.rows
+	if _, drop := lineJob(w.parser, line, MaskConfig{}, nil); drop && w.rows == before {
+		return // held until its statement completes, or dropped
+	}
+	w.walked(before)
+}
+
+// walked hands the held lines to text when they yielded no row.
+func (w *rowWalker) walked(before int) {
+	if w.held.Len() > 0 && w.rows == before && w.text != nil {
+		w.text(w.line, w.held.String())
+	}
+	w.held.Reset()
+}
+
+// isNullValue reports whether a raw SQL or COPY value is NULL.
+func isNullValue(value string) bool {
+	return value == "NULL" || value == `\N`
+}
+
+// columnScan counts regex hits of every data type in one column.
+type columnScan struct {
+	Name string `json:"name"`
+	// Values counts non-NULL values.
+	Values int            `json:"values"`
+	Hits   map[string]int `json:"hits"`
+}
+
+// hitRate returns the share of non-NULL values matching a data type.
+func (c *columnScan) hitRate(typeName string) float64 {
+	if c.Values == 0 {
+		return 0
+	}
+	return float64(c.Hits[typeName]) / float64(c.Values)
+}
+
+// tableScan collects the column statistics of one table.
+type tableScan struct {
+	Name    string        `json:"name"`
+	Rows    int           `json:"rows"`
+	Columns []*columnScan `json:"columns"`
+	byName  map[string]*columnScan
+}
+
+// scanReport is the result of a PII discovery run.
+type scanReport struct {
+	Dialect DumpDialect  `json:"dialect"`
+	Tables  []*tableScan `json:"tables"`
+	types   []*DataType
+	byName  map[string]*tableScan
+}
+
+func newScanReport(types []*DataType) *scanReport {
+	return &scanReport{types: types, byName: make(map[string]*tableScan)}
+}
+
+// observe counts one data row. Columns without a known name are reported by
+// 1-based position as "#N".
+func (r *scanReport) observe(row dumpRow) {
+	table, ok := r.byName[row.Table]
+	if !ok {
+		table = &tableScan{Name: row.Table, byName: make(map[string]*columnScan)}
+		r.byName[row.Table] = table
+		r.Tables = append(r.Tables, table)
+	}
+	table.Rows++
+
+	for pos, value := range row.Values {
+		name := "#" + strconv.Itoa(pos+1)
+		if pos < len(row.Columns) {
+			name = row.Columns[pos]
+		}
+		col, ok := table.byName[name]
+		if !ok {
+			col = &columnScan{Name: name, Hits: make(map[string]int)}
+			table.byName[name] = col
+			table.Columns = append(table.Columns, col)
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || isNullValue(value) {
+			continue
+		}
+		col.Values++
+		for _, dt := range r.types {
+			if dt.Regex.MatchString(value) {
+				col.Hits[dt.Name]++
+			}
+		}
+	}
+}
+
+// suggest builds masking_tables entries for every named column whose hit
+// rate for a data type reaches minRate.
+func (r *scanReport) suggest(minRate float64) map[string]TableConfig {
+	tables := make(map[string]TableConfig)
+	for _, table := range r.Tables {
+		var cfg TableConfig
+		found := false
+		for _, col := range table.Columns {
+			if strings.HasPrefix(col.Name, "#") {
+				continue
+			}
+			for _, dt := range r.types {
+				if col.Hits[dt.Name] == 0 || col.hitRate(dt.Name) < minRate {
+					continue
+				}
+				found = true
+				switch dt.Name {
+				case EmailTypeName:
+					cfg.Email = append(cfg.Email, col.Name)
+				case PhoneTypeName:
+					cfg.Phone = append(cfg.Phone, col.Name)
+				default:
+					if cfg.Types == nil {
+						cfg.Types = make(map[string][]string)
+					}
+					cfg.Types[dt.Name] = append(cfg.Types[dt.Name], col.Name)
+				}
+			}
+		}
+		if found {
+			tables[table.Name] = cfg
+		}
+	}
+	return tables
+}
+
+// scanDump walks a whole dump and collects per-column hit statistics for
+// every registered data type.
+func scanDump(input io.Reader, rt *Runtime, dialect DumpDialect) (*scanReport, error) {
+	var types []*DataType
+	for _, dt := range rt.DataTypes {
+		if dt.Regex != nil {
+			types = append(types, dt)
+		}
+	}
+	report := newScanReport(types)
+	walker := newRowWalker(rt, dialect, report.observe, nil)
+
+	reader := bufio.NewReaderSize(input, defaultMaxBufferSize)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading input: %v", err)
+		}
+		if line != "" {
+			walker.walkLine(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	walker.finish()
+
+	report.Dialect = walker.dialect
+	if report.Dialect == DialectAuto {
+		report.Dialect = DialectGeneric
+	}
+	sort.Slice(report.Tables, func(i, j int) bool {
+		return report.Tables[i].Name < report.Tables[j].Name
+	})
+	return report, nil
+}
+
+// writeScanText prints the columns with at least one hit as a table, followed
+// by the suggested masking_tables fragment.
+func writeScanText(w io.Writer, report *scanReport, minRate float64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"TABLE", "COLUMN", "VALUES"}
+	for _, dt := range report.types {
+		header = append(header, strings.ToUpper(dt.Name))
+	}
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	rows := 0
+	for _, table := range report.Tables {
+		rows += table.Rows
+		for _, col := range table.Columns {
+			hit := false
+			cells := []string{table.Name, col.Name, strconv.Itoa(col.Values)}
+			for _, dt := range report.types {
+				hit = hit || col.Hits[dt.Name] > 0
+				cells = append(cells, fmt.Sprintf("%.1f%%", 100*col.hitRate(dt.Name)))
+			}
+			if hit {
+				_, _ = fmt.Fprintln(tw, strings.Join(cells, "\t"))
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fragment, err := json.MarshalIndent(map[string]interface{}{
+		"masking_tables": report.suggest(minRate),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\nScanned %d rows in %d tables (dialect: %s). Suggested config (hit rate >= %.0f%%):\n%s\n",
+		rows, len(report.Tables), report.Dialect, 100*minRate, fragment)
+	return err
+}
+
+// writeScanJSON prints the full report plus the suggested masking_tables.
+func writeScanJSON(w io.Writer, report *scanReport, minRate float64) error {
+	data, err := json.MarshalIndent(struct {
+		*scanReport
+		MaskingTables map[string]TableConfig `json:"masking_tables"`
+	}{report, report.suggest(minRate)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// runScan implements "maskdump scan": it reads a dump from stdin and reports
+// which columns hold PII instead of masking it.
+func runScan(args []string) int {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to config file")
+	dbFormat := flags.String("db-format", "", "Dump dialect: auto|mysql|postgresql|oracle|mssql|sqlite|firebird (default: config db_format or auto)")
+	minRate := flags.Float64("min-hit-rate", defaultScanMinHitRate, "Share of non-NULL values (0..1) a column must match to be suggested")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	_ = flags.Parse(args)
+
+	if *minRate <= 0 || *minRate > 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: --min-hit-rate must be in (0, 1]\n")
+		return 2
+	}
+	if err := LoadConfig(*configFile); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Config error: %v\n", err)
+		return 1
+	}
+	dialect, err := resolveDialect(MaskConfig{dbFormat: *dbFormat})
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	input, _, err := openDumpInput(os.Stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer func() { _ = input.Close() }()
+
+	report, err := scanDump(input, NewRuntimeFromGlobals(), dialect)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		err = writeScanJSON(writer, report, *minRate)
+	} else {
+		err = writeScanText(writer, report, *minRate)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 1
+	}
+	return 0
+}
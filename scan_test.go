@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestScanSuggestsColumnsPerDialect(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{}
+
+		dumps := map[string]string{
+			"mysql": "-- MySQL dump 10.13\n" +
+				"CREATE TABLE `users` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `contact` varchar(255) DEFAULT NULL,\n" +
+				"  `mobile` varchar(32) DEFAULT NULL,\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				") ENGINE=InnoDB;\n" +
+				"INSERT INTO `users` VALUES (1,'alice@example.com','+7 999 123-45-67'),(2,'bob@example.com',NULL),(3,'n/a\n(see notes),','89991234567');\n",
+			"postgresql": "-- PostgreSQL database dump\n" +
+				"COPY public.users (id, contact, mobile) FROM stdin;\n" +
+				"1\talice@example.com\t+7 999 123-45-67\n" +
+				"2\tbob@example.com\t\\N\n" +
+				"3\tn/a\t89991234567\n" +
+				"\\.\n",
+		}
+
+		for name, dump := range dumps {
+			report, err := scanDump(strings.NewReader(dump), newTestRuntime(), DialectAuto)
+			if err != nil {
+				t.Fatalf("%s: scan failed: %v", name, err)
+			}
+			if string(report.Dialect) != name {
+				t.Fatalf("%s: expected detected dialect, got: %s", name, report.Dialect)
+			}
+			if len(report.Tables) != 1 || report.Tables[0].Rows != 3 {
+				t.Fatalf("%s: expected one table with 3 rows, got: %+v", name, report.Tables)
+			}
+
+			suggested := report.suggest(0.5)
+			var cfg TableConfig
+			for _, c := range suggested {
+				cfg = c
+			}
+			if len(suggested) != 1 || strings.Join(cfg.Email, ",") != "contact" || strings.Join(cfg.Phone, ",") != "mobile" {
+				t.Fatalf("%s: unexpected suggestion: %+v", name, suggested)
+			}
+		}
+	})
+}
+
+func TestScanDecodesCopyValues(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{}
+
+		dump := "COPY public.users (id, contact) FROM stdin WITH (FORMAT csv, HEADER);\n" +
+			"id,contact\n" +
+			"1,\"alice@example.com\"\n" +
+			"2,\"bob@example.com,\nsecond line\"\n" +
+			"3,\n" +
+			"\\.\n" +
+			"COPY public.notes (id, body) FROM stdin;\n" +
+			"1\tcarol\\x40example.com\n" +
+			"\\.\n"
+
+		report, err := scanDump(strings.NewReader(dump), newTestRuntime(), DialectPostgreSQL)
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		users, notes := report.byName["public.users"], report.byName["public.notes"]
+		if users == nil || notes == nil || users.Rows != 3 {
+			t.Fatalf("expected 3 CSV rows without the header, got: %+v", report.Tables)
+		}
+		contact := users.byName["contact"]
+		if contact == nil || contact.Values != 2 || contact.Hits[EmailTypeName] != 2 {
+			t.Fatalf("expected 2 non-NULL contact values matching email, got: %+v", contact)
+		}
+		if body := notes.byName["body"]; body == nil || body.Hits[EmailTypeName] != 1 {
+			t.Fatalf("expected the escaped email decoded, got: %+v", body)
+		}
+	})
+}
+
+func TestScanReportsHitRatesAndUnnamedColumns(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{}
+
+		dump := "INSERT INTO notes VALUES (1,'write to alice@example.com');\n" +
+			"INSERT INTO notes VALUES (2,'nothing here');\n" +
+			"INSERT INTO contacts (id, email) VALUES (1,'a@example.com'),(2,'b@example.com'),(3,'none'),(4,'c@example.com');\n"
+
+		report, err := scanDump(strings.NewReader(dump), newTestRuntime(), DialectSQLite)
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+
+		var out bytes.Buffer
+		if err := writeScanJSON(&out, report, 0.7); err != nil {
+			t.Fatalf("failed to write report: %v", err)
+		}
+
+		var decoded struct {
+			Tables []struct {
+				Name    string `json:"name"`
+				Columns []struct {
+					Name   string         `json:"name"`
+					Values int            `json:"values"`
+					Hits   map[string]int `json:"hits"`
+				} `json:"columns"`
+			} `json:"tables"`
+			MaskingTables map[string]TableConfig `json:"masking_tables"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("report is not valid JSON: %v\n%s", err, out.String())
+		}
+
+		if len(decoded.Tables) != 2 || decoded.Tables[1].Name != "notes" || decoded.Tables[1].Columns[1].Name != "#2" {
+			t.Fatalf("expected positional columns for notes, got: %s", out.String())
+		}
+		email := decoded.Tables[0].Columns[1]
+		if email.Name != "email" || email.Values != 4 || email.Hits[EmailTypeName] != 3 {
+			t.Fatalf("unexpected contacts.email stats, got: %s", out.String())
+		}
+		// Positional columns are never suggested; 75% >= 70% is.
+		if len(decoded.MaskingTables) != 1 || strings.Join(decoded.MaskingTables["contacts"].Email, ",") != "email" {
+			t.Fatalf("unexpected masking_tables suggestion, got: %s", out.String())
+		}
+	})
+}
+
+func TestScanFollowsTableListsOfMasking(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{}
+		SkipTableList = map[string]struct{}{"logs": {}}
+		NoMaskTableList = map[string]struct{}{"notes": {}}
+
+		dump := "-- MySQL dump 10.13\n" +
+			"INSERT INTO `logs` VALUES\n" +
+			"(1,'alice@example.com'),\n" +
+			"(2,'bob@example.com');\n" +
+			"INSERT INTO `notes` (`id`, `body`) VALUES (1,'carol@example.com');\n" +
+			"INSERT INTO `users` (`id`, `email`) VALUES\n" +
+			"(1,'dave@example.com'),\n" +
+			"(2,'erin@example.com');\n"
+
+		report, err := scanDump(strings.NewReader(dump), newTestRuntime(), DialectAuto)
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		// Rows of skipped tables never reach the masked dump, not even the
+		// continuation lines of a multi-line INSERT.
+		if _, ok := report.byName["logs"]; ok || len(report.Tables) != 2 {
+			t.Fatalf("expected skipped tables left out, got: %+v", report.Tables)
+		}
+		if notes := report.byName["notes"]; notes == nil || notes.byName["body"].Hits[EmailTypeName] != 1 {
+			t.Fatalf("expected no-mask tables scanned, got: %+v", notes)
+		}
+		if users := report.byName["users"]; users == nil || users.Rows != 2 || users.byName["email"].Hits[EmailTypeName] != 2 {
+			t.Fatalf("expected both continuation rows of users, got: %+v", users)
+		}
+	})
+}
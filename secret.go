@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// minSecretLength is the shortest accepted secret key in bytes.
+const minSecretLength = 16
+
+// loadSecret reads a secret key from a file or from an environment variable.
+// Surrounding whitespace (such as the trailing newline of a key file) is
+// trimmed. Both sources unset means no key. The key itself never appears in
+// returned errors.
+func loadSecret(what, path, envName string) ([]byte, error) {
+	if path != "" && envName != "" {
+		return nil, fmt.Errorf("%s: set either the key file or the key environment variable, not both", what)
+	}
+
+	var secret string
+	switch {
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read key file %s: %v", what, path, err)
+		}
+		secret = strings.TrimSpace(string(data))
+	case envName != "":
+		value, ok := os.LookupEnv(envName)
+		if !ok {
+			return nil, fmt.Errorf("%s: environment variable %s is not set", what, envName)
+		}
+		secret = strings.TrimSpace(value)
+	default:
+		return nil, nil
+	}
+
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("%s: key must be at least %d bytes long", what, minSecretLength)
+	}
+	return []byte(secret), nil
+}
+
+// keyID derives a short public fingerprint of a key for a given purpose. It
+// lets persisted state (the cache) detect a key change without storing the
+// key.
+func keyID(key []byte, purpose string) string {
+	if key == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("maskdump:" + purpose))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// sqlLexer scans the VALUES lists of INSERT statements with the literal
+// rules of one dialect. It finds the top-level (...) tuples and the byte
+// ranges of the values inside them, so masking can rewrite single values
+// without touching the rest of the statement.
+//
+// Quoted literals escape a quote by doubling it in every dialect:
+//
+//	'O''Brien'
+//
+// They may carry a prefix: N'...' (MSSQL), X'...' (SQLite, MySQL),
+// _binary'...' (MySQL charset introducers), E'...' and U&'...'
+// (PostgreSQL). Nested parentheses and function calls such as
+// to_date('..', '..') stay inside one value.
+type sqlLexer struct {
+	// backslash makes "\" an escape character in every quoted literal
+	// (MySQL). Otherwise only PostgreSQL E'...' strings honor it.
+	backslash bool
+	// dollar enables PostgreSQL dollar-quoted strings ($$...$$,
+	// $tag$...$tag$).
+	dollar bool
+}
+
+// newSQLLexer returns the lexer for a dialect.
+func newSQLLexer(dialect DumpDialect) sqlLexer {
+	switch dialect {
+	case DialectPostgreSQL:
+		return sqlLexer{dollar: true}
+	case DialectOracle, DialectMSSQL, DialectSQLite, DialectFirebird:
+		return sqlLexer{}
+	default:
+		// MySQL, and dumps of unknown dialect, which historically were
+		// parsed with MySQL string rules.
+		return sqlLexer{backslash: true}
+	}
+}
+
+// sqlTuple locates one (...) tuple in a scanned string: s[Start:End] is the
+// tuple including its parentheses and Values holds the [start, end) ranges of
+// its raw values, surrounding whitespace included.
+type sqlTuple struct {
+	Start, End int
+	Values     [][2]int
+}
+
+// tuples scans a VALUES fragment and returns its complete tuples plus the
+// offset of a trailing clause such as MySQL "ON DUPLICATE KEY UPDATE ..." or
+// PostgreSQL "ON CONFLICT ..." (len(s) when there is none). The clause
+// starts at the first letter outside tuples; tuples inside it are not data
+// rows. A tuple left open at the end of s is not returned.
+func (l sqlLexer) tuples(s string) ([]sqlTuple, int) {
+	tuples, tail, _ := l.scan(s)
+	return tuples, tail
+}
+
+// unclosed reports whether s ends inside a tuple: a literal or a
+// parenthesis of the VALUES list continues past the end of s.
+func (l sqlLexer) unclosed(s string) bool {
+	_, _, open := l.scan(s)
+	return open
+}
+
+func (l sqlLexer) scan(s string) (tuples []sqlTuple, tail int, open bool) {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '(':
+			tuple, end := l.tuple(s, i)
+			if end < 0 {
+				return tuples, len(s), true
+			}
+			tuples = append(tuples, tuple)
+			i = end
+		case isSQLLetter(c):
+			return tuples, i, false
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			i = skipBlockComment(s, i)
+		default:
+			i++
+		}
+	}
+	return tuples, len(s), false
+}
+
+// tuple scans the tuple opening at s[start] and returns it with the offset
+// just past its closing parenthesis, or -1 when it does not close in s.
+func (l sqlLexer) tuple(s string, start int) (sqlTuple, int) {
+	tuple := sqlTuple{Start: start}
+	depth := 0
+	valueStart := start + 1
+	for i := start; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := l.skipQuoted(s, i, l.backslash || escapePrefix(s, i))
+			if end < 0 {
+				return tuple, -1
+			}
+			i = end
+			continue
+		case c == '$' && l.dollar:
+			if end, ok := skipDollarQuoted(s, i); ok {
+				if end < 0 {
+					return tuple, -1
+				}
+				i = end
+				continue
+			}
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			i = skipBlockComment(s, i)
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				tuple.Values = append(tuple.Values, [2]int{valueStart, i})
+				tuple.End = i + 1
+				return tuple, i + 1
+			}
+		case c == ',' && depth == 1:
+			tuple.Values = append(tuple.Values, [2]int{valueStart, i})
+			valueStart = i + 1
+		}
+		i++
+	}
+	return tuple, -1
+}
+
+// skipQuoted returns the offset just past the literal quoted by s[start], or
+// -1 when it does not close in s. A doubled quote stands for the quote
+// itself; with escapes a backslash escapes the next byte.
+func (l sqlLexer) skipQuoted(s string, start int, escapes bool) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// escapePrefix reports whether the quote at s[i] opens a PostgreSQL E'...'
+// string, where backslash escapes apply regardless of the dialect default.
+func escapePrefix(s string, i int) bool {
+	if i == 0 || (s[i-1] != 'E' && s[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isSQLIdentByte(s[i-2])
+}
+
+// skipDollarQuoted recognizes a PostgreSQL dollar-quoted string at s[start].
+// ok is false when s[start] does not open one (a "$" inside an identifier or
+// a positional parameter); otherwise end is the offset past the closing tag
+// or -1 when it does not close in s.
+func skipDollarQuoted(s string, start int) (end int, ok bool) {
+	if start > 0 && isSQLIdentByte(s[start-1]) {
+		return 0, false
+	}
+	i := start + 1
+	for i < len(s) && s[i] != '$' {
+		if !isSQLIdentByte(s[i]) || (i == start+1 && s[i] >= '0' && s[i] <= '9') {
+			return 0, false
+		}
+		i++
+	}
+	if i >= len(s) {
+		return 0, false
+	}
+	tag := s[start : i+1]
+	closing := strings.Index(s[i+1:], tag)
+	if closing < 0 {
+		return -1, true
+	}
+	return i + 1 + closing + len(tag), true
+}
+
+// skipBlockComment returns the offset just past the /* ... */ comment at
+// s[start], or len(s) when it does not close.
+func skipBlockComment(s string, start int) int {
+	end := strings.Index(s[start+2:], "*/")
+	if end < 0 {
+		return len(s)
+	}
+	return start + 2 + end + 2
+}
+
+func isSQLLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSQLIdentByte(c byte) bool {
+	return isSQLLetter(c) || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+// tupleValues returns the raw values of every tuple of s.
+func (l sqlLexer) tupleValues(s string) [][]string {
+	tuples, _ := l.tuples(s)
+	rows := make([][]string, 0, len(tuples))
+	for _, tuple := range tuples {
+		values := make([]string, len(tuple.Values))
+		for i, r := range tuple.Values {
+			values[i] = s[r[0]:r[1]]
+		}
+		rows = append(rows, values)
+	}
+	return rows
+}
+
+// maskTuples masks configured columns inside every tuple of a VALUES
+// fragment. Only changed values are rewritten; everything else, including a
+// trailing clause, is kept byte for byte.
+func maskTuples(rt *Runtime, lex sqlLexer, s string, masks columnMasks, cache *Cache, stats *tableStats) string {
+	if len(masks) == 0 {
+		return s
+	}
+	tuples, _ := lex.tuples(s)
+	var out strings.Builder
+	modified := false
+	last := 0
+	for _, tuple := range tuples {
+		for pos, r := range tuple.Values {
+			value := s[r[0]:r[1]]
+			masked := value
+			if column := masks[pos].doc; column != nil {
+				masked = column.maskLiteral(rt, lex, masked, cache, stats)
+			}
+			masked = maskValueAt(rt, masked, pos, masks, cache, stats)
+			if masked == value {
+				continue
+			}
+			if !modified {
+				out.Grow(len(s))
+				modified = true
+			}
+			out.WriteString(s[last:r[0]])
+			out.WriteString(masked)
+			last = r[1]
+		}
+	}
+	if !modified {
+		return s
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+// sqlCastRegex matches a PostgreSQL cast following a literal, such as
+// "::jsonb" or "::json[]".
+var sqlCastRegex = regexp.MustCompile(`^::\s*[A-Za-z_][\w ."]*(\[\])?$`)
+
+// sqlStringLiteral is a raw SQL value holding one quoted string, split
+// around its content: leading space, a charset introducer or E/N prefix,
+// the opening quote or dollar tag, the still escaped body, the closing
+// quote and the rest (a cast and trailing space).
+type sqlStringLiteral struct {
+	lead, prefix, open string
+	body               string
+	close, rest        string
+	// escapes tells whether body uses backslash escapes; mysql selects the
+	// escapes mysqldump writes over those of PostgreSQL E'...' strings.
+	escapes, mysql bool
+}
+
+// stringLiteral splits a raw value into a string literal. ok is false when
+// the value is anything else: NULL, a number, an X'...' blob, U&'...'
+// strings or an expression.
+func (l sqlLexer) stringLiteral(raw string) (sqlStringLiteral, bool) {
+	literal := sqlStringLiteral{escapes: l.backslash, mysql: l.backslash}
+	s := strings.TrimLeft(raw, " \t\r\n")
+	literal.lead = raw[:len(raw)-len(s)]
+	switch {
+	case strings.HasPrefix(s, "_") && l.backslash:
+		i := 1
+		for i < len(s) && isSQLIdentByte(s[i]) {
+			i++
+		}
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		literal.prefix, s = s[:i], s[i:]
+	case len(s) > 1 && (s[0] == 'E' || s[0] == 'e') && s[1] == '\'':
+		literal.prefix, s = s[:1], s[1:]
+		literal.escapes = true
+	case len(s) > 1 && (s[0] == 'N' || s[0] == 'n') && s[1] == '\'':
+		literal.prefix, s = s[:1], s[1:]
+	}
+
+	switch {
+	case s == "":
+		return literal, false
+	case s[0] == '$' && l.dollar && literal.prefix == "":
+		end, ok := skipDollarQuoted(s, 0)
+		if !ok || end < 0 {
+			return literal, false
+		}
+		tag := s[:strings.IndexByte(s[1:], '$')+2]
+		literal.open, literal.close = tag, tag
+		literal.body = s[len(tag) : end-len(tag)]
+		literal.escapes, literal.mysql = false, false
+		s = s[end:]
+	case s[0] == '\'' || s[0] == '"' && l.backslash:
+		end := l.skipQuoted(s, 0, literal.escapes)
+		if end < 0 {
+			return literal, false
+		}
+		literal.open, literal.close = s[:1], s[:1]
+		literal.body = s[1 : end-1]
+		s = s[end:]
+	default:
+		return literal, false
+	}
+	if cast := strings.TrimSpace(s); cast != "" && !sqlCastRegex.MatchString(cast) {
+		return literal, false
+	}
+	literal.rest = s
+	return literal, true
+}
+
+// value returns the unescaped content of the literal. ok is false when the
+// body holds an escape that cannot be decoded, such as a malformed \u of a
+// PostgreSQL E'...' string: quoting such a value again would change it.
+func (lit sqlStringLiteral) value() (string, bool) {
+	if lit.open != "'" && lit.open != `"` {
+		return lit.body, true
+	}
+	quote := lit.open[0]
+	var b strings.Builder
+	b.Grow(len(lit.body))
+	for i := 0; i < len(lit.body); i++ {
+		c := lit.body[i]
+		switch {
+		case c == quote && i+1 < len(lit.body) && lit.body[i+1] == quote:
+			i++
+			b.WriteByte(c)
+		case c == '\\' && lit.escapes && i+1 < len(lit.body):
+			n := 1
+			if lit.mysql {
+				unescapeMySQL(&b, lit.body[i+1])
+			} else if n = unescapePostgres(&b, lit.body[i+1:]); n == 0 {
+				return "", false
+			}
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// mysqlEscapes maps the characters after a backslash in a MySQL string to
+// what they stand for; any other character stands for itself.
+var mysqlEscapes = map[byte]byte{'0': 0, 'b': '\b', 'n': '\n', 'r': '\r', 't': '\t', 'Z': 0x1a}
+
+// unescapeMySQL writes what the backslash escape of a MySQL string ending in
+// c stands for.
+func unescapeMySQL(b *strings.Builder, c byte) {
+	switch c {
+	case '%', '_':
+		// Outside of LIKE patterns \% and \_ keep their backslash.
+		b.WriteByte('\\')
+	default:
+		if e, ok := mysqlEscapes[c]; ok {
+			c = e
+		}
+	}
+	b.WriteByte(c)
+}
+
+// postgresEscapes maps the characters after a backslash in a PostgreSQL
+// E'...' string to what they stand for, apart from the octal, \x, \u and
+// \U escapes; any other character stands for itself.
+var postgresEscapes = map[byte]byte{'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}
+
+// unescapePostgres writes what the backslash escape of a PostgreSQL E'...'
+// string at the start of s, after the backslash, stands for and returns
+// its length. It returns 0 for a \u or \U escape that is no valid
+// character.
+func unescapePostgres(b *strings.Builder, s string) int {
+	c := s[0]
+	switch {
+	case c >= '0' && c <= '7':
+		n, v := 1, int(c-'0')
+		for ; n < 3 && n < len(s) && s[n] >= '0' && s[n] <= '7'; n++ {
+			v = v*8 + int(s[n]-'0')
+		}
+		b.WriteByte(byte(v))
+		return n
+	case c == 'x' && len(s) > 1 && isHexDigit(s[1]):
+		n := 2
+		if len(s) > 2 && isHexDigit(s[2]) {
+			n = 3
+		}
+		v, _ := strconv.ParseUint(s[1:n], 16, 8)
+		b.WriteByte(byte(v))
+		return n
+	case c == 'u' || c == 'U':
+		digits := 4
+		if c == 'U' {
+			digits = 8
+		}
+		r, ok := hexRune(s[1:], digits)
+		n := 1 + digits
+		if ok && utf16.IsSurrogate(r) {
+			// A UTF-16 surrogate pair: \uD83D\uDE00.
+			var low rune
+			if len(s) >= n+2 && s[n] == '\\' && s[n+1] == 'u' {
+				low, ok = hexRune(s[n+2:], 4)
+			} else {
+				ok = false
+			}
+			if r = utf16.DecodeRune(r, low); r == utf8.RuneError {
+				ok = false
+			}
+			n += 6
+		}
+		if !ok || r <= 0 || r > unicode.MaxRune {
+			return 0
+		}
+		b.WriteRune(r)
+		return n
+	}
+	if e, ok := postgresEscapes[c]; ok {
+		c = e
+	}
+	b.WriteByte(c)
+	return 1
+}
+
+// hexRune parses the digits hex digits at the start of s.
+func hexRune(s string, digits int) (rune, bool) {
+	if len(s) < digits {
+		return 0, false
+	}
+	for i := 0; i < digits; i++ {
+		if !isHexDigit(s[i]) {
+			return 0, false
+		}
+	}
+	v, err := strconv.ParseUint(s[:digits], 16, 32)
+	return rune(v), err == nil
+}
+
+// withValue returns the literal holding value instead, quoted and escaped
+// in the form of the original. A dollar-quoted literal whose tag occurs in
+// value turns into a standard '...' string.
+func (lit sqlStringLiteral) withValue(value string) string {
+	if lit.open != "'" && lit.open != `"` {
+		if !strings.Contains(value, lit.close) {
+			return lit.lead + lit.open + value + lit.close + lit.rest
+		}
+		lit.open, lit.close = "'", "'"
+	}
+	quote := lit.open[0]
+	var b strings.Builder
+	b.Grow(len(value) + len(value)/8 + 8)
+	b.WriteString(lit.lead + lit.prefix + lit.open)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case lit.mysql:
+			switch c {
+			case 0:
+				b.WriteString(`\0`)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case 0x1a:
+				b.WriteString(`\Z`)
+			case '\\', '\'', '"':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			default:
+				b.WriteByte(c)
+			}
+		case c == quote:
+			b.WriteByte(c)
+			b.WriteByte(c)
+		case c == '\\' && lit.escapes:
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString(lit.close + lit.rest)
+	return b.String()
+}
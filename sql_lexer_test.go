@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSQLLexerTupleValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect DumpDialect
+		in      string
+		want    [][]string
+	}{
+		{"backslash escapes", DialectMySQL, `(1,'a,b','c\'d',NULL)`,
+			[][]string{{"1", "'a,b'", `'c\'d'`, "NULL"}}},
+		{"doubled quotes", DialectOracle, `(1,'O''Brien, Pat','x')`,
+			[][]string{{"1", "'O''Brien, Pat'", "'x'"}}},
+		{"trailing backslash is literal", DialectMSSQL, `(1,'C:\dir\','a@b.com')`,
+			[][]string{{"1", `'C:\dir\'`, "'a@b.com'"}}},
+		{"double-quoted strings", DialectMySQL, `(1,"say \"hi\", bye")`,
+			[][]string{{"1", `"say \"hi\", bye"`}}},
+		{"function calls", DialectOracle, `(1, to_date('2024-01-02', 'YYYY-MM-DD'), 'a@b.com')`,
+			[][]string{{"1", " to_date('2024-01-02', 'YYYY-MM-DD')", " 'a@b.com'"}}},
+		{"nested parens", DialectPostgreSQL, `(1, ARRAY[(1,(2,3))], 'x')`,
+			[][]string{{"1", " ARRAY[(1,(2,3))]", " 'x'"}}},
+		{"E strings", DialectPostgreSQL, `(1, E'it\'s, ok', 'C:\')`,
+			[][]string{{"1", ` E'it\'s, ok'`, ` 'C:\'`}}},
+		{"dollar quotes", DialectPostgreSQL, `(1, $$a,'b)$$, $tag$x$$,)$tag$)`,
+			[][]string{{"1", " $$a,'b)$$", " $tag$x$$,)$tag$"}}},
+		{"N strings", DialectMSSQL, `(1, N'Zoë, ''Z''')`,
+			[][]string{{"1", " N'Zoë, ''Z'''"}}},
+		{"binary literals", DialectMySQL, `(1,_binary 'a\'),(',0x2C29)`,
+			[][]string{{"1", `_binary 'a\'),('`, "0x2C29"}}},
+		{"blob literals", DialectSQLite, `(1,X'2C29','a')`,
+			[][]string{{"1", "X'2C29'", "'a'"}}},
+		{"several tuples", DialectMySQL, `(1,'a'),(2,'b');`,
+			[][]string{{"1", "'a'"}, {"2", "'b'"}}},
+		{"open tuple", DialectMySQL, `(1,'a'),(2,'b`,
+			[][]string{{"1", "'a'"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newSQLLexer(tt.dialect).tupleValues(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tupleValues(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLLexerTrailingClause(t *testing.T) {
+	tests := []struct {
+		in   string
+		rows int
+		tail string
+	}{
+		{"(1,'a'),(2,'b');", 2, ""},
+		{"(1,'on it') ON DUPLICATE KEY UPDATE a=VALUES(a);", 1, "ON DUPLICATE KEY UPDATE a=VALUES(a);"},
+		{"(1,f('x', g(2))) AS new ON DUPLICATE KEY UPDATE a=new.a;", 1, "AS new ON DUPLICATE KEY UPDATE a=new.a;"},
+		{"(1,'it''s') ON CONFLICT DO NOTHING;", 1, "ON CONFLICT DO NOTHING;"},
+	}
+	for _, tt := range tests {
+		tuples, tail := newSQLLexer(DialectPostgreSQL).tuples(tt.in)
+		if len(tuples) != tt.rows || tt.in[tail:] != tt.tail {
+			t.Fatalf("tuples(%q) = %d rows, tail %q; want %d, %q", tt.in, len(tuples), tt.in[tail:], tt.rows, tt.tail)
+		}
+	}
+}
+
+// Column positions must survive literals that used to split values.
+func TestSQLLexerKeepsColumnPositions(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}},
+		}
+
+		tests := []struct {
+			dialect DumpDialect
+			line    string
+		}{
+			{DialectOracle, "INSERT INTO users (note, created, email) VALUES ('O''Brien, a@x.org', to_date('2024-01-02', 'YYYY-MM-DD'), 'test@example.com');\n"},
+			{DialectMSSQL, "INSERT INTO [users] ([note], [created], [email]) VALUES (N'C:\\temp\\', N'a@x.org', N'test@example.com');\n"},
+			{DialectPostgreSQL, "INSERT INTO public.users (note, created, email) VALUES ($$a@x.org, (x)$$, E'it\\'s', 'test@example.com');\n"},
+			{DialectSQLite, "INSERT INTO \"users\" (note, created, email) VALUES (X'2C', 'a@x.org', 'test@example.com');\n"},
+			{DialectMySQL, "INSERT INTO `users` (`note`, `created`, `email`) VALUES (_binary 'a@x.org\\',',0x2C,'test@example.com');\n"},
+		}
+		for _, tt := range tests {
+			out := processDump(t, NewDialectParser(tt.dialect, newTestRuntime()), bothAlgorithms(), tt.line)
+			if !strings.Contains(out, "t098f6b@example.com") {
+				t.Fatalf("%s: expected email column masked, got: %s", tt.dialect, out)
+			}
+			if !strings.Contains(out, "a@x.org") {
+				t.Fatalf("%s: expected other columns left alone, got: %s", tt.dialect, out)
+			}
+			if want := strings.Replace(tt.line, "test@example.com", "t098f6b@example.com", 1); out != want {
+				t.Fatalf("%s: expected only the email value rewritten, got: %s", tt.dialect, out)
+			}
+		}
+	})
+}
+
+func TestSQLStringLiteral(t *testing.T) {
+	tests := []struct {
+		dialect DumpDialect
+		raw     string
+		value   string
+	}{
+		{DialectMySQL, ` '{\"a\": \"it\\\\s\"}'`, `{"a": "it\\s"}`},
+		{DialectMySQL, `_utf8mb4 'x\'y\nz'`, "x'y\nz"},
+		{DialectMySQL, `"say \"hi\""`, `say "hi"`},
+		{DialectPostgreSQL, ` '{"a": "it''s \d"}'::jsonb `, `{"a": "it's \d"}`},
+		{DialectPostgreSQL, `E'a\\b''c'`, `a\b'c`},
+		{DialectPostgreSQL, `$j${"a": "'"}$j$`, `{"a": "'"}`},
+		{DialectMSSQL, `N'Zoë ''Z'''`, "Zoë 'Z'"},
+	}
+	for _, tt := range tests {
+		literal, ok := newSQLLexer(tt.dialect).stringLiteral(tt.raw)
+		value, decoded := literal.value()
+		if !ok || !decoded || value != tt.value {
+			t.Fatalf("%s %q: got %q, %v, %v; want %q", tt.dialect, tt.raw, value, ok, decoded, tt.value)
+		}
+		if again := literal.withValue(tt.value); again != tt.raw {
+			t.Fatalf("%s %q: quoted again as %q", tt.dialect, tt.raw, again)
+		}
+	}
+
+	// Escapes that withValue writes in another form still have to decode,
+	// and the literal quoted again must hold the same value.
+	escapes := []struct {
+		dialect DumpDialect
+		raw     string
+		value   string
+	}{
+		{DialectMySQL, `'50\% off\_\t\0\q'`, "50\\% off\\_\t\x00q"},
+		{DialectPostgreSQL, `E'\x41\x4\xg\101\7\f'`, "A\x04xgA\a\f"},
+		{DialectPostgreSQL, `E'\u00e9\U0001F600\uD83D\uDE00 \q'`, "é😀😀 q"},
+	}
+	for _, tt := range escapes {
+		literal, ok := newSQLLexer(tt.dialect).stringLiteral(tt.raw)
+		value, decoded := literal.value()
+		if !ok || !decoded || value != tt.value {
+			t.Fatalf("%s %q: got %q, %v, %v; want %q", tt.dialect, tt.raw, value, ok, decoded, tt.value)
+		}
+		again, _ := newSQLLexer(tt.dialect).stringLiteral(literal.withValue(value))
+		if value, _ := again.value(); value != tt.value {
+			t.Fatalf("%s %q: quoted again as %q holding %q", tt.dialect, tt.raw, literal.withValue(tt.value), value)
+		}
+	}
+	for _, raw := range []string{`E'\u12'`, `E'\uD83D'`, `E'\uD83Dx'`, `E'\u0000'`, `E'\U00110000'`, `E'\UFFFFFFFF'`} {
+		literal, ok := newSQLLexer(DialectPostgreSQL).stringLiteral(raw)
+		if _, decoded := literal.value(); !ok || decoded {
+			t.Fatalf("%q: expected an escape that cannot be decoded", raw)
+		}
+	}
+
+	literal, _ := newSQLLexer(DialectPostgreSQL).stringLiteral(`$$x$$::json`)
+	if got := literal.withValue("a$$'b"); got != `'a$$''b'::json` {
+		t.Fatalf("expected a dollar tag inside the value to switch quoting, got %q", got)
+	}
+	for _, raw := range []string{"NULL", "42", "X'2C'", "CAST('{}' AS JSON)", "'a' || 'b'", "'open"} {
+		if _, ok := newSQLLexer(DialectMySQL).stringLiteral(raw); ok {
+			t.Fatalf("%q: expected no string literal", raw)
+		}
+	}
+}
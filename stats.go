@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// maskOutcome tells how one detected value was treated.
+type maskOutcome int
+
+const (
+	// outcomeUnchanged marks a value the masker left alone (an email
+	// without exactly one "@").
+	outcomeUnchanged maskOutcome = iota
+	// outcomeWhiteListed marks a value kept because it is white-listed.
+	outcomeWhiteListed
+	// outcomeCacheHit marks a value masked from the cache.
+	outcomeCacheHit
+	// outcomeCacheMiss marks a value whose mask was computed.
+	outcomeCacheMiss
+	// outcomeEncrypted marks a value masked by format-preserving
+	// encryption, which bypasses the cache.
+	outcomeEncrypted
+	// outcomeCollision marks a value whose computed mask already belonged
+	// to another value and was replaced by a tie-breaker variant.
+	outcomeCollision
+)
+
+// tableStats counts what happened to the data of one table.
+type tableStats struct {
+	mu sync.Mutex
+
+	RowsSeen    int64 `json:"rows_seen"`
+	RowsDropped int64 `json:"rows_dropped"`
+	RowsRaw     int64 `json:"rows_raw"`
+	// Masked counts replaced values per data type.
+	Masked        map[string]int64 `json:"masked"`
+	WhiteListHits map[string]int64 `json:"whitelist_hits"`
+	CacheHits     int64            `json:"cache_hits"`
+	CacheMisses   int64            `json:"cache_misses"`
+	// Collisions counts values per data type whose mask had to be made
+	// unique.
+	Collisions map[string]int64 `json:"collisions"`
+}
+
+func newTableStats() *tableStats {
+	return &tableStats{
+		Masked:        make(map[string]int64),
+		WhiteListHits: make(map[string]int64),
+		Collisions:    make(map[string]int64),
+	}
+}
+
+// addRows counts data rows: seen rows always, dropped (skip list) and raw
+// (no-mask list) rows as flagged. A nil receiver ignores the call, so
+// callers need no stats checks.
+func (t *tableStats) addRows(n int, dropped, raw bool) {
+	if t == nil || n == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.RowsSeen += int64(n)
+	if dropped {
+		t.RowsDropped += int64(n)
+	}
+	if raw {
+		t.RowsRaw += int64(n)
+	}
+}
+
+// recordMask counts the outcome of masking one value of a data type.
+func (t *tableStats) recordMask(typeName string, outcome maskOutcome) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch outcome {
+	case outcomeWhiteListed:
+		t.WhiteListHits[typeName]++
+	case outcomeCacheHit:
+		t.Masked[typeName]++
+		t.CacheHits++
+	case outcomeCacheMiss:
+		t.Masked[typeName]++
+		t.CacheMisses++
+	case outcomeEncrypted:
+		t.Masked[typeName]++
+	case outcomeCollision:
+		t.Masked[typeName]++
+		t.CacheMisses++
+		t.Collisions[typeName]++
+	}
+}
+
+// runStats is the machine-readable report of one run (--stats).
+type runStats struct {
+	mu sync.Mutex
+
+	Dialect DumpDialect `json:"dialect"`
+	Lines   int64       `json:"lines"`
+	// Tables is keyed by the normalized table name as written in the dump.
+	Tables map[string]*tableStats `json:"tables"`
+	// Other counts values masked outside any table's data rows (full-line
+	// masking of comments, DDL and lines of unknown layout).
+	Other *tableStats `json:"other"`
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		Tables: make(map[string]*tableStats),
+		Other:  newTableStats(),
+	}
+}
+
+// table returns the counters of a table reference. A nil receiver returns
+// nil counters.
+func (s *runStats) table(rawTable string) *tableStats {
+	if s == nil {
+		return nil
+	}
+	full, _ := normalizeTableName(rawTable)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.Tables[full]
+	if !ok {
+		t = newTableStats()
+		s.Tables[full] = t
+	}
+	return t
+}
+
+// other returns the counters for values outside table data rows.
+func (s *runStats) other() *tableStats {
+	if s == nil {
+		return nil
+	}
+	return s.Other
+}
+
+// write stores the report as JSON in path, or on stderr for "-".
+func (s *runStats) write(path string) error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stats %s: %v", path, err)
+	}
+	return nil
+}
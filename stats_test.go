@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunStatsCountsPerTable(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		EmailWhiteList = map[string]struct{}{"admin@example.com": {}}
+		SkipTableList = map[string]struct{}{"sessions": {}}
+		NoMaskTableList = map[string]struct{}{"audit": {}}
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}},
+		}
+
+		dump := "-- PostgreSQL database dump\n" +
+			"COPY public.users (id, email) FROM stdin;\n" +
+			"1\talice@example.com\n" +
+			"2\talice@example.com\n" +
+			"3\tadmin@example.com\n" +
+			"\\.\n" +
+			"INSERT INTO public.sessions VALUES (1,'x'),(2,'y');\n" +
+			"INSERT INTO public.audit VALUES\n" +
+			"(1,'bob@example.com'),\n" +
+			"(2,'bob@example.com');\n"
+
+		plain := processDump(t, NewDialectParser(DialectAuto, newTestRuntime()), bothAlgorithms(), dump)
+
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		parser := NewDialectParser(DialectAuto, rt)
+		if out := processDump(t, parser, bothAlgorithms(), dump); out != plain {
+			t.Fatalf("expected stats collection not to change the output, got: %s", out)
+		}
+		rt.Stats.Dialect = parser.Dialect()
+
+		path := filepath.Join(t.TempDir(), "stats.json")
+		if err := rt.Stats.write(path); err != nil {
+			t.Fatalf("failed to write stats: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+		var report runStats
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatalf("stats are not valid JSON: %v\n%s", err, data)
+		}
+
+		if report.Dialect != DialectPostgreSQL {
+			t.Fatalf("expected detected dialect in stats, got: %s", report.Dialect)
+		}
+		users := report.Tables["public.users"]
+		if users == nil || users.RowsSeen != 3 || users.Masked[EmailTypeName] != 2 || users.WhiteListHits[EmailTypeName] != 1 {
+			t.Fatalf("unexpected users stats: %s", data)
+		}
+		// The cache stays nil here, so every mask is computed.
+		if users.CacheHits != 0 || users.CacheMisses != 2 {
+			t.Fatalf("unexpected users cache stats: %s", data)
+		}
+		if s := report.Tables["public.sessions"]; s == nil || s.RowsSeen != 2 || s.RowsDropped != 2 {
+			t.Fatalf("unexpected sessions stats: %s", data)
+		}
+		if a := report.Tables["public.audit"]; a == nil || a.RowsSeen != 2 || a.RowsRaw != 2 || len(a.Masked) != 0 {
+			t.Fatalf("unexpected audit stats: %s", data)
+		}
+	})
+}
+
+func TestRunStatsCountsCacheHits(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		cache := newCache()
+		line := maskFullLine(rt, "alice@example.com bob@example.com alice@example.com\n", bothAlgorithms(), cache, rt.Stats.other())
+		if line == "alice@example.com bob@example.com alice@example.com\n" {
+			t.Fatal("expected the line to be masked")
+		}
+		if rt.Stats.Other.CacheHits != 1 || rt.Stats.Other.CacheMisses != 2 || rt.Stats.Other.Masked[EmailTypeName] != 3 {
+			t.Fatalf("unexpected cache stats: %+v", rt.Stats.Other)
+		}
+	})
+}
+
+func TestRunStatsCountsContinuationRowsOfUnconfiguredTables(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}},
+		}
+
+		dump := "INSERT INTO `orders` VALUES (1,'a'),\n" +
+			"(2,'b'),\n" +
+			"(3,'c');\n"
+		rt := newTestRuntime()
+		rt.Stats = newRunStats()
+		if out := processDump(t, NewDialectParser(DialectMySQL, rt), bothAlgorithms(), dump); out != dump {
+			t.Fatalf("expected the unconfigured table to pass through, got: %s", out)
+		}
+		if orders := rt.Stats.Tables["orders"]; orders == nil || orders.RowsSeen != 3 {
+			t.Fatalf("expected 3 rows counted, got: %+v", orders)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// tableFileExtensions lists the file name extensions of the dialects whose
+// input holds the rows of a single table, named by --table or, in an
+// --input-dir directory, by the file name.
+var tableFileExtensions = map[DumpDialect][]string{
+	DialectCSV:    {".csv"},
+	DialectTSV:    {".tsv"},
+	DialectNDJSON: {".ndjson", ".jsonl"},
+}
+
+// isTableFileDialect reports whether a dialect reads the rows of one table
+// rather than an SQL dump.
+func isTableFileDialect(dialect DumpDialect) bool {
+	_, ok := tableFileExtensions[dialect]
+	return ok
+}
+
+// newTableFileParser returns the parser for the rows of table in a file of
+// a table file dialect.
+func newTableFileParser(rt *Runtime, dialect DumpDialect, table string) DialectParser {
+	if dialect == DialectNDJSON {
+		return newNDJSONParser(rt, table)
+	}
+	return newDelimitedParser(rt, dialect, table)
+}
+
+// maskTableFileDirectory masks every file of the parser's dialect in inDir
+// (users.csv, or users.csv.gz for --db-format=csv) into outDir as the rows
+// of the table its name names. Files keep their compression and are masked
+// one after another, each on the worker pool (see maskDumpFiles); other
+// files are copied unchanged.
+func (m *streamMasker) maskTableFileDirectory(inDir, outDir string) error {
+	dialect := m.parser.Dialect()
+	extensions := tableFileExtensions[dialect]
+	files, err := mirrorDumpDirectory(inDir, outDir, func(path, rel, outPath string) (dumpFile, bool, error) {
+		name := trimDumpCompression(filepath.Base(path))
+		ext := filepath.Ext(name)
+		if !slices.Contains(extensions, strings.ToLower(ext)) {
+			return dumpFile{}, false, nil
+		}
+		table := strings.TrimSuffix(name, ext)
+		return dumpFile{
+			name: rel,
+			what: "rows of " + table,
+			mask: func() (int, error) {
+				masker := m.fileMasker(newTableFileParser(m.rt, dialect, table))
+				err := rewriteDumpFile(path, outPath, 0, func(r io.Reader, w *bufio.Writer) error {
+					return masker.maskDump(r, w)
+				})
+				return masker.lines, err
+			},
+		}, true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%s holds no %s files", inDir, strings.Join(extensions, " or "))
+	}
+	return m.maskDumpFiles(files)
+}
@@ -17,6 +17,10 @@ func withTestGlobals(t *testing.T, fn func()) {
 	origSkipTableList := SkipTableList
 	origNoMaskTableList := NoMaskTableList
 	origProcessingTables := ProcessingTables
+	origCustomDataTypes := CustomDataTypes
+	origHashKey := HashKey
+	origCacheKey := CacheKey
+	origFPEKey := FPEKey
 
 	t.Cleanup(func() {
 		AppConfig = origAppConfig
@@ -27,7 +31,10 @@ func withTestGlobals(t *testing.T, fn func()) {
 		SkipTableList = origSkipTableList
 		NoMaskTableList = origNoMaskTableList
 		ProcessingTables = origProcessingTables
-		defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
+		CustomDataTypes = origCustomDataTypes
+		HashKey = origHashKey
+		CacheKey = origCacheKey
+		FPEKey = origFPEKey
 	})
 
 	fn()
@@ -45,13 +52,15 @@ func setupMaskingDefaultsState() {
 	PhoneWhiteList = map[string]struct{}{}
 	SkipTableList = map[string]struct{}{}
 	NoMaskTableList = map[string]struct{}{}
+	CustomDataTypes = map[string]*DataType{}
+	HashKey = nil
+	CacheKey = nil
+	FPEKey = nil
 
 	AppConfig.Masking = MaskingConfig{
 		Email: MaskingRule{Target: "username:2-", Value: "hash:6"},
 		Phone: MaskingRule{Target: "2,3,5,6,8,10", Value: "hash"},
 	}
-
-	defaultTableParser = NewTableParser(NewRuntimeFromGlobals())
 }
 
 func newTestRuntime() *Runtime {
@@ -0,0 +1,137 @@
+CREATE TABLE public.audit (
+    id integer NOT NULL,
+    payload text
+);
+
+CREATE TABLE public.users (
+    id serial PRIMARY KEY,
+    email text,
+    phone text,
+    note text,
+    token text
+);
+
+COPY public.users (id, email, phone, note, token) FROM stdin;
+1	bob.ivanova1@example1.com	+7 901 037-01-13	ivanova bob	6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b
+2	carol.novak2@example2.com	+7 902 074-02-26	novak carol	d4735e3a265e16eee03f59718b9b5d03019c07d8b6c51f90da3a666eec13ab35
+3	dave.garcia3@example3.com	+7 903 111-03-39	garcia dave	4e07408562bedb8b60ce05c1decfe3ad16b72230967de01f640b7e4729b49fce
+4	erin.müller4@example4.com	+7 904 148-04-52	müller erin	4b227777d4dd1fc61c6f884f48641d02b4d121d3fd328cb08b5531fcacdabf8a
+5	frank.oneil5@example5.com	+7 905 185-05-65	o'neil frank	ef2d127de37b942baad06145e54b0c619a1f22327b2ebbcfbec78f5564afe39d
+6	grace.kim6@example6.com	+7 906 222-06-78	kim grace	e7f6c011776e8db7cd330b54174fd76f7d0216b612387a5ffcfb81e6f0919683
+7	heidi.rossi7@example0.com	+7 907 259-07-91	rossi heidi	7902699be42c8a8e46fbbb4501726517e86b22c56a189f7625a6da49081b2451
+8	ivan.smith8@example1.com	+7 908 296-08-04	smith ivan	2c624232cdd221771294dfbb310aca000a0df6ac8b66b696d90ef06fdefb64a3
+9	judy.ivanova9@example2.com	+7 909 333-09-17	ivanova judy	19581e27de7ced00ff1ce50b2047e7a567c76b1cbaebabe5ef03f7c3017bb5b7
+10	alice.novak10@example3.com	+7 910 370-10-30	novak alice	4a44dc15364204a80fe80e9039455cc1608281820fe2b24f1e5233ade6af1dd5
+11	bob.garcia11@example4.com	+7 911 407-11-43	garcia bob	4fc82b26aecb47d2868c4efbe3581732a3e7cbcc6c2efb32062c08170a05eeb8
+12	carol.müller12@example5.com	+7 912 444-12-56	müller carol	6b51d431df5d7f141cbececcf79edf3dd861c3b4069f0b11661a3eefacbba918
+13	dave.oneil13@example6.com	+7 913 481-13-69	o'neil dave	3fdba35f04dc8c462986c992bcf875546257113072a909c162f7e470e581e278
+14	erin.kim14@example0.com	+7 914 518-14-82	kim erin	8527a891e224136950ff32ca212b45bc93f69fbb801c3b1ebedac52775f99e61
+15	frank.rossi15@example1.com	+7 915 555-15-95	rossi frank	e629fa6598d732768f7c726b4b621285f9c3b85303900aa912017db7617d8bdb
+16	grace.smith16@example2.com	+7 916 592-16-08	smith grace	b17ef6d19c7a5b1ee83b907c595526dcb1eb06db8227d650d5dda0a9f4ce8cd9
+17	heidi.ivanova17@example3.com	+7 917 629-17-21	ivanova heidi	4523540f1504cd17100c4835e85b7eefd49911580f8efff0599a8f283be6b9e3
+18	ivan.novak18@example4.com	+7 918 666-18-34	novak ivan	4ec9599fc203d176a301536c2e091a19bc852759b255bd6818810a42c5fed14a
+19	judy.garcia19@example5.com	+7 919 703-19-47	garcia judy	9400f1b21cb527d7fa3d3eabba93557a18ebe7a2ca4e471cfe5e4c5b4ca7f767
+20	alice.müller20@example6.com	+7 920 740-20-60	müller alice	f5ca38f748a1d6eaf726b8a42fb575c3c71f1864a8143301782de13da2d9202b
+21	bob.oneil21@example0.com	+7 921 777-21-73	o'neil bob	6f4b6612125fb3a0daecd2799dfd6c9c299424fd920f9b308110a2c1fbd8f443
+22	carol.kim22@example1.com	+7 922 814-22-86	kim carol	785f3ec7eb32f30b90cd0fcf3657d388b5ff4297f2f9716ff66e9b69c05ddd09
+23	dave.rossi23@example2.com	+7 923 851-23-99	rossi dave	535fa30d7e25dd8a49f1536779734ec8286108d115da5045d77f3b4185d8f790
+24	erin.smith24@example3.com	+7 924 888-24-12	smith erin	c2356069e9d1e79ca924378153cfbbfb4d4416b1f99d41a2940bfdb66c5319db
+25	frank.ivanova25@example4.com	+7 925 925-25-25	ivanova frank	b7a56873cd771f2c446d369b649430b65a756ba278ff97ec81bb6f55b2e73569
+26	grace.novak26@example5.com	+7 926 962-26-38	novak grace	5f9c4ab08cac7457e9111a30e4664920607ea2c115a1433d7be98e97e64244ca
+27	heidi.garcia27@example6.com	+7 927 999-27-51	garcia heidi	670671cd97404156226e507973f2ab8330d3022ca96e0c93bdbdb320c41adcaf
+28	ivan.müller28@example0.com	+7 928 036-28-64	müller ivan	59e19706d51d39f66711c2653cd7eb1291c94d9b55eb14bda74ce4dc636d015a
+29	judy.oneil29@example1.com	+7 929 073-29-77	o'neil judy	35135aaa6cc23891b40cb3f378c53a17a1127210ce60e125ccf03efcfdaec458
+30	alice.kim30@example2.com	+7 930 110-30-90	call\tafter 6	624b60c58c9d8bfb6ff1886c2fd605d2adeb6ea4da576068201b6c6958ce93f4
+31	bob.rossi31@example3.com	+7 931 147-31-03	rossi bob	eb1e33e8a81b697b75855af6bfcdbcbf7cbbde9f94962ceaec1ed8af21f5a50f
+32	carol.smith32@example4.com	+7 932 184-32-16	smith carol	e29c9c180c6279b0b02abd6a1801c7c04082cf486ec027aa13515e4f3884bb6b
+33	dave.ivanova33@example5.com	+7 933 221-33-29	ivanova dave	c6f3ac57944a531490cd39902d0f777715fd005efac9a30622d5f5205e7f6894
+34	erin.novak34@example6.com	+7 934 258-34-42	novak erin	86e50149658661312a9e0b35558d84f6c6d3da797f552a9657fe0558ca40cdef
+35	frank.garcia35@example0.com	+7 935 295-35-55	garcia frank	9f14025af0065b30e47e23ebb3b491d39ae8ed17d33739e5ff3827ffb3634953
+36	grace.müller36@example1.com	+7 936 332-36-68	müller grace	76a50887d8f1c2e9301755428990ad81479ee21c25b43215cf524541e0503269
+37	heidi.oneil37@example2.com	+7 937 369-37-81	o'neil heidi	7a61b53701befdae0eeeffaecc73f14e20b537bb0f8b91ad7c2936dc63562b25
+38	ivan.kim38@example3.com	+7 938 406-38-94	kim ivan	aea92132c4cbeb263e6ac2bf6c183b5d81737f179f21efdc5863739672f0f470
+39	judy.rossi39@example4.com	+7 939 443-39-07	rossi judy	0b918943df0962bc7a1824c0555a389347b4febdc7cf9d1254406d80ce44e3f9
+40	alice.smith40@example5.com	+7 940 480-40-20	smith alice	d59eced1ded07f84c145592f65bdf854358e009c5cd705f5215bf18697fed103
+41	bob.ivanova41@example6.com	+7 941 517-41-33	ivanova bob	3d914f9348c9cc0ff8a79716700b9fcd4d2f3e711608004eb8f138bcba7f14d9
+42	carol.novak42@example0.com	+7 942 554-42-46	novak carol	73475cb40a568e8da8a045ced110137e159f890ac4da883b6b17dc651b3a8049
+43	dave.garcia43@example1.com	+7 943 591-43-59	garcia dave	44cb730c420480a0477b505ae68af508fb90f96cf0ec54c6ad16949dd427f13a
+44	erin.müller44@example2.com	+7 944 628-44-72	müller erin	71ee45a3c0db9a9865f7313dd3372cf60dca6479d46261f3542eb9346e4a04d6
+45	\N	+7 945 665-45-85	o'neil frank	811786ad1ae74adfdd20dd0372abaaebc6246e343aebd01da0bfc4c02bf0106c
+46	grace.kim46@example4.com	+7 946 702-46-98	kim grace	25fc0e7096fc653718202dc30b0c580b8ab87eac11a700cba03a7c021bc35b0c
+47	heidi.rossi47@example5.com	+7 947 739-47-11	rossi heidi	31489056e0916d59fe3add79e63f095af3ffb81604691f21cad442a85c7be617
+48	ivan.smith48@example6.com	+7 948 776-48-24	smith ivan	98010bd9270f9b100b6214a21754fd33bdc8d41b2bc9f9dd16ff54d3c34ffd71
+49	judy.ivanova49@example0.com	+7 949 813-49-37	ivanova judy	0e17daca5f3e175f448bacace3bc0da47d0655a74c8dd0dc497a3afbdad95f1f
+50	alice.novak50@example1.com	\N	novak alice	1a6562590ef19d1045d06c4055742d38288e9e6dcd71ccde5cee80f1d5a774eb
+51	bob.garcia51@example2.com	+7 951 887-51-63	garcia bob	031b4af5197ec30a926f48cf40e11a7dbc470048a21e4003b7a3c07c5dab1baa
+52	carol.müller52@example3.com	+7 952 924-52-76	müller carol	41cfc0d1f2d127b04555b7246d84019b4d27710a3f3aff6e7764375b1e06e05d
+53	dave.oneil53@example4.com	+7 953 961-53-89	o'neil dave	2858dcd1057d3eae7f7d5f782167e24b61153c01551450a628cee722509f6529
+54	erin.kim54@example5.com	+7 954 998-54-02	kim erin	2fca346db656187102ce806ac732e06a62df0dbb2829e511a770556d398e1a6e
+55	frank.rossi55@example6.com	+7 955 035-55-15	rossi frank	02d20bbd7e394ad5999a4cebabac9619732c343a4cac99470c03e23ba2bdc2bc
+56	grace.smith56@example0.com	+7 956 072-56-28	smith grace	7688b6ef52555962d008fff894223582c484517cea7da49ee67800adc7fc8866
+57	heidi.ivanova57@example1.com	+7 957 109-57-41	ivanova heidi	c837649cce43f2729138e72cc315207057ac82599a59be72765a477f22d14a54
+58	ivan.novak58@example2.com	+7 958 146-58-54	novak ivan	6208ef0f7750c111548cf90b6ea1d0d0a66f6bff40dbef07cb45ec436263c7d6
+59	judy.garcia59@example3.com	+7 959 183-59-67	garcia judy	3e1e967e9b793e908f8eae83c74dba9bcccce6a5535b4b462bd9994537bfe15c
+60	alice.müller60@example4.com	+7 960 220-60-80	call\tafter 6	39fa9ec190eee7b6f4dff1100d6343e10918d044c75eac8f9e9a2596173f80c9
+61	bob.oneil61@example5.com	+7 961 257-61-93	o'neil bob	d029fa3a95e174a19934857f535eb9427d967218a36ea014b70ad704bc6c8d1c
+62	carol.kim62@example6.com	+7 962 294-62-06	kim carol	81b8a03f97e8787c53fe1a86bda042b6f0de9b0ec9c09357e107c99ba4d6948a
+63	dave.rossi63@example0.com	+7 963 331-63-19	rossi dave	da4ea2a5506f2693eae190d9360a1f31793c98a1adade51d93533a6f520ace1c
+64	erin.smith64@example1.com	+7 964 368-64-32	smith erin	a68b412c4282555f15546cf6e1fc42893b7e07f271557ceb021821098dd66c1b
+65	frank.ivanova65@example2.com	+7 965 405-65-45	ivanova frank	108c995b953c8a35561103e2014cf828eb654a99e310f87fab94c2f4b7d2a04f
+66	grace.novak66@example3.com	+7 966 442-66-58	novak grace	3ada92f28b4ceda38562ebf047c6ff05400d4c572352a1142eedfef67d21e662
+67	heidi.garcia67@example4.com	+7 967 479-67-71	garcia heidi	49d180ecf56132819571bf39d9b7b342522a2ac6d23c1418d3338251bfe469c8
+68	ivan.müller68@example5.com	+7 968 516-68-84	müller ivan	a21855da08cb102d1d217c53dc5824a3a795c1c1a44e971bf01ab9da3a2acbbf
+69	judy.oneil69@example6.com	+7 969 553-69-97	o'neil judy	c75cb66ae28d8ebc6eded002c28a8ba0d06d3a78c6b5cbf9b2ade051f0775ac4
+70	alice.kim70@example0.com	+7 970 590-70-10	kim alice	ff5a1ae012afa5d4c889c50ad427aaf545d31a4fac04ffc1c4d03d403ba4250a
+71	bob.rossi71@example1.com	+7 971 627-71-23	rossi bob	7f2253d7e228b22a08bda1f09c516f6fead81df6536eb02fa991a34bb38d9be8
+72	carol.smith72@example2.com	+7 972 664-72-36	smith carol	8722616204217eddb39e7df969e0698aed8e599ba62ed2de1ce49b03ade0fede
+73	dave.ivanova73@example3.com	+7 973 701-73-49	ivanova dave	96061e92f58e4bdcdee73df36183fe3ac64747c81c26f6c83aada8d2aabb1864
+74	erin.novak74@example4.com	+7 974 738-74-62	novak erin	eb624dbe56eb6620ae62080c10a273cab73ae8eca98ab17b731446a31c79393a
+75	frank.garcia75@example5.com	+7 975 775-75-75	garcia frank	f369cb89fc627e668987007d121ed1eacdc01db9e28f8bb26f358b7d8c4f08ac
+76	grace.müller76@example6.com	+7 976 812-76-88	müller grace	f74efabef12ea619e30b79bddef89cffa9dda494761681ca862cff2871a85980
+77	heidi.oneil77@example0.com	+7 977 849-77-01	o'neil heidi	a88a7902cb4ef697ba0b6759c50e8c10297ff58f942243de19b984841bfe1f73
+78	ivan.kim78@example1.com	+7 978 886-78-14	kim ivan	349c41201b62db851192665c504b350ff98c6b45fb62a8a2161f78b6534d8de9
+79	judy.rossi79@example2.com	+7 979 923-79-27	rossi judy	98a3ab7c340e8a033e7b37b6ef9428751581760af67bbab2b9e05d4964a8874a
+80	alice.smith80@example3.com	+7 980 960-80-40	smith alice	48449a14a4ff7d79bb7a1b6f3d488eba397c36ef25634c111b49baf362511afc
+81	bob.ivanova81@example4.com	+7 981 997-81-53	ivanova bob	5316ca1c5ddca8e6ceccfce58f3b8540e540ee22f6180fb89492904051b3d531
+82	carol.novak82@example5.com	+7 982 034-82-66	novak carol	a46e37632fa6ca51a13fe39a567b3c23b28c2f47d8af6be9bd63e030e214ba38
+83	dave.garcia83@example6.com	+7 983 071-83-79	garcia dave	bbb965ab0c80d6538cf2184babad2a564a010376712012bd07b0af92dcd3097d
+84	erin.müller84@example0.com	+7 984 108-84-92	müller erin	44c8031cb036a7350d8b9b8603af662a4b9cdbd2f96e8d5de5af435c9c35da69
+85	frank.oneil85@example1.com	+7 985 145-85-05	o'neil frank	b4944c6ff08dc6f43da2e9c824669b7d927dd1fa976fadc7b456881f51bf5ccc
+86	grace.kim86@example2.com	+7 986 182-86-18	kim grace	434c9b5ae514646bbd91b50032ca579efec8f22bf0b4aac12e65997c418e0dd6
+87	heidi.rossi87@example3.com	+7 987 219-87-31	rossi heidi	bdd2d3af3a5a1213497d4f1f7bfcda898274fe9cb5401bbc0190885664708fc2
+88	ivan.smith88@example4.com	+7 988 256-88-44	smith ivan	8b940be7fb78aaa6b6567dd7a3987996947460df1c668e698eb92ca77e425349
+89	judy.ivanova89@example5.com	+7 989 293-89-57	ivanova judy	cd70bea023f752a0564abb6ed08d42c1440f2e33e29914e55e0be1595e24f45a
+90	\N	+7 990 330-90-70	call\tafter 6	69f59c273b6e669ac32a6dd5e1b2cb63333d8b004f9696447aee2d422ce63763
+91	bob.garcia91@example0.com	+7 991 367-91-83	garcia bob	1da51b8d8ff98f6a48f80ae79fe3ca6c26e1abb7b7d125259255d6d2b875ea08
+92	carol.müller92@example1.com	+7 992 404-92-96	müller carol	8241649609f88ccd2a0a5b233a07a538ec313ff6adf695aa44a969dbca39f67d
+93	dave.oneil93@example2.com	+7 993 441-93-09	o'neil dave	6e4001871c0cf27c7634ef1dc478408f642410fd3a444e2a88e301f5c4a35a4d
+94	erin.kim94@example3.com	+7 994 478-94-22	kim erin	e3d6c4d4599e00882384ca981ee287ed961fa5f3828e2adb5e9ea890ab0d0525
+95	frank.rossi95@example4.com	+7 995 515-95-35	rossi frank	ad48ff99415b2f007dc35b7eb553fd1eb35ebfa2f2f308acd9488eeb86f71fa8
+96	grace.smith96@example5.com	+7 996 552-96-48	smith grace	7b1a278f5abe8e9da907fc9c29dfd432d60dc76e17b0fabab659d2a508bc65c4
+97	heidi.ivanova97@example6.com	+7 997 589-00-61	ivanova heidi	d6d824abba4afde81129c71dea75b8100e96338da5f416d2f69088f1960cb091
+98	ivan.novak98@example0.com	+7 998 626-01-74	novak ivan	29db0c6782dbd5000559ef4d9e953e300e2b479eed26d887ef3f92b921c06a67
+99	judy.garcia99@example1.com	+7 999 663-02-87	garcia judy	8c1f1046219ddd216a023f792356ddf127fce372a72ec9b4cdac989ee5b0b455
+100	alice.müller100@example2.com	\N	müller alice	ad57366865126e55649ecb23ae1d48887544976efea46a48eb5d85a6eeb4d306
+101	bob.oneil101@example3.com	+7 901 737-04-13	o'neil bob	16dc368a89b428b2485484313ba67a3912ca03f2b2b42429174a4f8b3dc84e44
+102	carol.kim102@example4.com	+7 902 774-05-26	kim carol	37834f2f25762f23e1f74a531cbe445db73d6765ebe60878a7dfbecd7d4af6e1
+103	dave.rossi103@example5.com	+7 903 811-06-39	rossi dave	454f63ac30c8322997ef025edff6abd23e0dbe7b8a3d5126a894e4a168c1b59b
+104	erin.smith104@example6.com	+7 904 848-07-52	smith erin	5ef6fdf32513aa7cd11f72beccf132b9224d33f271471fff402742887a171edf
+105	frank.ivanova105@example0.com	+7 905 885-08-65	ivanova frank	1253e9373e781b7500266caa55150e08e210bc8cd8cc70d89985e3600155e860
+106	grace.novak106@example1.com	+7 906 922-09-78	novak grace	482d9673cfee5de391f97fde4d1c84f9f8d6f2cf0784fcffb958b4032de7236c
+107	heidi.garcia107@example2.com	+7 907 959-10-91	garcia heidi	3346f2bbf6c34bd2dbe28bd1bb657d0e9c37392a1d5ec9929e6a5df4763ddc2d
+108	ivan.müller108@example3.com	+7 908 996-11-04	müller ivan	9537f32ec7599e1ae953af6c9f929fe747ff9dadf79a9beff1f304c550173011
+109	judy.oneil109@example4.com	+7 909 033-12-17	o'neil judy	0fd42b3f73c448b34940b339f87d07adf116b05c0227aad72e8f0ee90533e699
+110	alice.kim110@example5.com	+7 910 070-13-30	kim alice	9bdb2af6799204a299c603994b8e400e4b1fd625efdb74066cc869fee42c9df3
+111	bob.rossi111@example6.com	+7 911 107-14-43	rossi bob	f6e0a1e2ac41945a9aa7ff8a8aaa0cebc12a3bcc981a929ad5cf810a090e11ae
+112	carol.smith112@example0.com	+7 912 144-15-56	smith carol	b1556dea32e9d0cdbfed038fd7787275775ea40939c146a64e205bcb349ad02f
+113	dave.ivanova113@example1.com	+7 913 181-16-69	ivanova dave	6c658ee83fb7e812482494f3e416a876f63f418a0b8a1f5e76d47ee4177035cb
+114	erin.novak114@example2.com	+7 914 218-17-82	novak erin	9f1f9dce319c4700ef28ec8c53bd3cc8e6abe64c68385479ab89215806a5bdd6
+115	frank.garcia115@example3.com	+7 915 255-18-95	garcia frank	28dae7c8bde2f3ca608f86d0e16a214dee74c74bee011cdfdd46bc04b655bc14
+116	grace.müller116@example4.com	+7 916 292-19-08	müller grace	e5b861a6d8a966dfca7e7341cd3eb6be9901688d547a72ebed0b1f5e14f3d08d
+117	heidi.oneil117@example5.com	+7 917 329-20-21	o'neil heidi	2ac878b0e2180616993b4b6aa71e61166fdc86c28d47e359d0ee537eb11d46d3
+118	ivan.kim118@example6.com	+7 918 366-21-34	kim ivan	85daaf6f7055cd5736287faed9603d712920092c4f8fd0097ec3b650bf27530e
+119	judy.rossi119@example0.com	+7 919 403-22-47	rossi judy	3038bfb575bee6a0e61945eff8784835bb2c720634e42734678c083994b7f018
+120	alice.smith120@example1.com	+7 920 440-23-60	call\tafter 6	2abaca4911e68fa9bfbf3482ee797fd5b9045b841fdff7253557c5fe15de6477
+\.
+
+SELECT pg_catalog.setval('public.users_id_seq', 120, true);
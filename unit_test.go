@@ -2,6 +2,7 @@ package main
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -40,18 +41,7 @@ func TestApplyMaskingAsterisk(t *testing.T) {
 	}
 }
 
-func TestParseTuple(t *testing.T) {
-	tuple := "(1,'a,b','c\\'d',NULL)"
-	values := parseTuple(tuple)
-	if len(values) != 4 {
-		t.Fatalf("expected 4 values, got %d", len(values))
-	}
-	if values[0] != "1" || values[1] != "'a,b'" || values[2] != "'c'd'" || values[3] != "NULL" {
-		t.Fatalf("unexpected values: %v", values)
-	}
-}
-
-func TestParseTableStructureAndProcessDumpLine(t *testing.T) {
+func TestCreateTableColumnsMaskInsertWithoutColumnList(t *testing.T) {
 	withTestGlobals(t, func() {
 		setupMaskingDefaults(t)
 
@@ -61,23 +51,11 @@ func TestParseTableStructureAndProcessDumpLine(t *testing.T) {
 				Phone: []string{"PHONE"},
 			},
 		}
-		runtimeState := newTestRuntime()
-		parser := NewTableParser(runtimeState)
-
-		createLines := []string{
-			"CREATE TABLE `users` (",
-			"  `ID` int,",
-			"  `EMAIL` varchar(255),",
-			"  `PHONE` varchar(32)",
-			");",
-		}
-		for _, line := range createLines {
-			parser.ParseTableStructure(line)
-		}
-
+		parser := NewDialectParser(DialectMySQL, newTestRuntime())
 		config := MaskConfig{emailAlgorithm: "light-hash", phoneAlgorithm: "light-mask"}
-		line := "INSERT INTO `users` VALUES (1, 'test@example.com', '+7 (123) 456-78-90');"
-		out := parser.ProcessDumpLine(line, config, nil)
+		line := "INSERT INTO `users` VALUES (1, 'test@example.com', '+7 (123) 456-78-90');\n"
+		out := processDump(t, parser, config, "CREATE TABLE `users` (\n  `ID` int,\n  `EMAIL` varchar(255),\n  `PHONE` varchar(32)\n);\n"+line)
+		out = out[strings.Index(out, "INSERT"):]
 
 		if out == line {
 			t.Fatalf("expected masked output, got unchanged line")
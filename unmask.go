@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runUnmask implements "maskdump unmask": it decrypts emails or phones that
+// were masked with ff1 or ff3-1, using the fpe key of the config. Values
+// come from the arguments or, without any, one per line from stdin; each
+// original is printed on its own line. It exits with status 1 when a value
+// cannot be decrypted and with status 2 on errors.
+func runUnmask(args []string) int {
+	flags := flag.NewFlagSet("unmask", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to config file")
+	typeName := flags.String("type", "", "Data type of the values: email|phone")
+	algorithm := flags.String("algorithm", algorithmFF1, "Algorithm the values were masked with: ff1|ff3-1")
+	_ = flags.Parse(args)
+
+	if err := LoadConfig(*configFile); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Config error: %v\n", err)
+		return 2
+	}
+	fpe, err := newFPECipher(*algorithm, FPEKey)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	var decrypt func(value string) (string, bool)
+	switch *typeName {
+	case EmailTypeName:
+		decrypt = func(value string) (string, bool) { return fpe.email(value, true) }
+	case PhoneTypeName:
+		// Phones are decrypted at the digits the masking run encrypted.
+		rule := AppConfig.Masking.Phone
+		decrypt = func(value string) (string, bool) { return fpe.phone(value, rule, true) }
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Error: --type must be %s or %s\n", EmailTypeName, PhoneTypeName)
+		return 2
+	}
+
+	values := flags.Args()
+	if len(values) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if value := strings.TrimSpace(scanner.Text()); value != "" {
+				values = append(values, value)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			return 2
+		}
+	}
+
+	status := 0
+	writer := bufio.NewWriter(os.Stdout)
+	for _, value := range values {
+		original, ok := decrypt(value)
+		if !ok {
+			_, _ = fmt.Fprintf(os.Stderr, "%s: too short to be an encrypted %s\n", value, *typeName)
+			status = 1
+			continue
+		}
+		_, _ = fmt.Fprintln(writer, original)
+	}
+	if err := writer.Flush(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		return 2
+	}
+	return status
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// leak is one original value found in a masked dump.
+type leak struct {
+	Line   int
+	Table  string
+	Column string
+	Type   string
+	Value  string
+}
+
+// leakDetector finds values that still match a data type regex, are not
+// white-listed and are known originals.
+type leakDetector struct {
+	types      []*DataType
+	isOriginal func(dt *DataType, value string) bool
+	leaks      []leak
+	candidates int
+}
+
+// check examines one value (or a whole unparsed line when column is "").
+func (d *leakDetector) check(line int, table, column, value string) {
+	for _, dt := range d.types {
+		for _, match := range dt.Regex.FindAllString(value, -1) {
+			if _, ok := dt.WhiteList[match]; ok {
+				continue
+			}
+			d.candidates++
+			if d.isOriginal(dt, match) {
+				d.leaks = append(d.leaks, leak{Line: line, Table: table, Column: column, Type: dt.Name, Value: match})
+			}
+		}
+	}
+}
+
+// verifyDump walks a masked dump and reports every leaked original value.
+// Values of data rows are checked per column; lines that hold no data row
+// (comments, DDL, unparsed statements) are checked as a whole. It returns the
+// leaks and the number of candidate values checked.
+func verifyDump(input io.Reader, rt *Runtime, dialect DumpDialect, isOriginal func(dt *DataType, value string) bool) ([]leak, int, error) {
+	detector := &leakDetector{isOriginal: isOriginal}
+	for _, dt := range rt.DataTypes {
+		if dt.Regex != nil {
+			detector.types = append(detector.types, dt)
+		}
+	}
+
+	// A masked dump holds no rows of skipped tables; should it, they are
+	// checked like any other.
+	rt.SkipTableList = nil
+	walker := newRowWalker(rt, dialect, func(row dumpRow) {
+		for pos, value := range row.Values {
+			column := "#" + strconv.Itoa(pos+1)
+			if pos < len(row.Columns) {
+				column = row.Columns[pos]
+			}
+			detector.check(row.Line, row.Table, column, value)
+		}
+	}, func(line int, text string) {
+		detector.check(line, "", "", text)
+	})
+
+	reader := bufio.NewReaderSize(input, defaultMaxBufferSize)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("error reading input: %v", err)
+		}
+		if line != "" {
+			walker.walkLine(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	walker.finish()
+	return detector.leaks, detector.candidates, nil
+}
+
+// redactValue hides a leaked value in reports: CI logs must not repeat the
+// PII they are guarding. Only the first and last characters stay.
+func redactValue(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 2 {
+		return "**"
+	}
+	return string(runes[0]) + "***" + string(runes[len(runes)-1])
+}
+
+// openVerifyCache loads the cache as the source of original values. A
+// missing cache file is an error: an empty cache would report every dump as
+// clean.
+func openVerifyCache() (*Cache, error) {
+	if _, err := os.Stat(AppConfig.CachePath); err != nil {
+		return nil, fmt.Errorf("cache %s not found: verify needs the cache of the masking run or --fingerprints", AppConfig.CachePath)
+	}
+	cache, err := loadCache()
+	if err != nil {
+		// Even a recoverable load problem (another hash key) means the
+		// cache does not describe the dump being verified.
+		_ = closeCache(cache)
+		return nil, err
+	}
+	return cache, nil
+}
+
+// runVerify implements "maskdump verify": it reads a masked dump from stdin
+// and exits with status 1 when any original value is still present. Errors
+// exit with status 2.
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to config file")
+	dbFormat := flags.String("db-format", "", "Dump dialect: auto|mysql|postgresql|oracle|mssql|sqlite|firebird (default: config db_format or auto)")
+	fingerprintPath := flags.String("fingerprints", "", "Fingerprint file written by the masking run (--fingerprints); replaces the cache as the source of originals")
+	_ = flags.Parse(args)
+
+	if err := LoadConfig(*configFile); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Config error: %v\n", err)
+		return 2
+	}
+	dialect, err := resolveDialect(MaskConfig{dbFormat: *dbFormat})
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	var isOriginal func(dt *DataType, value string) bool
+	var cache *Cache
+	if *fingerprintPath != "" {
+		fingerprints, err := loadFingerprints(*fingerprintPath, HashKey)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		isOriginal = func(dt *DataType, value string) bool {
+			return fingerprints.contains(dt.Name, value)
+		}
+	} else {
+		cache, err = openVerifyCache()
+		if err != nil {
+			if !errors.Is(err, errCacheIntegrity) {
+				err = fmt.Errorf("cannot use cache: %v", err)
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		defer func() { _ = closeCache(cache) }()
+		isOriginal = func(dt *DataType, value string) bool {
+			_, ok := cache.lookup(dt.Name, value)
+			return ok
+		}
+	}
+
+	input, _, err := openDumpInput(os.Stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer func() { _ = input.Close() }()
+
+	leaks, candidates, err := verifyDump(input, NewRuntimeFromGlobals(), dialect, isOriginal)
+	if err == nil {
+		// A tampered cache entry reads as a miss: the report cannot be
+		// trusted.
+		err = cache.Err()
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	for _, l := range leaks {
+		location := "outside table data"
+		if l.Table != "" {
+			location = "table " + l.Table + ", column " + l.Column
+		}
+		_, _ = fmt.Fprintf(writer, "line %d: %s: leaked %s %s\n", l.Line, location, l.Type, redactValue(l.Value))
+	}
+	if len(leaks) > 0 {
+		_, _ = fmt.Fprintf(writer, "FAIL: %d leaked values (%d candidate values checked)\n", len(leaks), candidates)
+	} else {
+		_, _ = fmt.Fprintf(writer, "OK: no leaked values (%d candidate values checked)\n", candidates)
+	}
+	if err := writer.Flush(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 2
+	}
+	if len(leaks) > 0 {
+		return 1
+	}
+	return 0
+}
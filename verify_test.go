@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDumpReportsLeakedOriginals(t *testing.T) {
+	withTestGlobals(t, func() {
+		setupMaskingDefaults(t)
+		EmailWhiteList = map[string]struct{}{"admin@example.com": {}}
+		ProcessingTables = map[string]TableConfig{
+			"users": {Email: []string{"email"}},
+		}
+
+		dump := "-- PostgreSQL database dump\n" +
+			"COPY public.users (id, email, note) FROM stdin;\n" +
+			"1\talice@example.com\tcall alice@example.com\n" +
+			"2\tadmin@example.com\tadmin@example.com\n" +
+			"\\.\n" +
+			"-- owner: alice@example.com\n"
+
+		rt := newTestRuntime()
+		var err error
+		if rt.Fingerprints, err = newFingerprintSet([]byte("0123456789abcdef0123")); err != nil {
+			t.Fatal(err)
+		}
+		masked := processDump(t, NewDialectParser(DialectPostgreSQL, rt), bothAlgorithms(), dump)
+
+		isOriginal := func(dt *DataType, value string) bool {
+			return rt.Fingerprints.contains(dt.Name, value)
+		}
+		leaks, candidates, err := verifyDump(strings.NewReader(masked), rt, DialectAuto, isOriginal)
+		if err != nil {
+			t.Fatalf("verify failed: %v", err)
+		}
+		if candidates != 3 {
+			t.Fatalf("expected 3 non-whitelisted candidates, got: %d", candidates)
+		}
+		if len(leaks) != 2 {
+			t.Fatalf("expected the note column and the comment to leak, got: %+v", leaks)
+		}
+		if leaks[0].Line != 3 || leaks[0].Table != "public.users" || leaks[0].Column != "note" || leaks[0].Type != EmailTypeName {
+			t.Fatalf("unexpected first leak: %+v", leaks[0])
+		}
+		if leaks[1].Line != 6 || leaks[1].Table != "" || leaks[1].Value != "alice@example.com" {
+			t.Fatalf("unexpected second leak: %+v", leaks[1])
+		}
+		if got := redactValue(leaks[1].Value); got != "a***m" {
+			t.Fatalf("expected redacted value, got: %s", got)
+		}
+	})
+}
+
+func TestFingerprintFileRoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef0123")
+	path := filepath.Join(t.TempDir(), "fingerprints")
+
+	set, err := newFingerprintSet(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.add(EmailTypeName, "alice@example.com")
+	set.add(PhoneTypeName, "+7 999 123-45-67")
+	if err := set.save(path); err != nil {
+		t.Fatalf("failed to save fingerprints: %v", err)
+	}
+
+	loaded, err := loadFingerprints(path, key)
+	if err != nil {
+		t.Fatalf("failed to load fingerprints: %v", err)
+	}
+	if !loaded.contains(EmailTypeName, "alice@example.com") || !loaded.contains(PhoneTypeName, "+7 999 123-45-67") {
+		t.Fatal("expected recorded originals to be found")
+	}
+	if loaded.contains(PhoneTypeName, "alice@example.com") {
+		t.Fatal("fingerprints must be bound to the data type")
+	}
+
+	if _, err := loadFingerprints(path, []byte("another key of 16+ bytes")); err == nil || !strings.Contains(err.Error(), "different hash key") {
+		t.Fatalf("expected hash key mismatch error, got: %v", err)
+	}
+	if _, err := loadFingerprints(path, nil); err == nil || !strings.Contains(err.Error(), "need a hash key") {
+		t.Fatalf("expected fingerprints without a hash key refused, got: %v", err)
+	}
+	if _, err := newFingerprintSet(nil); err == nil {
+		t.Fatal("expected unkeyed fingerprints refused")
+	}
+}